@@ -0,0 +1,223 @@
+// Package address cleans up the addresses the customers type in and checks them against the rules of their country.
+// The postal code rules come from a local json file, one entry per ISO 3166-1 alpha-2 country code.
+package address
+
+import (
+	"ecommerce/models"
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Country is the entry of one country in the rules file
+type Country struct {
+	Name           string   `json:"name"`
+	Postal_Code    string   `json:"postal_code,omitempty"` // Regular expression of the postal code after normalisation, empty for countries without postal codes
+	Example        string   `json:"example,omitempty"`     // Shown in the error message
+	Compact        bool     `json:"compact,omitempty"`     // The postal code is written without spaces
+	State_Required bool     `json:"state_required,omitempty"`
+	States         []string `json:"states,omitempty"` // When listed the state must be one of them, written like here
+
+	pattern *regexp.Regexp
+}
+
+// Rules are the countries the store ships to
+type Rules struct {
+	Countries map[string]*Country
+}
+
+// FieldErrors has one message per json field of the address
+type FieldErrors map[string]string
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// Load reads the rules file and compiles its postal code patterns
+func Load(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	countries := make(map[string]*Country)
+	if err := json.Unmarshal(data, &countries); err != nil {
+		return nil, err
+	}
+
+	rules := &Rules{Countries: make(map[string]*Country, len(countries))}
+	for code, country := range countries {
+		if country.Postal_Code != "" {
+			if country.pattern, err = regexp.Compile(country.Postal_Code); err != nil {
+				return nil, errors.New("invalid postal code pattern of " + code + " :- " + err.Error())
+			}
+		}
+		rules.Countries[strings.ToUpper(code)] = country
+	}
+
+	return rules, nil
+}
+
+// Normalize tidies an address up in place :- single spaces, upper case country and postal code, the state written like in the rules file
+// and a city or state typed all in upper or lower case gets capital initials. Names and house numbers only lose their extra spaces.
+func (r *Rules) Normalize(address *models.Address, defaultCountry string) {
+	address.Label = collapse(address.Label)
+	address.Recipient_Name = collapse(address.Recipient_Name)
+	address.Country = strings.ToUpper(collapse(address.Country))
+	if address.Country == "" {
+		address.Country = strings.ToUpper(defaultCountry)
+	}
+
+	tidy := func(value *string, format func(string) string) *string {
+		if value == nil {
+			return nil
+		}
+		cleaned := format(collapse(*value))
+		return &cleaned
+	}
+
+	address.House = tidy(address.House, keep)
+	address.Street = tidy(address.Street, keep)
+	address.City = tidy(address.City, titleIfOneCase)
+	address.State = tidy(address.State, titleIfOneCase)
+	address.Phone = tidy(address.Phone, phoneDigits)
+	address.Pincode = tidy(address.Pincode, strings.ToUpper)
+
+	country := r.country(address.Country)
+	if country == nil {
+		return
+	}
+
+	if country.Compact && address.Pincode != nil {
+		compact := strings.ReplaceAll(*address.Pincode, " ", "")
+		address.Pincode = &compact
+	}
+
+	if address.State != nil {
+		for _, state := range country.States {
+			if strings.EqualFold(state, *address.State) {
+				canonical := state
+				address.State = &canonical
+				break
+			}
+		}
+	}
+}
+
+// Validate checks a normalised address, an empty result means the address is fine
+func (r *Rules) Validate(address models.Address) FieldErrors {
+	problems := make(FieldErrors)
+
+	required := map[string]*string{
+		"house":   address.House,
+		"street":  address.Street,
+		"city":    address.City,
+		"pincode": address.Pincode,
+		"phone":   address.Phone,
+	}
+	for field, value := range required {
+		if value == nil || *value == "" {
+			problems[field] = field + " is required"
+		}
+	}
+
+	if address.Recipient_Name == "" {
+		problems["recipient_name"] = "recipient_name is required"
+	} else if len(address.Recipient_Name) > 100 {
+		problems["recipient_name"] = "recipient_name must be at most 100 characters"
+	}
+	if len(address.Label) > 30 {
+		problems["label"] = "label must be at most 30 characters"
+	}
+
+	for field, value := range map[string]*string{"house": address.House, "street": address.Street, "city": address.City, "state": address.State} {
+		if value != nil && len(*value) > 200 {
+			problems[field] = field + " must be at most 200 characters"
+		}
+	}
+
+	if address.Phone != nil && *address.Phone != "" && !phonePattern.MatchString(*address.Phone) {
+		problems["phone"] = "phone must have 7 to 15 digits, optionally starting with +"
+	}
+
+	country := r.country(address.Country)
+	if country == nil {
+		problems["country"] = "we do not ship to the country " + address.Country
+		return problems
+	}
+
+	if country.pattern == nil {
+		delete(problems, "pincode") // A country without postal codes
+	} else if address.Pincode != nil && *address.Pincode != "" && !country.pattern.MatchString(*address.Pincode) {
+		problems["pincode"] = "not a valid postal code of " + country.Name
+		if country.Example != "" {
+			problems["pincode"] += ", e.g. " + country.Example
+		}
+	}
+
+	state := ""
+	if address.State != nil {
+		state = *address.State
+	}
+	switch {
+	case state == "" && country.State_Required:
+		problems["state"] = "state is required in " + country.Name
+	case state != "" && len(country.States) > 0 && !contains(country.States, state):
+		problems["state"] = "not a state of " + country.Name
+	}
+
+	return problems
+}
+
+// country gives the rules of a country ; without a rules file every country is accepted with the generic checks only
+func (r *Rules) country(code string) *Country {
+	if r == nil {
+		return &Country{Name: code}
+	}
+	return r.Countries[code]
+}
+
+// collapse trims the value and turns every run of white space into one space
+func collapse(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func keep(value string) string {
+	return value
+}
+
+// titleIfOneCase gives capital initials to "NEW DELHI" or "new delhi" but leaves a mixed case value like "McLeod Ganj" alone
+func titleIfOneCase(value string) string {
+	if value != strings.ToUpper(value) && value != strings.ToLower(value) {
+		return value
+	}
+
+	words := strings.Fields(strings.ToLower(value))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// phoneDigits drops the spaces, dashes, dots and brackets people put in phone numbers
+func phoneDigits(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, value)
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// RowReader gives one row at a time so a big file is never loaded completely in the memory.
+// Next returns io.EOF at the end, a RowError when only that row is broken (the caller can continue) and any other error when the file cannot be read anymore.
+type RowReader interface {
+	Next() (Row, error)
+}
+
+func NewReader(format string, r io.Reader) (RowReader, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVReader(r)
+	case FormatJSONLines:
+		return NewJSONLinesReader(r), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+// NewCSVReader reads the header first, the columns may come in any order but product_name (or product_id), sku and price must be there
+func NewCSVReader(r io.Reader) (RowReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // Rows with a wrong number of fields are reported by us with the line number
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the csv header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"sku", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("the csv header has no %s column", required)
+		}
+	}
+
+	_, hasName := columns["product_name"]
+	_, hasId := columns["product_id"]
+	if !hasName && !hasId {
+		return nil, errors.New("the csv header needs a product_name or a product_id column")
+	}
+
+	return &csvReader{reader: reader, columns: columns, line: 1}, nil
+}
+
+func (c *csvReader) Next() (Row, error) {
+	record, err := c.reader.Read()
+	c.line++
+
+	if err == io.EOF {
+		return Row{}, io.EOF
+	}
+
+	row := Row{Line: c.line}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return row, RowError{Line: c.line, Message: parseErr.Err.Error()}
+	}
+	if err != nil {
+		return row, err
+	}
+
+	field := func(name string) string {
+		index, ok := c.columns[name]
+		if !ok || index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+
+	row.Product_ID = field("product_id")
+	row.Product_Name = field("product_name")
+	row.Brand = field("brand")
+	row.Category = field("category")
+	row.SKU = field("sku")
+	row.Image = field("image")
+	row.Price = field("price")
+	row.Currency = field("currency")
+
+	// A file without the stock or the attributes column (e.g. only new prices) leaves them alone, an empty stock cell too
+	if stock := field("stock"); stock != "" {
+		value, err := strconv.ParseInt(stock, 10, 64)
+		if err != nil {
+			return row, RowError{Line: c.line, SKU: row.SKU, Field: "stock", Message: "must be a whole number"}
+		}
+		row.Stock = &value
+	}
+
+	if _, ok := c.columns["attributes"]; ok {
+		if row.Attributes, err = ParseAttributes(field("attributes")); err != nil {
+			return row, RowError{Line: c.line, SKU: row.SKU, Field: "attributes", Message: err.Error()}
+		}
+	}
+
+	return row, nil
+}
+
+type jsonLinesReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewJSONLinesReader reads one json object per line, empty lines are skipped
+func NewJSONLinesReader(r io.Reader) RowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &jsonLinesReader{scanner: scanner}
+}
+
+func (j *jsonLinesReader) Next() (Row, error) {
+	for j.scanner.Scan() {
+		j.line++
+
+		text := strings.TrimSpace(j.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		row := Row{}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row); err != nil {
+			return Row{Line: j.line}, RowError{Line: j.line, Message: err.Error()}
+		}
+
+		row.Line = j.line
+		return row, nil
+	}
+
+	if err := j.scanner.Err(); err != nil {
+		return Row{}, err
+	}
+
+	return Row{}, io.EOF
+}
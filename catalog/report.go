@@ -0,0 +1,23 @@
+package catalog
+
+// Report is the result of one import, in dry run mode the counters tell what would have happened
+type Report struct {
+	Dry_Run          bool       `json:"dry_run"`
+	Rows             int        `json:"rows"`
+	Products_Created int        `json:"products_created"`
+	Variants_Added   int        `json:"variants_added"`
+	Variants_Updated int        `json:"variants_updated"`
+	Failed           int        `json:"failed"`
+	Errors           []RowError `json:"errors"`
+}
+
+func NewReport(dryRun bool) *Report {
+	return &Report{Dry_Run: dryRun, Errors: make([]RowError, 0)}
+}
+
+func (r *Report) AddError(err RowError) {
+	r.Failed++
+	if len(r.Errors) < MaxRowErrorCount {
+		r.Errors = append(r.Errors, err)
+	}
+}
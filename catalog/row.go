@@ -0,0 +1,123 @@
+package catalog
+
+import (
+	"ecommerce/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Supported file formats for the import and the export
+const (
+	FormatCSV        = "csv"
+	FormatJSONLines  = "jsonl"
+	MaxRowErrorCount = 1000 // After this many errors the report stops collecting them, the counters keep going
+)
+
+var ErrUnknownFormat = errors.New("format must be csv or jsonl")
+
+// Columns of the csv file, one row per variant ; rows with the same product_id (or product_name when the id is empty) belongs to the same product
+// The price is written in the major unit ("499.99") of the currency column, an empty currency means the store currency.
+// Only the store currency is taken :- the prices in other currencies are the price overrides of the variant, not its price.
+var Columns = []string{"product_id", "product_name", "brand", "category", "sku", "price", "currency", "stock", "attributes", "image"}
+
+// Row is one variant of the catalog, the same shape is used for a csv line and a json line
+type Row struct {
+	Line         int               `json:"-"`
+	Product_ID   string            `json:"product_id,omitempty"`
+	Product_Name string            `json:"product_name"`
+	Brand        string            `json:"brand,omitempty"`
+	Category     string            `json:"category,omitempty"`
+	SKU          string            `json:"sku"`
+	Price        string            `json:"price"`
+	Currency     string            `json:"currency,omitempty"`
+	Stock        *int64            `json:"stock,omitempty"`      // nil when the file has no stock, an update keeps the stock of the variant
+	Attributes   map[string]string `json:"attributes,omitempty"` // nil when the file has no attributes, an update keeps them too
+	Image        string            `json:"image,omitempty"`
+}
+
+// RowError tells which line of the file is wrong and why, so the admin can fix the file and upload again
+type RowError struct {
+	Line    int    `json:"line"`
+	SKU     string `json:"sku,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Validate checks the row on its own, without looking at the database
+func (r Row) Validate() []RowError {
+	var errs []RowError
+
+	fail := func(field, message string) {
+		errs = append(errs, RowError{Line: r.Line, SKU: r.SKU, Field: field, Message: message})
+	}
+
+	if strings.TrimSpace(r.Product_Name) == "" && r.Product_ID == "" {
+		fail("product_name", "is required")
+	}
+	if strings.TrimSpace(r.SKU) == "" {
+		fail("sku", "is required")
+	}
+	if price, err := r.Money(); err != nil {
+		fail("price", "must be an amount like 499.99 with at most the digits of the currency")
+	} else if !price.In(models.DefaultCurrency()) {
+		fail("currency", "must be the store currency "+models.DefaultCurrency())
+	} else if price.Amount <= 0 {
+		fail("price", "must be greater than zero")
+	}
+	if r.Stock != nil && *r.Stock < 0 {
+		fail("stock", "cannot be negative")
+	}
+
+	return errs
+}
+
+// Money reads the price column in the row currency
+func (r Row) Money() (models.Money, error) {
+	return models.ParseMoney(r.Price, r.Currency)
+}
+
+// "colour=red;size=M" -->> {"colour": "red", "size": "M"}
+func ParseAttributes(value string) (map[string]string, error) {
+	attributes := make(map[string]string)
+
+	for _, pair := range strings.Split(value, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		name, attributeValue, found := strings.Cut(pair, "=")
+		name, attributeValue = strings.TrimSpace(name), strings.TrimSpace(attributeValue)
+		if !found || name == "" {
+			return nil, fmt.Errorf("%q is not in name=value form", pair)
+		}
+
+		attributes[name] = attributeValue
+	}
+
+	return attributes, nil
+}
+
+// {"size": "M", "colour": "red"} -->> "colour=red;size=M" ; sorted so that an export is always the same for the same catalog
+func FormatAttributes(attributes map[string]string) string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+attributes[name])
+	}
+
+	return strings.Join(pairs, ";")
+}
@@ -0,0 +1,84 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// RowWriter writes the export one row at a time, Flush pushes the buffered rows to the underlying writer (e.g. the http response)
+type RowWriter interface {
+	Write(row Row) error
+	Flush() error
+}
+
+func NewWriter(format string, w io.Writer) (RowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case FormatJSONLines:
+		return &jsonLinesWriter{encoder: json.NewEncoder(w)}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+type csvWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (c *csvWriter) Write(row Row) error {
+	if !c.headerWritten {
+		if err := c.writer.Write(Columns); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	return c.writer.Write([]string{
+		row.Product_ID,
+		row.Product_Name,
+		row.Brand,
+		row.Category,
+		row.SKU,
+		row.Price,
+		row.Currency,
+		formatStock(row.Stock),
+		FormatAttributes(row.Attributes),
+		row.Image,
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	// An empty catalog still gets the header, so the file can be used as a template
+	if !c.headerWritten {
+		if err := c.writer.Write(Columns); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// The json encoder writes straight to w, every Write is one line
+type jsonLinesWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonLinesWriter) Write(row Row) error {
+	return j.encoder.Encode(row)
+}
+
+func (j *jsonLinesWriter) Flush() error {
+	return nil
+}
+
+func formatStock(stock *int64) string {
+	if stock == nil {
+		return ""
+	}
+	return strconv.FormatInt(*stock, 10)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"ecommerce/catalog"
+	"ecommerce/controllers"
+	"ecommerce/database"
+	"ecommerce/models"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const cliUsage = `Usage:
+  ecommerce                                              start the http server
+  ecommerce import [-format csv|jsonl] [-dry-run] <file>  import products, "-" reads from stdin
+  ecommerce export [-format csv|jsonl] [-o <file>]        export the catalog, stdout by default
+  ecommerce migrate-money                                 convert the old numeric prices into money documents
+  ecommerce migrate-coupons                               move the uses per customer out of the coupons into CouponRedemptions
+  ecommerce admin [-revoke] <email>                       give the account the admin role, or take it away`
+
+// runCommand runs the sub command and returns the exit code of the process
+func runCommand(args []string) int {
+	switch args[0] {
+	case "import":
+		return importCommand(args[1:])
+	case "export":
+		return exportCommand(args[1:])
+	case "migrate-money":
+		return migrateMoneyCommand()
+	case "migrate-coupons":
+		return migrateCouponsCommand()
+	case "admin":
+		return adminCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(cliUsage)
+		return 0
+	}
+
+	fmt.Fprintln(os.Stderr, "unknown command "+args[0])
+	fmt.Fprintln(os.Stderr, cliUsage)
+	return 2
+}
+
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "csv or jsonl, by default taken from the file extension")
+	dryRun := flags.Bool("dry-run", false, "validate and report without saving anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, cliUsage)
+		return 2
+	}
+
+	path := flags.Arg(0)
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+
+		if *format == "" {
+			*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		}
+	}
+
+	reader, err := catalog.NewReader(*format, input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	report, err := database.ImportProducts(ctx, database.ProductData(database.Client, "Products"), reader, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(report)
+
+	// Tell the wishlists about the new prices and stock before the process ends
+	if !*dryRun && report != nil {
+		if notifyErr := controllers.NotifyWishlists(ctx, nil); notifyErr != nil {
+			fmt.Fprintln(os.Stderr, "Error while checking the wishlists :- ", notifyErr)
+		}
+	}
+
+	if err != nil || report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", catalog.FormatCSV, "csv or jsonl")
+	output := flags.String("o", "", "output file, stdout by default")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	writer, err := catalog.NewWriter(*format, out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	if err := database.ExportProducts(ctx, database.ProductData(database.Client, "Products"), writer); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func migrateMoneyCommand() int {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	report, err := database.MigrateMoney(ctx, database.ProductData(database.Client, "Products"), database.UserData(database.Client, "Users"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("Converted %d products and %d users\n", report.Products, report.Users)
+	return 0
+}
+
+func migrateCouponsCommand() int {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	moved, err := database.MigrateCouponRedemptions(ctx, database.CouponData(database.Client, "Coupons"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("Moved %d coupon uses of customers\n", moved)
+	return 0
+}
+
+func adminCommand(args []string) int {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	revoke := flags.Bool("revoke", false, "take the admin role away")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, cliUsage)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	role := models.RoleAdmin
+	if *revoke {
+		role = ""
+	}
+
+	if err := database.SetUserRole(ctx, database.UserData(database.Client, "Users"), flags.Arg(0), role); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *revoke {
+		fmt.Println(flags.Arg(0) + " is a customer again")
+	} else {
+		fmt.Println(flags.Arg(0) + " is an admin now")
+	}
+	return 0
+}
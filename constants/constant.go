@@ -8,11 +8,61 @@ import (
 )
 
 var (
-	PORT             string
-	MONGO_URI        string
-	SECRET_KEY       string
-	ISSUED_BY        string
-	EXPIRATION_HOURS string
+	PORT                string
+	MONGO_URI           string
+	SECRET_KEY          string
+	ISSUED_BY           string
+	EXPIRATION_HOURS    string
+	STORAGE_DIR         string
+	MAX_UPLOAD_MB       string
+	DEFAULT_CURRENCY    string
+	EXCHANGE_RATES_FILE string
+	TAX_RULES_FILE      string
+	TAX_PROVIDER_URL    string
+	TAX_PROVIDER_TOKEN  string
+	SHIPPING_FILE       string
+
+	PAYMENT_PROVIDER       string
+	PAYMENT_WEBHOOK_SECRET string
+	PAYMENT_AUTO_CAPTURE   string
+	PAYMENT_EXPIRY_MINUTES string
+
+	RETURN_WINDOW_DAYS string
+
+	IDEMPOTENCY_WINDOW_HOURS string
+
+	MAX_ADDRESSES     string
+	DEFAULT_COUNTRY   string
+	POSTAL_CODES_FILE string
+
+	GUEST_CART_TTL_DAYS string
+
+	MAX_WISHLISTS string
+	NOTIFIER      string
+	NOTIFY_FILE   string
+
+	ABANDONED_CART_HOURS         string
+	ABANDONED_CART_CHECK_MINUTES string
+
+	JOB_CONCURRENCY  string
+	JOB_MAX_ATTEMPTS string
+
+	NOTIFY_CHANNELS      string
+	NOTIFY_TEMPLATES_DIR string
+	NOTIFY_MESSAGES_FILE string
+	DEFAULT_LOCALE       string
+	SMTP_ADDR            string
+	SMTP_FROM            string
+	SMTP_USERNAME        string
+	SMTP_PASSWORD        string
+
+	EVENT_SINKS          string
+	EVENT_WEBHOOK_URL    string
+	EVENT_WEBHOOK_SECRET string
+	EVENT_SUBJECT_PREFIX string
+	EVENT_MAX_ATTEMPTS   string
+	EVENT_POLL_SECONDS   string
+	OUTBOX_STANDALONE    string
 )
 
 // Initialize the environment variables once
@@ -29,4 +79,89 @@ func LoadENV() {
 	SECRET_KEY = os.Getenv("SECRET_KEY")
 	ISSUED_BY = os.Getenv("ISSUED_BY")
 	EXPIRATION_HOURS = os.Getenv("EXPIRATION_HOURS")
+
+	// Where the uploaded product images are kept and how big one upload may be
+	STORAGE_DIR = getEnvOrDefault("STORAGE_DIR", "uploads")
+	MAX_UPLOAD_MB = getEnvOrDefault("MAX_UPLOAD_MB", "5")
+
+	// ISO 4217 code of the currency every price of the catalog is stored in
+	DEFAULT_CURRENCY = getEnvOrDefault("DEFAULT_CURRENCY", "INR")
+	// Local json file with the exchange rates from the store currency, the admin can update it through the api
+	EXCHANGE_RATES_FILE = getEnvOrDefault("EXCHANGE_RATES_FILE", "data/exchange_rates.json")
+
+	// Tax rules by region and tax class ; when TAX_PROVIDER_URL is set the external provider is asked instead of the rules file
+	TAX_RULES_FILE = getEnvOrDefault("TAX_RULES_FILE", "data/tax_rules.json")
+	TAX_PROVIDER_URL = os.Getenv("TAX_PROVIDER_URL")
+	TAX_PROVIDER_TOKEN = os.Getenv("TAX_PROVIDER_TOKEN")
+
+	// Delivery methods, destination zones and their rate tables
+	SHIPPING_FILE = getEnvOrDefault("SHIPPING_FILE", "data/shipping.json")
+
+	// Gateway of the digital payments and the secret its webhooks are signed with ; empty turns the digital payments off.
+	// "mock" charges nothing and lets anybody pay their own orders, it is only for local development.
+	PAYMENT_PROVIDER = os.Getenv("PAYMENT_PROVIDER")
+	PAYMENT_WEBHOOK_SECRET = os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	// "true" captures a payment as soon as the gateway authorizes it
+	PAYMENT_AUTO_CAPTURE = getEnvOrDefault("PAYMENT_AUTO_CAPTURE", "true")
+	// A digital order which is still not paid after this many minutes is cancelled, its stock and coupon are given back
+	PAYMENT_EXPIRY_MINUTES = getEnvOrDefault("PAYMENT_EXPIRY_MINUTES", "60")
+
+	// How many days after the order the customer can still ask for a return
+	RETURN_WINDOW_DAYS = getEnvOrDefault("RETURN_WINDOW_DAYS", "30")
+
+	// How long the response to an Idempotency-Key is kept and replayed
+	IDEMPOTENCY_WINDOW_HOURS = getEnvOrDefault("IDEMPOTENCY_WINDOW_HOURS", "24")
+
+	// How many addresses one user can keep in the address book
+	MAX_ADDRESSES = getEnvOrDefault("MAX_ADDRESSES", "10")
+	// Country of the addresses which do not name one, and the postal code and state rules of every country the store ships to
+	DEFAULT_COUNTRY = getEnvOrDefault("DEFAULT_COUNTRY", "IN")
+	POSTAL_CODES_FILE = getEnvOrDefault("POSTAL_CODES_FILE", "data/postal_codes.json")
+
+	// A guest cart nobody touched for this many days is deleted
+	GUEST_CART_TTL_DAYS = getEnvOrDefault("GUEST_CART_TTL_DAYS", "30")
+
+	// How many wishlists one user can make
+	MAX_WISHLISTS = getEnvOrDefault("MAX_WISHLISTS", "20")
+	// Where the notifications to the users go, "log" only writes them to the log and "file" appends them to NOTIFY_FILE
+	NOTIFIER = getEnvOrDefault("NOTIFIER", "log")
+	// File of the "file" notifier, one json line per notification
+	NOTIFY_FILE = getEnvOrDefault("NOTIFY_FILE", "data/notifications.jsonl")
+
+	// A cart nobody changed for this many hours gets a reminder, the carts are checked every ABANDONED_CART_CHECK_MINUTES
+	ABANDONED_CART_HOURS = getEnvOrDefault("ABANDONED_CART_HOURS", "24")
+	ABANDONED_CART_CHECK_MINUTES = getEnvOrDefault("ABANDONED_CART_CHECK_MINUTES", "15")
+
+	// How many background jobs run at once, and how often a failing job is tried before it goes to the dead letter collection
+	JOB_CONCURRENCY = getEnvOrDefault("JOB_CONCURRENCY", "4")
+	JOB_MAX_ATTEMPTS = getEnvOrDefault("JOB_MAX_ATTEMPTS", "5")
+
+	// Channels of the emails and sms to the customers ("email", "sms", "file"), their templates per locale and the locale of a user without one
+	NOTIFY_CHANNELS = getEnvOrDefault("NOTIFY_CHANNELS", "file")
+	NOTIFY_TEMPLATES_DIR = getEnvOrDefault("NOTIFY_TEMPLATES_DIR", "data/templates")
+	NOTIFY_MESSAGES_FILE = getEnvOrDefault("NOTIFY_MESSAGES_FILE", "data/messages.jsonl")
+	DEFAULT_LOCALE = getEnvOrDefault("DEFAULT_LOCALE", "en")
+	// SMTP server of the "email" channel, the mailhog of docker-compose by default
+	SMTP_ADDR = getEnvOrDefault("SMTP_ADDR", "localhost:1025")
+	SMTP_FROM = getEnvOrDefault("SMTP_FROM", "Shop <no-reply@shop.local>")
+	SMTP_USERNAME = os.Getenv("SMTP_USERNAME")
+	SMTP_PASSWORD = os.Getenv("SMTP_PASSWORD")
+
+	// Where the domain events of the outbox are published ("bus", "webhook", "nats"), the outbox is checked every EVENT_POLL_SECONDS
+	EVENT_SINKS = getEnvOrDefault("EVENT_SINKS", "bus")
+	EVENT_WEBHOOK_URL = os.Getenv("EVENT_WEBHOOK_URL")
+	EVENT_WEBHOOK_SECRET = os.Getenv("EVENT_WEBHOOK_SECRET")
+	EVENT_SUBJECT_PREFIX = getEnvOrDefault("EVENT_SUBJECT_PREFIX", "ecommerce")
+	EVENT_MAX_ATTEMPTS = getEnvOrDefault("EVENT_MAX_ATTEMPTS", "10")
+	EVENT_POLL_SECONDS = getEnvOrDefault("EVENT_POLL_SECONDS", "2")
+	// The events are saved in the transaction of their change, so MongoDB must be a replica set. "true" accepts a standalone
+	// server anyway (local development) :- the events are saved right after their change and one which can't be saved is lost.
+	OUTBOX_STANDALONE = getEnvOrDefault("OUTBOX_STANDALONE", "false")
+}
+
+func getEnvOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
 }
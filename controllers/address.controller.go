@@ -2,264 +2,217 @@ package controllers
 
 import (
 	"context"
+	"ecommerce/address"
+	"ecommerce/constants"
+	"ecommerce/database"
 	"ecommerce/models"
 	"ecommerce/utils"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func AddAddress() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		if c.Request.Method != "POST" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request method"})
-			return
-		}
+var AddressRules *address.Rules = loadAddressRules()
 
-		user_id := c.Query("userId")
-		if user_id == "" {
-			c.Header("Content-Type", "application/json")
-			c.Abort()
-			utils.ResponseHandler(c, http.StatusNotFound, false, "Invalid Code", nil)
-		}
-
-		// Convert the string id into primitive object id
-		userId, err := primitive.ObjectIDFromHex(user_id)
-		if err != nil {
-			log.Println(err)
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Internal Server Error")
-			return
-		}
+func loadAddressRules() *address.Rules {
+	rules, err := address.Load(constants.POSTAL_CODES_FILE)
+	if err != nil {
+		log.Println("Error loading the postal code rules, the addresses get the generic checks only :- ", err)
+		return nil
+	}
+	return rules
+}
 
-		var addresses models.Address
+// The address book belongs to the logged in user, the user id always comes from the token
 
-		addresses.Address_ID = primitive.NewObjectID()
-		if err = c.BindJSON(&addresses); err != nil {
-			c.JSON(http.StatusNotAcceptable, err.Error())
+// ListAddresses :- GET /addresses
+func ListAddresses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
 			return
 		}
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		// Role Of Path :=
-		// . It tells MongoDB which array field to unwind (i.e., break apart).
-		// . The path is specified as a field name and must be prefixed with $ to denote the field within the document.
-
-		match_filter_stage := bson.D{{Key: "$match", Value: bson.D{{Key: "_id", Value: userId}}}}
-		unwind_stage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$address"}}}}
-		// The documents will be grouped based on the address_id field.
-		// For each group of documents that share the same address_id, the count field will be calculated as the sum of 1s for each document in the group.
-		grouping_stage := bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$address_id"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}}
-
-		cursor, err := UserCollection.Aggregate(ctx, mongo.Pipeline{match_filter_stage, unwind_stage, grouping_stage})
+		addresses, err := database.ListAddresses(ctx, UserCollection, c.GetString("uid"))
 		if err != nil {
-			log.Println(err)
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Internal Server Error")
+			utils.ErrorHandler(c, addressErrorStatus(err), false, err.Error())
 			return
 		}
 
-		var addressInfo []bson.M
-
-		for cursor.Next(ctx) {
-			var address bson.M
-			if err := cursor.Decode(&address); err != nil {
-				log.Println("Error while doing aggregation in AddAddress function ", err)
-				log.Panic(err)
-			}
+		c.JSON(http.StatusOK, gin.H{"success": true, "addresses": addresses})
+		ctx.Done()
+	}
+}
 
-			addressInfo = append(addressInfo, address)
+// AddAddress :- POST /addresses ; "default_shipping" / "default_billing" make it the default, the first address is the default anyway
+func AddAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
 		}
 
-		if err = cursor.Err(); err != nil {
-			log.Println(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			panic(err)
+		var newAddress models.Address
+		if err := c.BindJSON(&newAddress); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
 		}
 
-		defer cursor.Close(ctx)
-
-		var size int32
-		for _, addressNo := range addressInfo {
-			count := addressNo["count"] // The type of count is interface{} because Go maps with interface{} values can store values of any type.
-			// If count is not of type int32, the type assertion count.(int32) will cause a runtime panic.
-			size = count.(int32) //The syntax count.(int32) asserts that the underlying type of count is int32.
+		if !checkAddress(c, &newAddress) {
+			return
 		}
 
-		// If User Addresses is less than 2
-		if size < 2 {
-			filter := bson.D{{Key: "_id", Value: userId}}
-			update := bson.D{{Key: "$push", Value: bson.D{{Key: "address", Value: addresses}}}}
+		maxAddresses, err := strconv.Atoi(constants.MAX_ADDRESSES)
+		if err != nil || maxAddresses <= 0 {
+			maxAddresses = 10
+		}
 
-			_, err := UserCollection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				log.Println(err)
-				utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong")
-				return
-			}
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		} else {
-			utils.ResponseHandler(c, http.StatusBadRequest, false, "Not Allowed", nil)
+		saved, err := database.AddAddress(ctx, UserCollection, c.GetString("uid"), newAddress, maxAddresses)
+		if err != nil {
+			utils.ErrorHandler(c, addressErrorStatus(err), false, err.Error())
+			return
 		}
 
+		utils.ResponseHandler(c, http.StatusCreated, true, "Address added", saved)
 		ctx.Done()
 	}
 }
 
-// Users have two addresses ; Home Address at index 0 and Work Address at index 1
-
-func EditHomeAddress() gin.HandlerFunc {
+// GetAddress :- GET /addresses/:addressId
+func GetAddress() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if c.Request.Method != "PUT" {
-			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request Method is Invalid"})
-			return
-		}
-
-		user_id := c.Query("userId")
-		if user_id == "" {
-			c.Header("Content-Type", "application/json")
-			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Request"})
-			c.Abort()
-			return
-		}
-
-		// Convert the string ID into primitive object_id
-		userId, err := primitive.ObjectIDFromHex(user_id)
-		if err != nil {
-			log.Println(err)
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Internal Server Error")
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
 			return
 		}
 
-		var editAddress models.Address
-		editAddress.Address_ID = primitive.NewObjectID()
-		if err = c.BindJSON(&editAddress); err != nil {
-			c.JSON(http.StatusBadRequest, err.Error())
+		addressId, ok := addressParam(c)
+		if !ok {
 			return
 		}
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$eq", Value: userId}}}}
-		update := bson.D{{Key: "$set", Value: bson.D{
-			{Key: "address.0.house", Value: editAddress.House},
-			{Key: "address.0.street", Value: editAddress.Street},
-			{Key: "address.0.city", Value: editAddress.City},
-			{Key: "address.0.pincode", Value: editAddress.Pincode},
-		},
-		}}
-
-		_, err = UserCollection.UpdateOne(ctx, filter, update)
+		saved, err := database.FindAddress(ctx, UserCollection, c.GetString("uid"), addressId)
 		if err != nil {
-			log.Println(err)
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong")
+			utils.ErrorHandler(c, addressErrorStatus(err), false, err.Error())
 			return
 		}
 
+		utils.ResponseHandler(c, http.StatusOK, true, "", saved)
 		ctx.Done()
-		utils.ResponseHandler(c, http.StatusOK, true, "Successfully updated the home address", nil)
-
 	}
 }
 
-func EditWorkAddress() gin.HandlerFunc {
+// UpdateAddress :- PUT /addresses/:addressId with the whole address
+func UpdateAddress() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.Request.Method != "PUT" {
-			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request Method is Invalid"})
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
 			return
 		}
 
-		user_id := c.Query("userId")
-		if user_id == "" {
-			c.Header("Content-Type", "application/json")
-			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Request"})
-			c.Abort()
+		addressId, ok := addressParam(c)
+		if !ok {
 			return
 		}
 
-		// Convert the string ID into primitive object_id
-		userId, err := primitive.ObjectIDFromHex(user_id)
-		if err != nil {
-			log.Println(err)
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Internal Server Error")
+		var newAddress models.Address
+		if err := c.BindJSON(&newAddress); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
 			return
 		}
 
-		var editAddress models.Address
-		editAddress.Address_ID = primitive.NewObjectID()
-		if err = c.BindJSON(&editAddress); err != nil {
-			c.JSON(http.StatusBadRequest, err.Error())
+		if !checkAddress(c, &newAddress) {
+			return
 		}
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$eq", Value: userId}}}}
-
-		update := bson.D{{Key: "$set", Value: bson.D{
-			{Key: "address.1.house", Value: editAddress.House},
-			{Key: "address.1.street", Value: editAddress.Street},
-			{Key: "address.1.city", Value: editAddress.City},
-			{Key: "address.1.pincode", Value: editAddress.Pincode},
-		},
-		}}
-
-		_, err = UserCollection.UpdateOne(ctx, filter, update)
+		saved, err := database.UpdateAddress(ctx, UserCollection, c.GetString("uid"), addressId, newAddress)
 		if err != nil {
-			log.Println(err)
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong")
+			utils.ErrorHandler(c, addressErrorStatus(err), false, err.Error())
 			return
 		}
 
+		utils.ResponseHandler(c, http.StatusOK, true, "Address updated", saved)
 		ctx.Done()
-		utils.ResponseHandler(c, http.StatusOK, true, "Successfully updated the work address", nil)
-
 	}
 }
 
+// DeleteAddress :- DELETE /addresses/:addressId
 func DeleteAddress() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if c.Request.Method != "GET" {
-			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is Invalid"})
-		}
-
-		user_id := c.Query("userId")
-		if user_id == "" {
-			c.Header("Content-Type", "application/json")
-			c.JSON(http.StatusNotFound, gin.H{"Error": "Search Index is Invalid"})
-			c.Abort()
+		if c.Request.Method != "DELETE" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
 			return
 		}
 
-		addresses := make([]models.Address, 0)
-		// Convert the string ID into primitive Object ID
-		userId, err := primitive.ObjectIDFromHex(user_id)
-		if err != nil {
-			log.Println(err)
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Internal Server Error")
+		addressId, ok := addressParam(c)
+		if !ok {
 			return
 		}
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$eq", Value: userId}}}}
-		update := bson.D{{Key: "$set", Value: bson.D{{Key: "address", Value: addresses}}}}
-
-		_, err = UserCollection.UpdateOne(ctx, filter, update)
-		if err != nil {
-			log.Println(err)
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong. Please Try Again !")
+		if err := database.DeleteAddress(ctx, UserCollection, c.GetString("uid"), addressId); err != nil {
+			utils.ErrorHandler(c, addressErrorStatus(err), false, err.Error())
 			return
 		}
 
-		utils.ResponseHandler(c, http.StatusOK, true, "Successfully Deleted", nil)
+		utils.ResponseHandler(c, http.StatusOK, true, "Address deleted", nil)
 		ctx.Done()
 	}
 }
+
+// checkAddress normalises the address and answers 422 with a message per field when it is not valid
+func checkAddress(c *gin.Context, newAddress *models.Address) bool {
+	AddressRules.Normalize(newAddress, constants.DEFAULT_COUNTRY)
+
+	if problems := AddressRules.Validate(*newAddress); len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"message": "The address is not valid",
+			"errors":  problems,
+		})
+		return false
+	}
+
+	return true
+}
+
+func addressParam(c *gin.Context) (primitive.ObjectID, bool) {
+	addressId, err := primitive.ObjectIDFromHex(c.Param("addressId"))
+	if err != nil {
+		log.Println(err)
+		utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid address id !")
+		return primitive.NilObjectID, false
+	}
+	return addressId, true
+}
+
+func addressErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrCantFindAddress):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrTooManyAddresses):
+		return http.StatusConflict
+	case errors.Is(err, database.ErrUserIdIsNotValid):
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
@@ -122,13 +122,31 @@ func SignUp() gin.HandlerFunc {
 		user.Address_Details = make([]models.Address, 0)
 		user.Order_Status = make([]models.Order, 0)
 
-		_, insertErr := UserCollection.InsertOne(ctx, user)
+		// Only the server sets these, a new account never starts with a coupon or as a guest
+		user.Cart_Coupon = nil
+		user.Cart_Updated_At = nil
+		user.Guest = false
+		user.Guest_Email = nil
+		user.Guest_Expires_At = nil
+
+		// The emails are written in the language of the browser when the sign up does not name one
+		if user.Locale == nil {
+			if locale := requestLocale(c); locale != "" {
+				user.Locale = &locale
+			}
+		}
+
+		insertErr := database.CreateUser(ctx, UserCollection, user)
 		if insertErr != nil {
-			log.Println(insertErr)
 			utils.ErrorHandler(c, http.StatusInternalServerError, false, insertErr.Error())
 			return
 		}
 
+		// A guest who signs up keeps the cart and the orders of the cart token
+		attachGuestCart(ctx, c, *user.User_ID)
+
+		notifyUser(ctx, models.UserRegistered, *user.User_ID, nil)
+
 		utils.ResponseHandler(c, http.StatusCreated, true, "Successfully Signed Up !", nil)
 		ctx.Done()
 	}
@@ -175,6 +193,8 @@ func Login() gin.HandlerFunc {
 
 		config.JwtWrapper.UpdateAllTokens(token, refreshToken, *foundUser.User_ID)
 
+		attachGuestCart(ctx, c, *foundUser.User_ID)
+
 		utils.ResponseHandler(c, http.StatusFound, true, "Login Successfully !", foundUser)
 		ctx.Done()
 	}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -55,12 +56,8 @@ func (app *Application) AddToCart() gin.HandlerFunc {
 			return
 		}
 
-		userQueryId := c.Query("userId") // /route/2/:id  => 1, 2, 3
-		if userQueryId == "" {
-			log.Println("User id is empty")
-			_ = c.AbortWithError(http.StatusBadRequest, errors.New("user id is empty"))
-			return
-		}
+		// The cart is always the one of the logged in user, the id comes from the token and never from the request
+		userQueryId := c.GetString("uid")
 
 		// We are converting the id string into ObjectID primitive form
 		productId, err := primitive.ObjectIDFromHex(productQueryId)
@@ -70,10 +67,32 @@ func (app *Application) AddToCart() gin.HandlerFunc {
 			return
 		}
 
+		// Which size / colour of the product the user is adding
+		variantId, err := primitive.ObjectIDFromHex(c.Query("variantId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "variant id is invalid")
+			return
+		}
+
+		// ?quantity=2 is optional, by default one piece is added
+		quantity := 1
+		if quantityQuery := c.Query("quantity"); quantityQuery != "" {
+			quantity, err = strconv.Atoi(quantityQuery)
+			if err != nil || quantity < 1 {
+				utils.ErrorHandler(c, http.StatusBadRequest, false, "quantity must be a positive number")
+				return
+			}
+		}
+
 		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		err = database.AddProductToCart(ctx, app.prodCollection, app.userCollection, productId, userQueryId)
+		err = database.AddProductToCart(ctx, app.prodCollection, app.userCollection, productId, variantId, quantity, userQueryId)
+		if errors.Is(err, database.ErrCantFindVariant) || errors.Is(err, database.ErrNotEnoughStock) {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
 		if err != nil {
 			log.Println(err)
 			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
@@ -93,21 +112,16 @@ func (app *Application) RemoveItemFromCart() gin.HandlerFunc {
 			return
 		}
 
-		productQueryId := c.Query("productId")
-		if productQueryId == "" {
-			log.Println("Product id is empty")
-			_ = c.AbortWithError(http.StatusBadRequest, errors.New("product id is empty"))
+		variantQueryId := c.Query("variantId")
+		if variantQueryId == "" {
+			log.Println("Variant id is empty")
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("variant id is empty"))
 			return
 		}
 
-		userQueryID := c.Query("userId")
-		if userQueryID == "" {
-			log.Println("User id is empty")
-			_ = c.AbortWithError(http.StatusBadRequest, errors.New("user id is empty"))
-			return
-		}
+		userQueryID := c.GetString("uid")
 
-		productId, err := primitive.ObjectIDFromHex(productQueryId)
+		variantId, err := primitive.ObjectIDFromHex(variantQueryId)
 		if err != nil {
 			log.Println(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
@@ -117,7 +131,7 @@ func (app *Application) RemoveItemFromCart() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		err = database.RemoveCartItem(ctx, app.prodCollection, app.userCollection, productId, userQueryID)
+		err = database.RemoveCartItem(ctx, app.prodCollection, app.userCollection, variantId, userQueryID)
 		if err != nil {
 			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
 			return
@@ -136,23 +150,21 @@ func GetItemFromCart() gin.HandlerFunc {
 			return
 		}
 
-		user_id := c.Query("userId")
-		if user_id == "" {
-			c.Header("Content-Type", "application/json")
-			c.JSON(http.StatusNotFound, "Invalid id")
-			c.Abort()
-			return
-		}
+		user_id := c.GetString("uid")
 
 		// Convert the string id into primitive object id
-		userId, _ := primitive.ObjectIDFromHex(user_id)
+		userId, err := primitive.ObjectIDFromHex(user_id)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusUnauthorized, false, "invalid user")
+			return
+		}
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
 		var filledCart models.User
 
 		find := bson.D{{Key: "_id", Value: userId}}
-		err := UserCollection.FindOne(ctx, find).Decode(&filledCart)
+		err = UserCollection.FindOne(ctx, find).Decode(&filledCart)
 
 		if err != nil {
 			log.Println("Error decoding user_cart:", err)
@@ -160,49 +172,91 @@ func GetItemFromCart() gin.HandlerFunc {
 			return
 		}
 
-		filter_match_stage := bson.D{{Key: "$match", Value: bson.D{{Key: "_id", Value: userId}}}}
-		unwind_stage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$user_cart"}}}}
-		// The aggregation pipeline uses the $group stage to group the documents by the _id field,
-		grouping_stage := bson.D{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: "$_id"},
-			{Key: "total", Value: bson.D{
-				{Key: "$sum", Value: "$user_cart.price"},
-			}},
-		},
-		}}
-
-		cursor, err := UserCollection.Aggregate(ctx, mongo.Pipeline{filter_match_stage, unwind_stage, grouping_stage})
-		if err != nil {
-			log.Println(err)
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong !")
+		response, ok := pricedCart(ctx, c, user_id, filledCart)
+		if !ok {
 			return
 		}
 
-		var listing []bson.M
+		utils.ResponseHandler(c, http.StatusOK, true, "", response)
 
-		for cursor.Next(ctx) {
-			var listItem bson.M
-			if err := cursor.Decode(&listItem); err != nil {
-				log.Println("Error while doing aggregation in GetItemFromCart function ", err)
-				log.Panic(err)
-			}
+		ctx.Done()
+	}
+}
 
-			listing = append(listing, listItem)
-		}
+// pricedCart is the cart with its promotions, coupon and totals in the currency of the request ; on an error the response is already written
+func pricedCart(ctx context.Context, c *gin.Context, userQueryID string, filledCart models.User) (gin.H, bool) {
+	// The promotions and the applied coupon are priced with the current cart ; a coupon which stopped working is left out and the reason is shown
+	quote, _, err := database.PriceCart(ctx, ProdCollection, CouponCollection, PromotionCollection, userQueryID, filledCart.User_Cart, filledCart.Cart_Coupon)
+	if err != nil {
+		log.Println(err)
+		utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong !")
+		return nil, false
+	}
 
-		if err = cursor.Err(); err != nil {
-			log.Println(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			log.Fatal()
+	// Prices are shown in the currency of the request, the same way the checkout will charge them
+	cart, quote, err := localizeCart(filledCart.User_Cart, quote, requestCurrency(c))
+	if err != nil {
+		utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+		return nil, false
+	}
+
+	// The cart is shown at the prices the customer saw, next to what changed in the catalog since then
+	changes, err := database.ReviewCart(ctx, ProdCollection, filledCart.User_Cart)
+	if err != nil {
+		utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+		return nil, false
+	}
+
+	changes, err = localizeCartChanges(changes, requestCurrency(c))
+	if err != nil {
+		utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+		return nil, false
+	}
+
+	response := gin.H{
+		"changes":               changes,
+		"needs_acknowledgement": len(changes) > 0, // The checkout is refused until POST /cart/acknowledge
+		"cart":                  cart,
+		"subtotal":              quote.Subtotal,
+		"adjustments":           quote.Adjustments,
+		"discount":              quote.Discount,
+		"total":                 quote.Total,
+		"free_shipping":         quote.Free_Shipping,
+	}
+	if quote.Coupon != nil {
+		response["coupon"] = quote.Coupon
+	}
+	if quote.Coupon_Error != "" {
+		response["coupon_error"] = quote.Coupon_Error
+	}
+
+	return response, true
+}
+
+// AcknowledgeCart :- POST /cart/acknowledge takes the catalog changes of the cart (new prices, removed or reduced lines) so the checkout can go on
+func AcknowledgeCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
 		}
 
-		defer cursor.Close(ctx)
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		for _, json := range listing {
-			utils.ResponseHandler(c, http.StatusOK, true, "", json["total"])
-			utils.ResponseHandler(c, http.StatusOK, true, "", filledCart.User_Cart)
+		changes, err := database.AcknowledgeCartChanges(ctx, ProdCollection, UserCollection, c.GetString("uid"))
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		changes, err = localizeCartChanges(changes, requestCurrency(c))
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
 		}
 
+		utils.ResponseHandler(c, http.StatusOK, true, "The cart is up to date with the catalog", gin.H{"changes": changes})
 		ctx.Done()
 	}
 }
@@ -210,33 +264,42 @@ func GetItemFromCart() gin.HandlerFunc {
 func (app *Application) BuyFromCart() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		if c.Request.Method != "GET" {
+		if c.Request.Method != "POST" {
 			c.JSON(http.StatusMethodNotAllowed, "Request method is invalid")
 			return
 		}
 
-		userQueryId := c.Query("userId")
-		if userQueryId == "" {
-			log.Panicln("User id is empty")
-			_ = c.AbortWithError(http.StatusBadRequest, errors.New("user id is empty"))
+		userQueryId := c.GetString("uid")
+
+		checkout, err := checkoutOptions(c)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
 		}
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		err := database.BuyItemFromCart(ctx, app.userCollection, userQueryId)
+		order, intent, err := database.BuyItemFromCart(ctx, app.prodCollection, app.userCollection, CouponCollection, PromotionCollection, userQueryId, checkout)
 		if err != nil {
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			checkoutError(c, err)
 			return
 		}
 
-		utils.ResponseHandler(c, http.StatusCreated, true, "Successfully placed the order", nil)
+		notifyOrder(ctx, models.OrderConfirmed, userQueryId, order)
+
+		utils.ResponseHandler(c, http.StatusCreated, true, "Successfully placed the order", checkoutResponse(order, intent))
 		ctx.Done()
 	}
 }
 
 func (app *Application) InstantBuy() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, "Request method is invalid")
+			return
+		}
+
 		productQueryId := c.Query("productId")
 		if productQueryId == "" {
 			log.Println("Product id is empty")
@@ -244,12 +307,7 @@ func (app *Application) InstantBuy() gin.HandlerFunc {
 			return
 		}
 
-		userQueryID := c.Query("userId")
-		if userQueryID == "" {
-			log.Println("User id is empty")
-			_ = c.AbortWithError(http.StatusBadRequest, errors.New("user id is empty"))
-			return
-		}
+		userQueryID := c.GetString("uid")
 
 		productId, err := primitive.ObjectIDFromHex(productQueryId)
 		if err != nil {
@@ -258,16 +316,31 @@ func (app *Application) InstantBuy() gin.HandlerFunc {
 			return
 		}
 
-		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		variantId, err := primitive.ObjectIDFromHex(c.Query("variantId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "variant id is invalid")
+			return
+		}
+
+		checkout, err := checkoutOptions(c)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
 
-		err = database.InstantBuyer(ctx, app.prodCollection, app.userCollection, productId, userQueryID)
+		order, intent, err := database.InstantBuyer(ctx, app.prodCollection, app.userCollection, CouponCollection, PromotionCollection, productId, variantId, userQueryID, checkout)
 		if err != nil {
-			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			checkoutError(c, err)
 			return
 		}
 
-		utils.ResponseHandler(c, 200, true, "Successfully placed the order", nil)
+		notifyOrder(ctx, models.OrderConfirmed, userQueryID, order)
+
+		utils.ResponseHandler(c, 200, true, "Successfully placed the order", checkoutResponse(order, intent))
 		ctx.Done()
 	}
 }
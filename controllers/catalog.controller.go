@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/catalog"
+	"ecommerce/database"
+	"ecommerce/utils"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// An import file may be much bigger than an image, it is read row by row so it never sits in the memory completely
+const maxImportBytes = 100 << 20
+
+// ImportProducts :- POST /admin/products/import?format=csv&dry_run=true
+// The file comes either as the raw request body or as a multipart form field called "file" ; the format falls back to the file extension.
+func ImportProducts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+
+		var body io.Reader = c.Request.Body
+		format := strings.ToLower(c.Query("format"))
+
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			file, header, err := c.Request.FormFile("file")
+			if err != nil {
+				utils.ErrorHandler(c, http.StatusBadRequest, false, "file is missing")
+				return
+			}
+			defer file.Close()
+
+			body = file
+			if format == "" {
+				format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+			}
+		}
+
+		reader, err := catalog.NewReader(format, body)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		dryRun := c.Query("dry_run") == "true"
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		report, err := database.ImportProducts(ctx, ProdCollection, reader, dryRun)
+		if err != nil {
+			log.Println(err)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				utils.ErrorHandler(c, http.StatusRequestEntityTooLarge, false, "The import file is too large")
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error(), "report": report})
+			return
+		}
+
+		message := "Products imported"
+		if dryRun {
+			message = "Dry run finished, nothing was saved"
+		} else {
+			// Prices and stock may have changed anywhere in the catalog
+			watchWishlists(nil)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": report.Failed == 0,
+			"message": message,
+			"report":  report,
+		})
+		ctx.Done()
+	}
+}
+
+// ExportProducts :- GET /admin/products/export?format=jsonl ; csv by default, the rows are written while they are read from the database
+func ExportProducts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		format := strings.ToLower(c.DefaultQuery("format", catalog.FormatCSV))
+
+		writer, err := catalog.NewWriter(format, c.Writer)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		contentType := "text/csv"
+		if format == catalog.FormatJSONLines {
+			contentType = "application/x-ndjson"
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", "attachment; filename=products."+format)
+		c.Status(http.StatusOK)
+
+		// The status is already sent with the first rows, so an error in between can only be logged
+		if err := database.ExportProducts(ctx, ProdCollection, writer); err != nil {
+			log.Println("Error while exporting the products ", err)
+		}
+		ctx.Done()
+	}
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/exchange"
+	"ecommerce/models"
+	"ecommerce/payment"
+	"ecommerce/shipping"
+	"ecommerce/tax"
+	"ecommerce/utils"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var TaxCalculator, taxErr = loadTaxCalculator()
+
+var ShippingMethods, shippingErr = loadShippingMethods()
+
+// loadTaxCalculator uses the external tax provider when one is configured, otherwise the local rules file.
+// A rules file which can't be loaded is an error for CheckCheckoutConfig, the orders are never placed without their tax.
+func loadTaxCalculator() (tax.Calculator, error) {
+	if constants.TAX_PROVIDER_URL != "" {
+		return tax.NewHTTPCalculator(constants.TAX_PROVIDER_URL, constants.TAX_PROVIDER_TOKEN), nil
+	}
+
+	rules, err := tax.LoadRules(constants.TAX_RULES_FILE)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the tax rules of %s :- %w", constants.TAX_RULES_FILE, err)
+	}
+
+	return tax.NewRuleCalculator(rules), nil
+}
+
+// CheckCheckoutConfig tells why the checkout can't work, the server does not start then
+func CheckCheckoutConfig() error {
+	return errors.Join(taxErr, shippingErr)
+}
+
+// loadShippingMethods reads the delivery methods ; a file which can't be loaded is an error for CheckCheckoutConfig, the orders never ship for free by mistake
+func loadShippingMethods() (*shipping.Config, error) {
+	methods, err := shipping.Load(constants.SHIPPING_FILE)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the shipping methods of %s :- %w", constants.SHIPPING_FILE, err)
+	}
+	return methods, nil
+}
+
+// checkoutOptions reads the checkout request body :- the saved shipping and billing addresses, the payment method, the coupon and the delivery method.
+// The currency still comes from the request like every other api.
+func checkoutOptions(c *gin.Context) (database.Checkout, error) {
+	var request models.CheckoutRequest
+	if err := c.BindJSON(&request); err != nil {
+		return database.Checkout{}, err
+	}
+
+	if validationErr := validate.Struct(request); validationErr != nil {
+		return database.Checkout{}, validationErr
+	}
+
+	checkout := database.Checkout{
+		Currency:            requestCurrency(c),
+		Rates:               ExchangeRates,
+		Tax:                 TaxCalculator,
+		Shipping_Address_ID: request.Shipping_Address_ID,
+		Billing_Address_ID:  request.Billing_Address_ID,
+		Payment:             models.NewPayment(request.Payment_Method),
+		Coupon_Code:         request.Coupon_Code,
+		Shipping:            ShippingMethods,
+		Shipping_Method:     request.Shipping_Method,
+		Payments:            PaymentProvider,
+	}
+
+	return checkout, nil
+}
+
+// checkoutResponse is the placed order ; a digital order also has the payment intent the customer's app pays with
+func checkoutResponse(order models.Order, intent *payment.Intent) gin.H {
+	response := gin.H{"order": order}
+	if intent != nil {
+		response["payment"] = intent
+	}
+	return response
+}
+
+// checkoutError writes the reason the order was not placed ; a cart which does not match the catalog also gets the list of changes to acknowledge
+func checkoutError(c *gin.Context, err error) {
+	var changed *database.CartChangedError
+	if errors.As(err, &changed) {
+		changes, convertErr := localizeCartChanges(changed.Changes, requestCurrency(c))
+		if convertErr != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, convertErr.Error())
+			return
+		}
+
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"changes": changes,
+		})
+		return
+	}
+
+	utils.ErrorHandler(c, checkoutErrorStatus(err), false, err.Error())
+}
+
+// checkoutErrorStatus maps the reasons an order can not be placed to the status code
+func checkoutErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, exchange.ErrUnsupportedCurrency), errors.Is(err, database.ErrCantFindAddress),
+		errors.Is(err, shipping.ErrUnknownMethod), errors.Is(err, shipping.ErrAddressIsRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrCantFindGuestCart):
+		return http.StatusNotFound
+	case errors.Is(err, shipping.ErrNoRate):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, database.ErrNotEnoughStock), errors.Is(err, database.ErrCartIsEmpty), errors.Is(err, database.ErrCartChanged),
+		errors.Is(err, database.ErrCartChangedInCheckout):
+		return http.StatusConflict
+	case errors.Is(err, tax.ErrTaxUnavailable), errors.Is(err, payment.ErrPaymentUnavailable):
+		return http.StatusServiceUnavailable
+	}
+
+	// The coupon of the cart does not work any more (expired, used up, the cart changed), the customer has to remove it or fix the cart
+	return couponErrorStatus(err)
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/database"
+	"ecommerce/models"
+	"ecommerce/pricing"
+	"ecommerce/utils"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var CouponCollection *mongo.Collection = database.CouponData(database.Client, "Coupons")
+
+// CreateCoupon :- POST /admin/coupons
+func CreateCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var coupon models.Coupon
+		if err := c.BindJSON(&coupon); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(coupon); validationErr != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, validationErr.Error())
+			return
+		}
+
+		if message := checkCoupon(coupon); message != "" {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, message)
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		coupon, err := database.CreateCoupon(ctx, CouponCollection, coupon)
+		if errors.Is(err, database.ErrCouponCodeTaken) {
+			utils.ErrorHandler(c, http.StatusConflict, false, err.Error())
+			return
+		}
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusCreated, true, "Coupon created", coupon)
+		ctx.Done()
+	}
+}
+
+// checkCoupon has the rules the validate tags cannot express, an empty message means the coupon is fine
+func checkCoupon(coupon models.Coupon) string {
+	switch coupon.Type {
+	case models.CouponPercentage:
+		if coupon.Percent_Off <= 0 {
+			return "percent_off must be more than 0 for a percentage coupon"
+		}
+	case models.CouponFixed:
+		if coupon.Amount_Off.Amount <= 0 {
+			return "amount_off must be more than 0 for a fixed coupon"
+		}
+	}
+
+	// Coupons work on the cart lines which are always in the store currency, they are converted at checkout
+	amounts := []models.Money{coupon.Amount_Off, coupon.Min_Basket}
+	if coupon.Max_Discount != nil {
+		amounts = append(amounts, *coupon.Max_Discount)
+	}
+	for _, amount := range amounts {
+		if amount.IsNegative() {
+			return "amounts of a coupon can't be negative"
+		}
+		if !amount.IsZero() && amount.Currency != models.DefaultCurrency() {
+			return "amounts of a coupon must be in " + models.DefaultCurrency()
+		}
+	}
+
+	if coupon.Starts_At != nil && coupon.Expires_At != nil && !coupon.Expires_At.After(*coupon.Starts_At) {
+		return "expires_at must be after starts_at"
+	}
+
+	return ""
+}
+
+// ListCoupons :- GET /admin/coupons
+func ListCoupons() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		coupons, err := database.ListCoupons(ctx, CouponCollection)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong. Please try again !")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true, "coupons": coupons})
+		ctx.Done()
+	}
+}
+
+// UpdateCouponStatus :- PUT /admin/coupons/:couponId with {"active": false}
+func UpdateCouponStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "PUT" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		couponId, err := primitive.ObjectIDFromHex(c.Param("couponId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid coupon id !")
+			return
+		}
+
+		var body struct {
+			Active *bool `json:"active" binding:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		err = database.SetCouponActive(ctx, CouponCollection, couponId, *body.Active)
+		if errors.Is(err, database.ErrCantFindCoupon) {
+			utils.ErrorHandler(c, http.StatusNotFound, false, err.Error())
+			return
+		}
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Coupon updated", nil)
+		ctx.Done()
+	}
+}
+
+// ApplyCartCoupon :- POST /cart/coupon with {"code": "SAVE10"} ; answers with the discount on the current cart
+func ApplyCartCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var body struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		quote, err := database.ApplyCartCoupon(ctx, ProdCollection, UserCollection, CouponCollection, PromotionCollection, c.GetString("uid"), strings.TrimSpace(body.Code))
+		if err != nil {
+			utils.ErrorHandler(c, couponErrorStatus(err), false, err.Error())
+			return
+		}
+
+		// The full cart with the new discount is in GET /listcart, here only the coupon is shown in the currency of the request
+		result := *quote.Coupon
+		if result.Discount, err = ExchangeRates.Convert(result.Discount, requestCurrency(c)); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+		result.Eligible_Subtotal, _ = ExchangeRates.Convert(result.Eligible_Subtotal, requestCurrency(c))
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Coupon applied", result)
+		ctx.Done()
+	}
+}
+
+// RemoveCartCoupon :- DELETE /cart/coupon
+func RemoveCartCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "DELETE" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := database.RemoveCartCoupon(ctx, UserCollection, c.GetString("uid")); err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Coupon removed", nil)
+		ctx.Done()
+	}
+}
+
+// couponErrorStatus maps the coupon rules to the status code, a coupon which is not usable is the fault of the request and not of the server
+func couponErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrCantFindCoupon):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrUserIdIsNotValid):
+		return http.StatusUnauthorized
+	case errors.Is(err, database.ErrCartIsEmpty),
+		errors.Is(err, pricing.ErrCouponInactive),
+		errors.Is(err, pricing.ErrCouponNotStarted),
+		errors.Is(err, pricing.ErrCouponExpired),
+		errors.Is(err, pricing.ErrCouponUsedUp),
+		errors.Is(err, pricing.ErrCouponUserLimit),
+		errors.Is(err, pricing.ErrCouponNeedsAccount),
+		errors.Is(err, pricing.ErrCouponMinBasket),
+		errors.Is(err, pricing.ErrCouponNotApplicable):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
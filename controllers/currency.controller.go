@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/exchange"
+	"ecommerce/models"
+	"ecommerce/pricing"
+	"ecommerce/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ExchangeRates *exchange.RateStore = loadExchangeRates()
+
+func loadExchangeRates() *exchange.RateStore {
+	rates := exchange.NewRateStore(constants.EXCHANGE_RATES_FILE, models.DefaultCurrency())
+	if err := rates.Load(); err != nil {
+		log.Println("Error loading the exchange rates, only "+models.DefaultCurrency()+" is available :- ", err)
+	}
+	return rates
+}
+
+// requestCurrency is the currency picked by middleware.Currency, the store currency when the middleware did not run
+func requestCurrency(c *gin.Context) string {
+	if currency := c.GetString("currency"); currency != "" {
+		return currency
+	}
+	return ExchangeRates.Base()
+}
+
+// localizeProducts shows the prices of the products in the currency of the request, the stored documents stay in the store currency
+func localizeProducts(products []models.Product, currency string) error {
+	if currency == ExchangeRates.Base() {
+		return nil
+	}
+
+	for i := range products {
+		product := &products[i]
+
+		// A product without variants (or saved before the prices had a currency) has no price to convert
+		price := models.NewMoney(0, currency)
+		if product.Price.Currency != "" || !product.Price.IsZero() {
+			var err error
+			if price, err = ExchangeRates.Convert(product.Price, currency); err != nil {
+				return err
+			}
+		}
+
+		for j := range product.Variants {
+			variant := &product.Variants[j]
+			variantPrice, err := ExchangeRates.Price(variant.Price, variant.Price_Overrides, currency)
+			if err != nil {
+				return err
+			}
+			variant.Price = variantPrice
+
+			// A fixed price of the admin can make another variant the cheapest one
+			if j == 0 || variant.Price.Amount < price.Amount {
+				price = variant.Price
+			}
+		}
+
+		product.Price = price
+	}
+
+	return nil
+}
+
+// localizePriceFacet shows the cheapest and the dearest price of the search result in the currency of the request
+func localizePriceFacet(ranges []database.PriceRange, currency string) error {
+	for i := range ranges {
+		var err error
+		if ranges[i].Min, err = ExchangeRates.Convert(ranges[i].Min, currency); err != nil {
+			return err
+		}
+		if ranges[i].Max, err = ExchangeRates.Convert(ranges[i].Max, currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localizeCartChanges shows the old and the new prices of the changes in the currency of the request, with the fixed prices of that currency when there are any
+func localizeCartChanges(changes []models.CartChange, currency string) ([]models.CartChange, error) {
+	for i, change := range changes {
+		if change.Old_Price != nil {
+			price, err := ExchangeRates.Price(*change.Old_Price, change.Old_Price_Overrides, currency)
+			if err != nil {
+				return changes, err
+			}
+			changes[i].Old_Price = &price
+		}
+
+		if change.New_Price != nil {
+			price, err := ExchangeRates.Price(*change.New_Price, change.New_Price_Overrides, currency)
+			if err != nil {
+				return changes, err
+			}
+			changes[i].New_Price = &price
+		}
+	}
+
+	return changes, nil
+}
+
+// localizeCart converts the cart lines and their quote, the same way the checkout prices the order :-
+// every line and every adjustment on its own, the totals are the sums of the converted amounts.
+func localizeCart(lines []models.ProductUser, quote pricing.CartQuote, currency string) ([]models.ProductUser, pricing.CartQuote, error) {
+	if currency == quote.Subtotal.Currency {
+		return lines, quote, nil
+	}
+
+	subtotal := models.NewMoney(0, currency)
+	for i, line := range lines {
+		price, err := ExchangeRates.Price(line.Price, line.Price_Overrides, currency)
+		if err != nil {
+			return lines, quote, err
+		}
+
+		quantity := int64(line.Quantity)
+		if quantity < 1 {
+			quantity = 1
+		}
+
+		lines[i].Price = price
+		subtotal = subtotal.Add(price.Mul(quantity))
+	}
+
+	discount := models.NewMoney(0, currency)
+	adjustments := make([]models.Adjustment, len(quote.Adjustments))
+	for i, adjustment := range quote.Adjustments {
+		amount, err := ExchangeRates.Convert(adjustment.Amount, currency)
+		if err != nil {
+			return lines, quote, err
+		}
+
+		adjustment.Amount = amount
+		adjustments[i] = adjustment
+		discount = discount.Add(amount)
+	}
+
+	if discount.Cmp(subtotal) > 0 {
+		discount = subtotal
+	}
+
+	if quote.Coupon != nil {
+		coupon := *quote.Coupon
+		coupon.Discount, _ = ExchangeRates.Convert(coupon.Discount, currency)
+		coupon.Eligible_Subtotal, _ = ExchangeRates.Convert(coupon.Eligible_Subtotal, currency)
+		quote.Coupon = &coupon
+	}
+
+	quote.Subtotal = subtotal
+	quote.Adjustments = adjustments
+	quote.Discount = discount
+	quote.Total = subtotal.Sub(discount)
+
+	return lines, quote, nil
+}
+
+// GetExchangeRates :- GET /exchange-rates
+func GetExchangeRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"currencies": ExchangeRates.Currencies(),
+			"rates":      ExchangeRates.Snapshot(),
+		})
+	}
+}
+
+// UpdateExchangeRates :- PUT /admin/exchange-rates with {"base": "INR", "rates": {"USD": "0.012"}} ; replaces all the rates and saves them in the rates file
+func UpdateExchangeRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "PUT" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var rates exchange.Rates
+		if err := c.BindJSON(&rates); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		if err := ExchangeRates.Save(rates); err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Exchange rates updated", ExchangeRates.Snapshot())
+	}
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/events"
+	"ecommerce/scheduler"
+	"ecommerce/utils"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EventBus is the sink of the subscribers inside the service, e.g. EventBus.Subscribe(models.EventOrderPlaced, handler)
+var EventBus *events.Bus = events.NewBus()
+
+// NATS is the in memory stand in of the "nats" sink, code inside the service can subscribe to the subjects with it
+var NATS *events.MemoryNATS = events.NewMemoryNATS()
+
+// EventDispatcher publishes the events of the outbox to the EVENT_SINKS
+var EventDispatcher *events.Dispatcher = newEventDispatcher()
+
+func newEventDispatcher() *events.Dispatcher {
+	sinks, err := events.NewSinks(constants.EVENT_SINKS, events.SinkConfig{
+		Bus:            EventBus,
+		Webhook_URL:    constants.EVENT_WEBHOOK_URL,
+		Webhook_Secret: constants.EVENT_WEBHOOK_SECRET,
+		NATS:           NATS,
+		Subject_Prefix: constants.EVENT_SUBJECT_PREFIX,
+	})
+	if err != nil {
+		// The events stay in the outbox until the sinks are fixed, nothing is lost
+		log.Println("Error loading the event sinks, no event is published :- ", err)
+		sinks = nil
+	}
+
+	maxAttempts, err := strconv.Atoi(constants.EVENT_MAX_ATTEMPTS)
+	if err != nil || maxAttempts <= 0 {
+		maxAttempts = 10
+	}
+
+	return events.NewDispatcher(database.OutboxCollection, sinks, maxAttempts)
+}
+
+// OutboxTask is the scheduled task which publishes the new events of the outbox
+func OutboxTask() scheduler.Task {
+	seconds, err := strconv.Atoi(constants.EVENT_POLL_SECONDS)
+	if err != nil || seconds <= 0 {
+		seconds = 2
+	}
+
+	return scheduler.Task{
+		Name:     "outbox",
+		Interval: time.Duration(seconds) * time.Second,
+		Run: func(ctx context.Context) error {
+			_, err := EventDispatcher.Dispatch(ctx)
+			if errors.Is(err, context.Canceled) {
+				return nil // The service is stopping, the next start goes on with the events which are left
+			}
+			return err
+		},
+	}
+}
+
+// ListEvents :- GET /admin/events?status=pending|published|failed&type=OrderPlaced, the newest first
+func ListEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		eventList, err := database.ListEvents(ctx, database.OutboxCollection, c.Query("status"), c.Query("type"), 100)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", eventList)
+		ctx.Done()
+	}
+}
+
+// RetryEvent :- POST /admin/events/:eventId/retry publishes a failed event again, only to the sinks which did not get it
+func RetryEvent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		eventId, ok := objectIdParam(c, "eventId")
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		event, err := database.RetryEvent(ctx, database.OutboxCollection, eventId)
+		if errors.Is(err, database.ErrCantFindEvent) {
+			utils.ErrorHandler(c, http.StatusNotFound, false, "No failed event with this id")
+			return
+		}
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "The event is published again", event)
+		ctx.Done()
+	}
+}
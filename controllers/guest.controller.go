@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/middleware"
+	"ecommerce/models"
+	"ecommerce/utils"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateGuestCart :- POST /guest/cart gives a new empty cart to a visitor without an account.
+// The returned cart token is sent back in the X-Cart-Token header of every guest api.
+func CreateGuestCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		// Without a secret key anybody could sign a token, so no guest cart is given out
+		if constants.SECRET_KEY == "" {
+			utils.ErrorHandler(c, http.StatusServiceUnavailable, false, "Guest carts are not available")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		guestId, err := database.CreateGuestCart(ctx, UserCollection, guestCartTTL())
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		token := utils.SignCartToken(constants.SECRET_KEY, guestId.Hex())
+		c.Header(middleware.CartTokenHeader, token)
+		utils.ResponseHandler(c, http.StatusCreated, true, "Guest cart created", gin.H{"cart_token": token})
+		ctx.Done()
+	}
+}
+
+// GetGuestCart :- GET /guest/cart
+func GetGuestCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		guest, err := database.FindGuestCart(ctx, UserCollection, c.GetString("uid"))
+		if err != nil {
+			utils.ErrorHandler(c, guestErrorStatus(err), false, err.Error())
+			return
+		}
+
+		touchGuestCart(ctx, c.GetString("uid"))
+
+		response, ok := pricedCart(ctx, c, c.GetString("uid"), guest)
+		if !ok {
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", response)
+		ctx.Done()
+	}
+}
+
+// AddToGuestCart :- POST /guest/cart/items?productId=..&variantId=..&quantity=2
+func AddToGuestCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		productId, err := primitive.ObjectIDFromHex(c.Query("productId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "product id is invalid")
+			return
+		}
+
+		variantId, err := primitive.ObjectIDFromHex(c.Query("variantId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "variant id is invalid")
+			return
+		}
+
+		quantity := 1
+		if quantityQuery := c.Query("quantity"); quantityQuery != "" {
+			quantity, err = strconv.Atoi(quantityQuery)
+			if err != nil || quantity < 1 {
+				utils.ErrorHandler(c, http.StatusBadRequest, false, "quantity must be a positive number")
+				return
+			}
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// The cart update does not notice a missing document, so check the guest cart still exists first
+		if _, err = database.FindGuestCart(ctx, UserCollection, c.GetString("uid")); err != nil {
+			utils.ErrorHandler(c, guestErrorStatus(err), false, err.Error())
+			return
+		}
+
+		err = database.AddProductToCart(ctx, ProdCollection, UserCollection, productId, variantId, quantity, c.GetString("uid"))
+		if errors.Is(err, database.ErrCantFindVariant) || errors.Is(err, database.ErrNotEnoughStock) {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		touchGuestCart(ctx, c.GetString("uid"))
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Successfully added to the cart", nil)
+		ctx.Done()
+	}
+}
+
+// RemoveFromGuestCart :- DELETE /guest/cart/items/:variantId
+func RemoveFromGuestCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "DELETE" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		variantId, err := primitive.ObjectIDFromHex(c.Param("variantId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "variant id is invalid")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err = database.RemoveCartItem(ctx, ProdCollection, UserCollection, variantId, c.GetString("uid")); err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		touchGuestCart(ctx, c.GetString("uid"))
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Successfully remove item from the cart", nil)
+		ctx.Done()
+	}
+}
+
+// GuestCheckout :- POST /guest/checkout places the order of the guest cart with the email and the addresses of the request body
+func GuestCheckout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var request models.GuestCheckoutRequest
+		if err := c.BindJSON(&request); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, validationErr.Error())
+			return
+		}
+
+		if !checkAddress(c, &request.Shipping_Address) {
+			return
+		}
+		if request.Billing_Address != nil && !checkAddress(c, request.Billing_Address) {
+			return
+		}
+
+		checkout := database.Checkout{
+			Currency:        requestCurrency(c),
+			Rates:           ExchangeRates,
+			Tax:             TaxCalculator,
+			Payment:         models.NewPayment(request.Payment_Method),
+			Coupon_Code:     request.Coupon_Code,
+			Shipping:        ShippingMethods,
+			Shipping_Method: request.Shipping_Method,
+			Payments:        PaymentProvider,
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		order, intent, err := database.GuestCheckout(ctx, ProdCollection, UserCollection, CouponCollection, PromotionCollection, c.GetString("uid"), request.Email, request.Shipping_Address, request.Billing_Address, checkout)
+		if err != nil {
+			checkoutError(c, err)
+			return
+		}
+
+		notifyOrder(ctx, models.OrderConfirmed, c.GetString("uid"), order)
+
+		utils.ResponseHandler(c, http.StatusCreated, true, "Successfully placed the order", checkoutResponse(order, intent))
+		ctx.Done()
+	}
+}
+
+// ListGuestOrders :- GET /guest/orders, the orders placed with this cart token
+func ListGuestOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		guest, err := database.FindGuestCart(ctx, UserCollection, c.GetString("uid"))
+		if err != nil {
+			utils.ErrorHandler(c, guestErrorStatus(err), false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", guest.Order_Status)
+		ctx.Done()
+	}
+}
+
+// attachGuestCart moves the guest cart of the X-Cart-Token header (if any) to the account which just signed up or logged in.
+// It never fails the sign up or the login, a problem is only logged.
+func attachGuestCart(ctx context.Context, c *gin.Context, userQueryID string) {
+	token := c.GetHeader(middleware.CartTokenHeader)
+	if token == "" {
+		return
+	}
+
+	guestId, ok := utils.VerifyCartToken(constants.SECRET_KEY, token)
+	if !ok {
+		log.Println("Invalid cart token, the guest cart is not attached")
+		return
+	}
+
+	if err := database.AttachGuestCart(ctx, UserCollection, guestId, userQueryID); err != nil {
+		log.Println("Error while attaching the guest cart ", err)
+	}
+}
+
+// touchGuestCart keeps a guest cart which is still used from expiring, a failure only means it expires sooner
+func touchGuestCart(ctx context.Context, guestQueryID string) {
+	if err := database.TouchGuestCart(ctx, UserCollection, guestQueryID, guestCartTTL()); err != nil {
+		log.Println("Error while extending the guest cart ", err)
+	}
+}
+
+func guestCartTTL() time.Duration {
+	days, err := strconv.Atoi(constants.GUEST_CART_TTL_DAYS)
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func guestErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrCantFindGuestCart):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrUserIdIsNotValid):
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/models"
+	"ecommerce/storage"
+	"ecommerce/utils"
+	"errors"
+	"image"
+	_ "image/gif" // The blank imports register the decoders, image.Decode can then read these formats
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ImageCollection *mongo.Collection = database.ImageData(database.Client, "Images")
+
+var ImageStorage storage.BlobStorage = storage.NewLocalStorage(constants.STORAGE_DIR)
+
+// Content types we accept, detected from the file bytes and never from the file name or the header sent by the client
+var allowedImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// A small file can still decode into a huge picture (decompression bomb), so the dimensions are checked before decoding
+const maxImageSide = 10000
+
+// UploadProductImage :- POST /admin/products/:productId/images with a multipart form field called "image"
+func UploadProductImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		productId, err := primitive.ObjectIDFromHex(c.Param("productId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid product id !")
+			return
+		}
+
+		// MaxBytesReader stops reading the body after the limit, so a big upload never ends up in the memory or the disk
+		maxMB, err := strconv.ParseInt(constants.MAX_UPLOAD_MB, 10, 64)
+		if err != nil || maxMB <= 0 {
+			maxMB = 5
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxMB<<20)
+
+		file, header, err := c.Request.FormFile("image")
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				utils.ErrorHandler(c, http.StatusRequestEntityTooLarge, false, "Image must be smaller than "+constants.MAX_UPLOAD_MB+" MB")
+				return
+			}
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "image file is missing")
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Cannot read the image")
+			return
+		}
+
+		// DetectContentType looks at the first 512 bytes of the file (the magic numbers)
+		contentType := http.DetectContentType(data)
+		extension, ok := allowedImageTypes[contentType]
+		if !ok {
+			utils.ErrorHandler(c, http.StatusUnsupportedMediaType, false, "Only jpeg, png and gif images are allowed")
+			return
+		}
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || config.Width > maxImageSide || config.Height > maxImageSide {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "The image is corrupted or too large")
+			return
+		}
+
+		picture, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "The image is corrupted")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		count, err := ProdCollection.CountDocuments(ctx, bson.D{{Key: "_id", Value: productId}})
+		if err != nil || count == 0 {
+			utils.ErrorHandler(c, http.StatusNotFound, false, database.ErrCantFindProduct.Error())
+			return
+		}
+
+		productImage := models.Image{
+			Image_ID:       primitive.NewObjectID(),
+			Product_ID:     productId,
+			Content_Type:   contentType,
+			Width:          config.Width,
+			Height:         config.Height,
+			Size:           header.Size,
+			Thumbnails:     make(map[string]string),
+			Thumbnail_Type: "image/jpeg",
+		}
+		productImage.Created_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		if contentType != "image/jpeg" {
+			productImage.Thumbnail_Type = "image/png"
+		}
+
+		prefix := "products/" + productId.Hex() + "/" + productImage.Image_ID.Hex() + "/"
+		productImage.Original = prefix + "original" + extension
+
+		if err := ImageStorage.Put(ctx, productImage.Original, bytes.NewReader(data)); err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, database.ErrCantSaveImage.Error())
+			return
+		}
+
+		for name, side := range storage.ThumbnailSizes {
+			var encoded bytes.Buffer
+			thumbnail := storage.Thumbnail(picture, side)
+
+			key := prefix + name + ".jpg"
+			if productImage.Thumbnail_Type == "image/png" {
+				key = prefix + name + ".png"
+				err = png.Encode(&encoded, thumbnail)
+			} else {
+				err = jpeg.Encode(&encoded, thumbnail, &jpeg.Options{Quality: 85})
+			}
+
+			if err == nil {
+				err = ImageStorage.Put(ctx, key, &encoded)
+			}
+
+			if err != nil {
+				log.Println(err)
+				deleteImageFiles(ctx, productImage)
+				utils.ErrorHandler(c, http.StatusInternalServerError, false, database.ErrCantSaveImage.Error())
+				return
+			}
+
+			productImage.Thumbnails[name] = key
+		}
+
+		err = database.AddProductImage(ctx, ProdCollection, ImageCollection, productImage)
+		if err != nil {
+			deleteImageFiles(ctx, productImage)
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusCreated, true, "Image uploaded successfully", productImage)
+		ctx.Done()
+	}
+}
+
+// ServeImage :- GET /images/:imageId?size=small ; without the size the original upload is returned
+func ServeImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		imageId, err := primitive.ObjectIDFromHex(c.Param("imageId"))
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid image id !")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var productImage models.Image
+		err = ImageCollection.FindOne(ctx, bson.D{{Key: "_id", Value: imageId}}).Decode(&productImage)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusNotFound, false, database.ErrCantFindImage.Error())
+			return
+		}
+
+		key, contentType := productImage.Original, productImage.Content_Type
+		if size := c.Query("size"); size != "" {
+			thumbnail, ok := productImage.Thumbnails[size]
+			if !ok {
+				utils.ErrorHandler(c, http.StatusBadRequest, false, "Unknown image size "+size)
+				return
+			}
+			key, contentType = thumbnail, productImage.Thumbnail_Type
+		}
+
+		reader, err := ImageStorage.Get(ctx, key)
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusNotFound, false, database.ErrCantFindImage.Error())
+			return
+		}
+		defer reader.Close()
+
+		// The stored files never change (a new upload gets a new id) so the browser may cache them for long
+		c.DataFromReader(http.StatusOK, -1, contentType, reader, map[string]string{"Cache-Control": "public, max-age=31536000, immutable"})
+	}
+}
+
+// DeleteProductImage :- DELETE /admin/products/:productId/images/:imageId
+func DeleteProductImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "DELETE" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		productId, err := primitive.ObjectIDFromHex(c.Param("productId"))
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid product id !")
+			return
+		}
+
+		imageId, err := primitive.ObjectIDFromHex(c.Param("imageId"))
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid image id !")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		productImage, err := database.RemoveProductImage(ctx, ProdCollection, ImageCollection, productId, imageId)
+		if errors.Is(err, database.ErrCantFindImage) {
+			utils.ErrorHandler(c, http.StatusNotFound, false, err.Error())
+			return
+		}
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		deleteImageFiles(ctx, productImage)
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Image deleted successfully", nil)
+		ctx.Done()
+	}
+}
+
+func deleteImageFiles(ctx context.Context, productImage models.Image) {
+	keys := []string{productImage.Original}
+	for _, key := range productImage.Thumbnails {
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		if err := ImageStorage.Delete(ctx, key); err != nil {
+			log.Println("Error while deleting the image file ", key, err)
+		}
+	}
+}
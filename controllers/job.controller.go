@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/jobs"
+	"ecommerce/utils"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var JobCollection *mongo.Collection = database.JobData(database.Client, "Jobs")
+var DeadJobCollection *mongo.Collection = database.DeadJobData(database.Client, "DeadJobs")
+
+// Jobs is the background job queue, main starts its workers and drains them on shutdown
+var Jobs *jobs.Runner = newJobRunner()
+
+// newJobRunner registers the handler of every job type
+func newJobRunner() *jobs.Runner {
+	concurrency, err := strconv.Atoi(constants.JOB_CONCURRENCY)
+	if err != nil || concurrency <= 0 {
+		concurrency = 4
+	}
+
+	maxAttempts, err := strconv.Atoi(constants.JOB_MAX_ATTEMPTS)
+	if err != nil || maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+
+	runner := jobs.NewRunner(JobCollection, DeadJobCollection, concurrency, maxAttempts)
+
+	runner.Handle(wishlistAlertsJob, runWishlistAlerts)
+	// Every check reads the wishlists of all its products, two at once would only compete for the same documents
+	runner.Limit(wishlistAlertsJob, 1)
+
+	runner.Handle(deliverNotificationJob, runDelivery)
+	// A small mail server refuses many connections at once
+	runner.Limit(deliverNotificationJob, 2)
+
+	return runner
+}
+
+// ListJobs :- GET /admin/jobs?status=pending|running|done, the newest first
+func ListJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		jobList, err := database.ListJobs(ctx, JobCollection, c.Query("status"), 100)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", jobList)
+		ctx.Done()
+	}
+}
+
+// ListDeadJobs :- GET /admin/jobs/dead, the jobs which failed every attempt with their last error
+func ListDeadJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		jobList, err := database.ListJobs(ctx, DeadJobCollection, "", 100)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", jobList)
+		ctx.Done()
+	}
+}
+
+// RetryDeadJob :- POST /admin/jobs/dead/:jobId/retry puts a dead job back in the queue, e.g. after the mail server is fixed
+func RetryDeadJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		jobId, ok := objectIdParam(c, "jobId")
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		job, err := database.RequeueDeadJob(ctx, JobCollection, DeadJobCollection, jobId)
+		if errors.Is(err, database.ErrCantFindJob) {
+			utils.ErrorHandler(c, http.StatusNotFound, false, err.Error())
+			return
+		}
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "The job is queued again", job)
+		ctx.Done()
+	}
+}
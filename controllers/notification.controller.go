@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/models"
+	"ecommerce/notify"
+	"ecommerce/utils"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var DeliveryCollection *mongo.Collection = database.DeliveryData(database.Client, "NotificationDeliveries")
+
+// Notifications renders the emails and sms of the events and sends them through the NOTIFY_CHANNELS
+var Notifications *notify.Service = loadNotificationService()
+
+func loadNotificationService() *notify.Service {
+	templates, err := notify.LoadTemplates(constants.NOTIFY_TEMPLATES_DIR, constants.DEFAULT_LOCALE)
+	if err != nil {
+		log.Println("Error loading the notification templates, no email or sms is sent :- ", err)
+	}
+
+	channels, err := notify.NewChannels(constants.NOTIFY_CHANNELS, notify.ChannelConfig{
+		SMTP_Addr:     constants.SMTP_ADDR,
+		SMTP_From:     constants.SMTP_FROM,
+		SMTP_Username: constants.SMTP_USERNAME,
+		SMTP_Password: constants.SMTP_PASSWORD,
+		File:          constants.NOTIFY_MESSAGES_FILE,
+	})
+	if err != nil {
+		log.Println("Error loading the notification channels, no email or sms is sent :- ", err)
+	}
+
+	return notify.NewService(templates, channels)
+}
+
+// deliveryNotifier is the Notifier of the service :- the event goes to the event log of NOTIFIER, then every message
+// rendered from it is saved as a delivery and sent by a job, so a channel which is down gets the message later.
+type deliveryNotifier struct {
+	events notify.Notifier
+}
+
+func (d *deliveryNotifier) Notify(ctx context.Context, notification notify.Notification) error {
+	if err := d.events.Notify(ctx, notification); err != nil {
+		log.Println("Error while logging the notification ", err)
+	}
+
+	if notification.To == nil {
+		recipient, err := notificationRecipient(ctx, notification.User_ID)
+		if err != nil {
+			return err
+		}
+		notification.To = &recipient
+	}
+
+	messages, err := Notifications.Messages(notification)
+	if err != nil {
+		// A broken template only stops its own channel, the messages of the other channels still go out
+		log.Println("Error while rendering the notification "+notification.Event+" :- ", err)
+	}
+
+	var errs []error
+	for _, message := range messages {
+		delivery, err := database.QueueDelivery(ctx, DeliveryCollection, models.NotificationDelivery{
+			Event:   message.Event,
+			User_ID: notification.User_ID,
+			Channel: message.Channel,
+			Locale:  message.Locale,
+			To:      message.To,
+			Subject: message.Subject,
+			Text:    message.Text,
+			HTML:    message.HTML,
+		})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if _, err = Jobs.Enqueue(ctx, deliverNotificationJob, deliveryPayload{Delivery_ID: delivery.Delivery_ID}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// notificationRecipient reads the name, the addresses and the locale of the user ; a guest is written to at the email of the guest checkout
+func notificationRecipient(ctx context.Context, userQueryID string) (notify.Recipient, error) {
+	user, err := database.NotificationRecipient(ctx, UserCollection, userQueryID)
+	if err != nil {
+		return notify.Recipient{}, err
+	}
+
+	recipient := notify.Recipient{Locale: constants.DEFAULT_LOCALE}
+	if user.First_Name != nil {
+		recipient.Name = *user.First_Name
+	}
+	if user.Email != nil {
+		recipient.Email = *user.Email
+	}
+	if user.Guest && user.Guest_Email != nil {
+		recipient.Email = *user.Guest_Email
+	}
+	if user.Phone != nil {
+		recipient.Phone = *user.Phone
+	}
+	if user.Locale != nil && *user.Locale != "" {
+		recipient.Locale = *user.Locale
+	}
+
+	return recipient, nil
+}
+
+// notifyUser sends the notification of an event ; a failure is only logged, it never fails the api the event happened in
+func notifyUser(ctx context.Context, event string, userQueryID string, data map[string]any) {
+	notification := notify.Notification{
+		Event:      event,
+		User_ID:    userQueryID,
+		Data:       data,
+		Created_At: time.Now(),
+	}
+
+	if err := Notifier.Notify(ctx, notification); err != nil {
+		log.Println("Error while sending the "+event+" notification ", err)
+	}
+}
+
+// notifyOrder tells the customer about a step of the order, the templates read it as .Data.order
+func notifyOrder(ctx context.Context, event string, userQueryID string, order models.Order) {
+	notifyUser(ctx, event, userQueryID, map[string]any{"order": order})
+}
+
+// Job which sends one saved delivery
+const deliverNotificationJob = "notification.deliver"
+
+type deliveryPayload struct {
+	Delivery_ID primitive.ObjectID `bson:"delivery_id"`
+}
+
+// runDelivery sends the message of the delivery and writes the attempt down, an error makes the job runner try again later
+func runDelivery(ctx context.Context, job models.Job) error {
+	var payload deliveryPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	delivery, err := database.FindDelivery(ctx, DeliveryCollection, payload.Delivery_ID)
+	if errors.Is(err, database.ErrCantFindDelivery) {
+		return nil // Nothing left to send
+	}
+	if err != nil {
+		return err
+	}
+
+	// An earlier attempt sent it but its job could not be marked as done
+	if delivery.Status == models.DeliverySent {
+		return nil
+	}
+
+	sendErr := Notifications.Send(ctx, notify.Message{
+		Channel: delivery.Channel,
+		Event:   delivery.Event,
+		Locale:  delivery.Locale,
+		To:      delivery.To,
+		Subject: delivery.Subject,
+		Text:    delivery.Text,
+		HTML:    delivery.HTML,
+	})
+
+	lastAttempt := job.Attempts >= job.Max_Attempts
+	if err = database.RecordDeliveryAttempt(ctx, DeliveryCollection, delivery.Delivery_ID, sendErr, lastAttempt); err != nil {
+		log.Println("Error while recording the delivery attempt ", err)
+	}
+
+	return sendErr
+}
+
+// A language tag like "en", "hi" or "en-GB"
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// requestLocale is the first language of the Accept-Language header, "" when it has none
+func requestLocale(c *gin.Context) string {
+	first, _, _ := strings.Cut(c.GetHeader("Accept-Language"), ",")
+	locale, _, _ := strings.Cut(first, ";")
+	locale = strings.TrimSpace(locale)
+
+	if !localePattern.MatchString(locale) {
+		return ""
+	}
+	return locale
+}
+
+// ListDeliveries :- GET /admin/notifications?userId=..&status=queued|sent|failed, the newest first
+func ListDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		deliveries, err := database.ListDeliveries(ctx, DeliveryCollection, c.Query("userId"), c.Query("status"), 100)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", deliveries)
+		ctx.Done()
+	}
+}
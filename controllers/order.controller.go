@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/database"
+	"ecommerce/models"
+	"ecommerce/utils"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShipOrder :- POST /admin/orders/:orderId/ship with {"carrier": "Delhivery", "tracking_number": "..."} ; the customer gets an email and an sms
+func ShipOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		orderId, ok := objectIdParam(c, "orderId")
+		if !ok {
+			return
+		}
+
+		var request models.ShipOrderRequest
+		if err := c.BindJSON(&request); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, validationErr.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		userId, order, err := database.ShipOrder(ctx, UserCollection, orderId, request.Carrier, request.Tracking_Number)
+		if errors.Is(err, database.ErrCantFindOrder) {
+			utils.ErrorHandler(c, http.StatusNotFound, false, err.Error())
+			return
+		}
+		if errors.Is(err, database.ErrOrderNotShippable) {
+			utils.ErrorHandler(c, http.StatusConflict, false, err.Error())
+			return
+		}
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		notifyOrder(ctx, models.OrderSent, userId.Hex(), order)
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Order shipped", order)
+		ctx.Done()
+	}
+}
@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/models"
+	"ecommerce/payment"
+	"ecommerce/scheduler"
+	"ecommerce/utils"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var PaymentProvider payment.Provider = loadPaymentProvider()
+
+var PaymentEventCollection *mongo.Collection = database.PaymentEventData(database.Client, "PaymentEvents")
+
+// Webhooks are small json documents, a bigger body is refused before it is read
+const maxWebhookBytes = 1 << 20
+
+// How often the unpaid orders are looked for, and how many one run cancels at most (the rest are picked by the next run)
+const (
+	pendingPaymentCheck = 5 * time.Minute
+	expiredOrdersPerRun = 100
+)
+
+// loadPaymentProvider picks the gateway of PAYMENT_PROVIDER, a real gateway is added here next to the mock one
+func loadPaymentProvider() payment.Provider {
+	switch constants.PAYMENT_PROVIDER {
+	case "":
+		log.Println("No PAYMENT_PROVIDER, digital payments are turned off")
+		return nil
+	case "mock":
+		log.Println("The mock payment provider is in use, orders can be paid without any money ; never run it in production")
+		return payment.NewMockProvider(constants.PAYMENT_WEBHOOK_SECRET)
+	}
+
+	log.Println("Unknown payment provider " + constants.PAYMENT_PROVIDER + ", digital payments are turned off")
+	return nil
+}
+
+// PendingPaymentTask is the scheduled task which cancels the digital orders nobody paid within PAYMENT_EXPIRY_MINUTES.
+// Without it their stock and coupon uses would stay taken for ever, e.g. when the gateway forgot the intent.
+func PendingPaymentTask() scheduler.Task {
+	minutes, err := strconv.Atoi(constants.PAYMENT_EXPIRY_MINUTES)
+	if err != nil || minutes <= 0 {
+		minutes = 60
+	}
+
+	return scheduler.Task{
+		Name:     "pending-payments",
+		Interval: pendingPaymentCheck,
+		Run: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			defer cancel()
+			return ExpirePendingPayments(ctx, time.Duration(minutes)*time.Minute)
+		},
+	}
+}
+
+// ExpirePendingPayments cancels the digital orders which wait for their payment longer than maxAge
+func ExpirePendingPayments(ctx context.Context, maxAge time.Duration) error {
+	orders, err := database.StalePendingOrders(ctx, UserCollection, time.Now().Add(-maxAge), expiredOrdersPerRun)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, pending := range orders {
+		if err := database.ExpirePendingOrder(ctx, ProdCollection, UserCollection, CouponCollection, PaymentProvider, pending.Order); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(orders) > 0 {
+		log.Printf("Looked at %d unpaid orders, %d could not be cancelled\n", len(orders), len(errs))
+	}
+	return errors.Join(errs...)
+}
+
+// PaymentWebhook :- POST /payments/webhook ; the gateway tells us about a payment, signed in the X-Payment-Signature header
+func PaymentWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		// The signature is over the exact bytes which were sent, so the raw body is read instead of binding it
+		payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBytes))
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid webhook body !")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		handled, err := receivePaymentWebhook(ctx, payload, c.GetHeader("X-Payment-Signature"))
+		if err != nil {
+			utils.ErrorHandler(c, paymentErrorStatus(err), false, err.Error())
+			return
+		}
+
+		// An event we already handled is still a success, otherwise the gateway keeps sending it
+		utils.ResponseHandler(c, http.StatusOK, true, "", gin.H{"duplicate": !handled})
+		ctx.Done()
+	}
+}
+
+// MockPaymentsEnabled tells if PAYMENT_PROVIDER is the mock gateway, only then the route of MockPayment is registered
+func MockPaymentsEnabled() bool {
+	_, ok := PaymentProvider.(*payment.MockProvider)
+	return ok
+}
+
+// MockPayment :- POST /payments/mock/:intentId?outcome=fail ; pays an intent of the mock gateway like the customer would.
+// It only exists with the mock provider, only for an order of the caller, and goes through the same signed webhook as a real gateway.
+func MockPayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		mock, ok := PaymentProvider.(*payment.MockProvider)
+		if !ok {
+			utils.ErrorHandler(c, http.StatusNotFound, false, "The mock payment provider is not in use")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// Somebody else's intent is "not found" as well, the answer must not tell which intents exist
+		userId, _, err := database.FindOrderByIntent(ctx, UserCollection, c.Param("intentId"))
+		if err != nil || userId.Hex() != c.GetString("uid") {
+			utils.ErrorHandler(c, http.StatusNotFound, false, database.ErrCantFindOrder.Error())
+			return
+		}
+
+		payload, signature, err := mock.Simulate(c.Param("intentId"), c.Query("outcome") != "fail")
+		if err != nil {
+			utils.ErrorHandler(c, paymentErrorStatus(err), false, err.Error())
+			return
+		}
+
+		if _, err = receivePaymentWebhook(ctx, payload, signature); err != nil {
+			utils.ErrorHandler(c, paymentErrorStatus(err), false, err.Error())
+			return
+		}
+
+		_, order, err := database.FindOrderByIntent(ctx, UserCollection, c.Param("intentId"))
+		if err != nil {
+			utils.ErrorHandler(c, paymentErrorStatus(err), false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Payment simulated", order)
+		ctx.Done()
+	}
+}
+
+func receivePaymentWebhook(ctx context.Context, payload []byte, signature string) (bool, error) {
+	if PaymentProvider == nil {
+		return false, payment.ErrPaymentUnavailable
+	}
+
+	event, err := PaymentProvider.ParseWebhook(payload, signature)
+	if err != nil {
+		log.Println("Refused payment webhook :- ", err)
+		return false, payment.ErrInvalidSignature
+	}
+
+	return database.ProcessPaymentEvent(ctx, ProdCollection, UserCollection, CouponCollection, PaymentEventCollection, PaymentProvider, event, constants.PAYMENT_AUTO_CAPTURE == "true")
+}
+
+// CaptureOrderPayment :- POST /admin/orders/:orderId/payment/capture
+func CaptureOrderPayment() gin.HandlerFunc {
+	return orderPaymentAction(func(ctx context.Context, order models.Order, c *gin.Context) (models.Order, error) {
+		return database.CapturePayment(ctx, ProdCollection, UserCollection, CouponCollection, PaymentProvider, order)
+	})
+}
+
+// RefundOrderPayment :- POST /admin/orders/:orderId/payment/refund with {"amount": {"value": "100.00", "currency": "INR"}} ; without an amount everything left is refunded
+func RefundOrderPayment() gin.HandlerFunc {
+	return orderPaymentAction(func(ctx context.Context, order models.Order, c *gin.Context) (models.Order, error) {
+		var body struct {
+			Amount models.Money `json:"amount"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				return models.Order{}, payment.ErrInvalidAmount
+			}
+		}
+
+		return database.RefundPayment(ctx, ProdCollection, UserCollection, CouponCollection, PaymentProvider, order, body.Amount)
+	})
+}
+
+// VoidOrderPayment :- POST /admin/orders/:orderId/payment/void ; cancels the order while the payment is not captured
+func VoidOrderPayment() gin.HandlerFunc {
+	return orderPaymentAction(func(ctx context.Context, order models.Order, c *gin.Context) (models.Order, error) {
+		order, err := database.VoidPayment(ctx, ProdCollection, UserCollection, CouponCollection, PaymentProvider, order)
+		if err == nil {
+			// The stock of the cancelled order is back, a wishlisted variant may be for sale again
+			productIds := make([]primitive.ObjectID, 0, len(order.Order_Cart))
+			for _, line := range order.Order_Cart {
+				productIds = append(productIds, line.Product_ID)
+			}
+			watchWishlists(productIds)
+		}
+		return order, err
+	})
+}
+
+// orderPaymentAction finds the order of the url and runs one gateway call on its payment
+func orderPaymentAction(action func(ctx context.Context, order models.Order, c *gin.Context) (models.Order, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		orderId, err := primitive.ObjectIDFromHex(c.Param("orderId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid order id !")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		_, order, err := database.FindOrder(ctx, UserCollection, orderId)
+		if err != nil {
+			utils.ErrorHandler(c, paymentErrorStatus(err), false, err.Error())
+			return
+		}
+
+		order, err = action(ctx, order, c)
+		if err != nil {
+			utils.ErrorHandler(c, paymentErrorStatus(err), false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Payment updated", order)
+		ctx.Done()
+	}
+}
+
+// paymentErrorStatus maps the payment errors to the status code
+func paymentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrCantFindOrder), errors.Is(err, payment.ErrCantFindIntent):
+		return http.StatusNotFound
+	case errors.Is(err, payment.ErrInvalidSignature):
+		return http.StatusUnauthorized
+	case errors.Is(err, payment.ErrInvalidAmount):
+		return http.StatusBadRequest
+	case errors.Is(err, payment.ErrInvalidTransition), errors.Is(err, database.ErrNotDigitalOrder), errors.Is(err, database.ErrPaymentEventBusy):
+		return http.StatusConflict
+	case errors.Is(err, payment.ErrPaymentUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -5,8 +5,11 @@ import (
 	"ecommerce/database"
 	"ecommerce/models"
 	"ecommerce/utils"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -59,6 +62,11 @@ func GetAllProducts() gin.HandlerFunc {
 
 		defer cursor.Close(ctx)
 
+		if err := localizeProducts(ProductList, requestCurrency(c)); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"success":  true,
 			"message":  "Successfully get all the products",
@@ -68,6 +76,11 @@ func GetAllProducts() gin.HandlerFunc {
 	}
 }
 
+// Query params which are not a facet of the variant attributes
+var searchReservedParams = map[string]bool{"name": true, "brand": true, "category": true, "min_price": true, "max_price": true, "currency": true, "page": true, "limit": true}
+
+// SearchProductByQuery :- /users/search?name=iphone&brand=Apple,Samsung&colour=red&min_price=100&max_price=500&page=2&limit=20
+// Every query param other than the reserved ones is treated as a variant attribute filter, comma separated values are OR'ed.
 func SearchProductByQuery() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.Request.Method != "GET" {
@@ -75,53 +88,121 @@ func SearchProductByQuery() gin.HandlerFunc {
 			return
 		}
 
-		var searchProducts []models.Product
+		search := database.ProductSearch{
+			Name:       c.Query("name"), // ?name="iphone"
+			Brands:     splitFacetValues(c.Query("brand")),
+			Categories: splitFacetValues(c.Query("category")),
+			Attributes: make(map[string][]string),
+		}
+
+		// A missing or wrong page is the first one, a missing or too big limit is the default page size
+		page, _ := strconv.Atoi(c.Query("page"))
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		search.Page, search.Limit = int64(page), int64(limit)
 
-		queryParam := c.Query("name") // ?name="iphone"
-		if queryParam == "" {
-			log.Println("query name is empty")
-			c.Header("Content-Type", "application/json")
-			c.Abort() // -->>This can be used when you need to stop further processing due to invalid input, unauthorized access, etc.
+		var err error
+		if search.MinPrice, err = parsePriceParam(c.Query("min_price"), requestCurrency(c)); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "min_price must be a positive number")
+			return
+		}
+		if search.MaxPrice, err = parsePriceParam(c.Query("max_price"), requestCurrency(c)); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "max_price must be a positive number")
 			return
 		}
 
+		for name, values := range c.Request.URL.Query() {
+			if searchReservedParams[name] {
+				continue
+			}
+
+			if !database.IsValidAttributeName(name) {
+				utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid filter "+name)
+				return
+			}
+
+			for _, value := range values {
+				search.Attributes[name] = append(search.Attributes[name], splitFacetValues(value)...)
+			}
+		}
+
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		// The $regex operator is used to perform a regex search with the case-insensitive(Mean uppercase and lowercase letter treated be as same) option $options: 'i', and the caret ^ in the regex pattern ensures that the search starts with the given letters.
-		search := bson.M{
-			"product_name": bson.M{
-				"$regex":   "^" + queryParam,
-				"$options": "i",
-			},
-		}
-		cursor, err := ProdCollection.Find(ctx, search)
+		searchResult, err := database.SearchProducts(ctx, ProdCollection, search)
 		if err != nil {
 			log.Println(err)
-			utils.ErrorHandler(c, http.StatusNotFound, false, "Something went wrong. Please try again !")
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong. Please try again !")
 			return
 		}
 
-		// To retrieve documents from your cursor individually while blocking the current goroutine, use the Next() method.
-		for cursor.Next(ctx) {
-			var search models.Product
-			if err := cursor.Decode(&search); err != nil {
-				log.Fatal(err)
-			}
-			searchProducts = append(searchProducts, search)
+		if err := localizeProducts(searchResult.Products, requestCurrency(c)); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+		if err := localizePriceFacet(searchResult.Facets.Price, requestCurrency(c)); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
 		}
 
-		if err := cursor.Err(); err != nil {
-			log.Println(err)
-			c.JSON(http.StatusBadRequest, "Invalid request")
-			log.Fatal(err)
+		c.JSON(http.StatusOK, gin.H{
+			"success":  true,
+			"products": searchResult.Products,
+			"total":    searchResult.Total,
+			"page":     searchResult.Page,
+			"limit":    searchResult.Limit,
+			"facets":   searchResult.Facets,
+		})
+		ctx.Done()
+	}
+}
+
+// "red, blue" -->> ["red", "blue"]
+func splitFacetValues(value string) []string {
+	values := make([]string, 0)
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
 		}
+	}
+	return values
+}
 
-		defer cursor.Close(ctx)
+// The price filters are written in the major unit of the currency of the request, ?min_price=99.50 ;
+// the catalog is filtered in the store currency, so they are converted back to it
+func parsePriceParam(value string, currency string) (*models.Money, error) {
+	if value == "" {
+		return nil, nil
+	}
 
-		utils.ResponseHandler(c, http.StatusOK, true, "", searchProducts)
-		ctx.Done()
+	price, err := models.ParseMoney(value, currency)
+	if err != nil || price.IsNegative() {
+		return nil, models.ErrInvalidAmount
+	}
+
+	if price, err = ExchangeRates.ToBase(price); err != nil {
+		return nil, err
+	}
+	return &price, nil
+}
+
+// checkPriceOverrides returns why the fixed prices of a variant are wrong, "" when they are fine :- at most one price
+// per currency, above zero and never in the store currency (the variant price is that one)
+func checkPriceOverrides(overrides []models.Money) string {
+	seen := make(map[string]bool, len(overrides))
+	for _, override := range overrides {
+		switch {
+		case override.Amount <= 0:
+			return "every price must be greater than zero"
+		case len(override.Currency) != 3:
+			return "every price needs a currency code"
+		case override.Currency == models.DefaultCurrency():
+			return "a price in " + models.DefaultCurrency() + " is the price of the variant itself"
+		case seen[override.Currency]:
+			return "more than one price in " + override.Currency
+		}
+		seen[override.Currency] = true
 	}
+	return ""
 }
 
 func ProductViewerAdmin() gin.HandlerFunc {
@@ -144,10 +225,54 @@ func ProductViewerAdmin() gin.HandlerFunc {
 			return
 		}
 
+		if validationErr := validate.Struct(products); validationErr != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, validationErr.Error())
+			return
+		}
+
+		// Every variant gets its own id and the SKU must be unique inside this product and across the whole catalog
+		seen := make(map[string]bool)
+		for i := range products.Variants {
+			sku := *products.Variants[i].SKU
+			if seen[sku] {
+				utils.ErrorHandler(c, http.StatusBadRequest, false, "Duplicate SKU "+sku)
+				return
+			}
+			seen[sku] = true
+
+			products.Variants[i].Variant_ID = primitive.NewObjectID()
+
+			// The whole catalog is priced in the store currency
+			price := products.Variants[i].Price
+			if price.Amount <= 0 || price.Currency != models.DefaultCurrency() {
+				utils.ErrorHandler(c, http.StatusBadRequest, false, "Price of "+sku+" must be greater than zero and in "+models.DefaultCurrency())
+				return
+			}
+
+			if message := checkPriceOverrides(products.Variants[i].Price_Overrides); message != "" {
+				utils.ErrorHandler(c, http.StatusBadRequest, false, "Price overrides of "+sku+" :- "+message)
+				return
+			}
+
+			// The cheapest variant becomes the "from" price of the product
+			if i == 0 || price.Amount < products.Price.Amount {
+				products.Price = price
+			}
+		}
+
+		// The rating is only derived from the approved reviews
+		products.Rating = 0
+		products.Rating_Count = 0
+		products.Rating_Total = 0
+
 		products.Product_ID = primitive.NewObjectID()
-		_, err = ProdCollection.InsertOne(ctx, products)
+		// The unique index of variants.sku refuses a SKU of another product, also when two requests add it at the same moment
+		err = database.AddProduct(ctx, ProdCollection, products)
+		if errors.Is(err, database.ErrSKUExists) {
+			utils.ErrorHandler(c, http.StatusConflict, false, err.Error())
+			return
+		}
 		if err != nil {
-			log.Println(err)
 			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
 			return
 		}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/database"
+	"ecommerce/models"
+	"ecommerce/utils"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var PromotionCollection *mongo.Collection = database.PromotionData(database.Client, "Promotions")
+
+// CreatePromotion :- POST /admin/promotions
+func CreatePromotion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var promotion models.Promotion
+		if err := c.BindJSON(&promotion); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(promotion); validationErr != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, validationErr.Error())
+			return
+		}
+
+		if message := checkPromotion(promotion); message != "" {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, message)
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		promotion, err := database.CreatePromotion(ctx, PromotionCollection, promotion)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusCreated, true, "Promotion created", promotion)
+		ctx.Done()
+	}
+}
+
+// checkPromotion has the rules of every promotion type, an empty message means the promotion is fine
+func checkPromotion(promotion models.Promotion) string {
+	switch promotion.Type {
+	case models.PromotionBuyXGetY:
+		if promotion.Buy_Quantity < 1 || promotion.Get_Quantity < 1 {
+			return "buy_quantity and get_quantity must be at least 1"
+		}
+	case models.PromotionThreshold:
+		if promotion.Percent_Off <= 0 {
+			return "percent_off must be more than 0"
+		}
+	case models.PromotionBundle:
+		if len(promotion.Bundle_Product_IDs) < 2 {
+			return "a bundle needs at least two bundle_product_ids"
+		}
+		seen := make(map[primitive.ObjectID]bool)
+		for _, productId := range promotion.Bundle_Product_IDs {
+			if seen[productId] {
+				return "bundle_product_ids must be different products"
+			}
+			seen[productId] = true
+		}
+		if promotion.Bundle_Price.Amount <= 0 {
+			return "bundle_price must be more than 0"
+		}
+	}
+
+	// Promotions work on the cart lines which are always in the store currency
+	for _, amount := range []models.Money{promotion.Threshold, promotion.Bundle_Price} {
+		if amount.IsNegative() {
+			return "amounts of a promotion can't be negative"
+		}
+		if !amount.IsZero() && amount.Currency != models.DefaultCurrency() {
+			return "amounts of a promotion must be in " + models.DefaultCurrency()
+		}
+	}
+
+	if promotion.Starts_At != nil && promotion.Expires_At != nil && !promotion.Expires_At.After(*promotion.Starts_At) {
+		return "expires_at must be after starts_at"
+	}
+
+	return ""
+}
+
+// ListPromotions :- GET /admin/promotions ; in the order they are applied to a cart
+func ListPromotions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		promotions, err := database.ListPromotions(ctx, PromotionCollection, false)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong. Please try again !")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true, "promotions": promotions})
+		ctx.Done()
+	}
+}
+
+// UpdatePromotionStatus :- PUT /admin/promotions/:promotionId with {"active": false}
+func UpdatePromotionStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "PUT" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		promotionId, err := primitive.ObjectIDFromHex(c.Param("promotionId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid promotion id !")
+			return
+		}
+
+		var body struct {
+			Active *bool `json:"active" binding:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		err = database.SetPromotionActive(ctx, PromotionCollection, promotionId, *body.Active)
+		if errors.Is(err, database.ErrCantFindPromotion) {
+			utils.ErrorHandler(c, http.StatusNotFound, false, err.Error())
+			return
+		}
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Promotion updated", nil)
+		ctx.Done()
+	}
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/models"
+	"ecommerce/notify"
+	"ecommerce/scheduler"
+	"ecommerce/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var CartReminderCollection *mongo.Collection = database.CartReminderData(database.Client, "CartReminders")
+
+// How many carts one run of the task reminds about at most, the rest are picked by the next run
+const cartRemindersPerRun = 100
+
+// AbandonedCartTask is the scheduled task which reminds the users of the carts they left alone
+func AbandonedCartTask() scheduler.Task {
+	hours, err := strconv.Atoi(constants.ABANDONED_CART_HOURS)
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+
+	minutes, err := strconv.Atoi(constants.ABANDONED_CART_CHECK_MINUTES)
+	if err != nil || minutes <= 0 {
+		minutes = 15
+	}
+
+	idleFor := time.Duration(hours) * time.Hour
+
+	return scheduler.Task{
+		Name:     "abandoned-carts",
+		Interval: time.Duration(minutes) * time.Minute,
+		Run: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			defer cancel()
+			return RemindAbandonedCarts(ctx, idleFor)
+		},
+	}
+}
+
+// RemindAbandonedCarts sends one "cart.abandoned" notification for every cart which was not changed for idleFor.
+// The cart is claimed before the notification goes out, so two instances of the service never remind about the same cart twice.
+func RemindAbandonedCarts(ctx context.Context, idleFor time.Duration) error {
+	users, err := database.AbandonedCarts(ctx, UserCollection, idleFor, cartRemindersPerRun)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if user.Cart_Updated_At == nil {
+			continue
+		}
+		cartUpdatedAt := *user.Cart_Updated_At
+
+		claimed, err := database.ClaimCartReminder(ctx, UserCollection, user.ID, cartUpdatedAt)
+		if err != nil || !claimed {
+			continue
+		}
+
+		reminder := models.CartReminder{
+			User_ID:         user.ID.Hex(),
+			Cart_Updated_At: cartUpdatedAt,
+			Items:           len(user.User_Cart),
+			Status:          models.CartReminderSent,
+			Sent_At:         time.Now(),
+		}
+
+		notification := notify.Notification{
+			Event:   models.CartAbandoned,
+			User_ID: user.ID.Hex(),
+			Data: map[string]any{
+				"email":           user.Email,
+				"first_name":      user.First_Name,
+				"items":           user.User_Cart,
+				"cart_updated_at": cartUpdatedAt,
+			},
+			Created_At: time.Now(),
+		}
+
+		if err = Notifier.Notify(ctx, notification); err != nil {
+			log.Println("Error while sending the cart reminder ", err)
+			reminder.Status = models.CartReminderFailed
+			reminder.Error = err.Error()
+			if releaseErr := database.ReleaseCartReminder(ctx, UserCollection, user.ID, cartUpdatedAt); releaseErr != nil {
+				log.Println("Error while releasing the cart reminder ", releaseErr)
+			}
+		}
+
+		if err = database.RecordCartReminder(ctx, CartReminderCollection, reminder); err != nil {
+			log.Println("Error while recording the cart reminder ", err)
+		}
+	}
+
+	return nil
+}
+
+// ListCartReminders :- GET /admin/cart-reminders?userId=.. shows the reminders which were sent, the newest first
+func ListCartReminders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		reminders, err := database.ListCartReminders(ctx, CartReminderCollection, c.Query("userId"), 100)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", reminders)
+		ctx.Done()
+	}
+}
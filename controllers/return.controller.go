@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/models"
+	"ecommerce/utils"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ReturnCollection *mongo.Collection = database.ReturnData(database.Client, "Returns")
+
+// RequestReturn :- POST /returns ; the logged in user asks to send back some lines of one of their orders
+func RequestReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var request models.ReturnRequest
+		if err := c.BindJSON(&request); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, validationErr.Error())
+			return
+		}
+
+		days, err := strconv.Atoi(constants.RETURN_WINDOW_DAYS)
+		if err != nil || days < 0 {
+			days = 30
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		rma, err := database.CreateReturn(ctx, UserCollection, ReturnCollection, c.GetString("uid"), request, time.Duration(days)*24*time.Hour)
+		if err != nil {
+			utils.ErrorHandler(c, returnErrorStatus(err), false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusCreated, true, "Return requested", rma)
+		ctx.Done()
+	}
+}
+
+// ListMyReturns :- GET /returns
+func ListMyReturns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		returns, err := database.ListReturns(ctx, ReturnCollection, bson.D{{Key: "user_id", Value: c.GetString("uid")}})
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong. Please try again !")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true, "returns": returns})
+		ctx.Done()
+	}
+}
+
+// ListReturns :- GET /admin/returns?status=requested
+func ListReturns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		filter := bson.D{}
+		if status := c.Query("status"); status != "" {
+			filter = append(filter, bson.E{Key: "status", Value: status})
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		returns, err := database.ListReturns(ctx, ReturnCollection, filter)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong. Please try again !")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true, "returns": returns})
+		ctx.Done()
+	}
+}
+
+// UpdateReturnStatus :- PUT /admin/returns/:returnId with {"status": "approved", "note": "..."} ;
+// {"status": "refunded", "amount": {"value": "100.00", "currency": "INR"}} refunds less than the value of the lines, e.g. for a damaged item
+func UpdateReturnStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "PUT" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		returnId, err := primitive.ObjectIDFromHex(c.Param("returnId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid return id !")
+			return
+		}
+
+		var body struct {
+			Status string       `json:"status" validate:"required,oneof=approved rejected received refunded"`
+			Note   string       `json:"note" validate:"max=500"`
+			Amount models.Money `json:"amount"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, validationErr.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		rma, err := database.UpdateReturnStatus(ctx, ProdCollection, UserCollection, CouponCollection, ReturnCollection, PaymentProvider, returnId, body.Status, body.Note, body.Amount)
+		if err != nil {
+			utils.ErrorHandler(c, returnErrorStatus(err), false, err.Error())
+			return
+		}
+
+		// The received pieces went back to the stock, a wishlisted variant may be for sale again
+		if rma.Status == models.ReturnReceived {
+			productIds := make([]primitive.ObjectID, 0, len(rma.Lines))
+			for _, line := range rma.Lines {
+				productIds = append(productIds, line.Product_ID)
+			}
+			watchWishlists(productIds)
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Return updated", rma)
+		ctx.Done()
+	}
+}
+
+// returnErrorStatus maps the return errors to the status code, the refund ones come from the payment layer
+func returnErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrCantFindReturn):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrReturnQuantity), errors.Is(err, database.ErrReturnLineNotInCart), errors.Is(err, database.ErrRefundTooLarge):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrOrderNotReturnable), errors.Is(err, database.ErrReturnWindowClosed), errors.Is(err, database.ErrReturnStatus):
+		return http.StatusConflict
+	case errors.Is(err, database.ErrUserIdIsNotValid):
+		return http.StatusUnauthorized
+	}
+	return paymentErrorStatus(err)
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/database"
+	"ecommerce/models"
+	"ecommerce/utils"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ReviewCollection *mongo.Collection = database.ReviewData(database.Client, "Reviews")
+
+// AddReview :- POST /products/:productId/reviews ; the reviewer is the logged in user which the middleware puts in the context
+func AddReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		productId, err := primitive.ObjectIDFromHex(c.Param("productId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid product id !")
+			return
+		}
+
+		userId, err := primitive.ObjectIDFromHex(c.GetString("uid"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusUnauthorized, false, "Not Authorized !")
+			return
+		}
+
+		var review models.Review
+		if err := c.BindJSON(&review); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(review); validationErr != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, validationErr.Error())
+			return
+		}
+
+		review.Product_ID = productId
+		review.User_ID = userId
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		review, err = database.AddReview(ctx, UserCollection, ReviewCollection, review)
+		if errors.Is(err, database.ErrNotPurchased) {
+			utils.ErrorHandler(c, http.StatusForbidden, false, err.Error())
+			return
+		}
+		if errors.Is(err, database.ErrAlreadyReviewed) {
+			utils.ErrorHandler(c, http.StatusConflict, false, err.Error())
+			return
+		}
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusCreated, true, "Thanks ! Your review will be visible after moderation", review)
+		ctx.Done()
+	}
+}
+
+// GetProductReviews :- GET /products/:productId/reviews ; only the approved reviews together with the rating summary
+func GetProductReviews() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		productId, err := primitive.ObjectIDFromHex(c.Param("productId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid product id !")
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var product models.Product
+		err = ProdCollection.FindOne(ctx, bson.D{{Key: "_id", Value: productId}}).Decode(&product)
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusNotFound, false, database.ErrCantFindProduct.Error())
+			return
+		}
+
+		filter := bson.D{{Key: "product_id", Value: productId}, {Key: "status", Value: models.ReviewApproved}}
+		reviews, err := findReviews(ctx, filter)
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong. Please try again !")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":      true,
+			"rating":       product.Rating,
+			"rating_count": product.Rating_Count,
+			"reviews":      reviews,
+		})
+		ctx.Done()
+	}
+}
+
+// ListReviewsAdmin :- GET /admin/reviews?status=pending ; the moderation queue, by default the pending reviews
+func ListReviewsAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		status := c.DefaultQuery("status", models.ReviewPending)
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		reviews, err := findReviews(ctx, bson.D{{Key: "status", Value: status}})
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, "Something went wrong. Please try again !")
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", reviews)
+		ctx.Done()
+	}
+}
+
+// ModerateReview :- PUT /admin/reviews/:reviewId with body {"status": "approved"} or {"status": "rejected"}
+func ModerateReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "PUT" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		reviewId, err := primitive.ObjectIDFromHex(c.Param("reviewId"))
+		if err != nil {
+			log.Println(err)
+			utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid review id !")
+			return
+		}
+
+		var body struct {
+			Status string `json:"status" binding:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		review, err := database.ModerateReview(ctx, ReviewCollection, ProdCollection, reviewId, body.Status)
+		if errors.Is(err, database.ErrInvalidReviewStatus) {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+		if errors.Is(err, database.ErrCantFindReview) {
+			utils.ErrorHandler(c, http.StatusNotFound, false, err.Error())
+			return
+		}
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Review "+review.Status, review)
+		ctx.Done()
+	}
+}
+
+func findReviews(ctx context.Context, filter bson.D) ([]models.Review, error) {
+	reviews := make([]models.Review, 0)
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := ReviewCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return reviews, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &reviews); err != nil {
+		log.Println(err)
+		return reviews, err
+	}
+
+	return reviews, nil
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/database"
+	"ecommerce/shipping"
+	"ecommerce/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShippingQuote :- GET /cart/shipping?addressId= ; the price of every delivery method for the current cart and the address (the first one by default)
+func ShippingQuote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var addressId primitive.ObjectID
+		if addressQueryId := c.Query("addressId"); addressQueryId != "" {
+			var err error
+			addressId, err = primitive.ObjectIDFromHex(addressQueryId)
+			if err != nil {
+				log.Println(err)
+				utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid address id !")
+				return
+			}
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		parcel, err := database.CartParcel(ctx, ProdCollection, UserCollection, CouponCollection, PromotionCollection, c.GetString("uid"), addressId)
+		if err != nil {
+			utils.ErrorHandler(c, checkoutErrorStatus(err), false, err.Error())
+			return
+		}
+
+		quotes := make([]shipping.Quote, 0)
+		if ShippingMethods != nil {
+			quotes = ShippingMethods.QuoteAll(parcel)
+		}
+
+		// The prices are shown in the currency of the request, the same way the checkout converts them
+		for i := range quotes {
+			if quotes[i].Price, err = ExchangeRates.Convert(quotes[i].Price, requestCurrency(c)); err != nil {
+				utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":      true,
+			"weight_grams": parcel.Weight_Grams,
+			"methods":      quotes,
+		})
+		ctx.Done()
+	}
+}
@@ -0,0 +1,322 @@
+package controllers
+
+import (
+	"context"
+	"ecommerce/constants"
+	"ecommerce/database"
+	"ecommerce/models"
+	"ecommerce/notify"
+	"ecommerce/utils"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var WishlistCollection *mongo.Collection = database.WishlistData(database.Client, "Wishlists")
+
+var Notifier notify.Notifier = loadNotifier()
+
+// loadNotifier keeps the events in the log or the file of NOTIFIER and sends their emails and sms through the notification service
+func loadNotifier() notify.Notifier {
+	events, err := notify.New(constants.NOTIFIER, constants.NOTIFY_FILE)
+	if err != nil {
+		log.Println("Error loading the notifier, the notifications only go to the log :- ", err)
+		events = notify.LogNotifier{}
+	}
+	return &deliveryNotifier{events: events}
+}
+
+// ListWishlists :- GET /wishlists
+func ListWishlists() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		wishlists, err := database.ListWishlists(ctx, WishlistCollection, c.GetString("uid"))
+		if err != nil {
+			utils.ErrorHandler(c, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", wishlists)
+		ctx.Done()
+	}
+}
+
+// CreateWishlist :- POST /wishlists with {"name": "Birthday"}
+func CreateWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "POST" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var request models.WishlistRequest
+		if err := c.BindJSON(&request); err != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, err.Error())
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			utils.ErrorHandler(c, http.StatusBadRequest, false, validationErr.Error())
+			return
+		}
+
+		maxWishlists, err := strconv.Atoi(constants.MAX_WISHLISTS)
+		if err != nil || maxWishlists <= 0 {
+			maxWishlists = 20
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		wishlist, err := database.CreateWishlist(ctx, WishlistCollection, c.GetString("uid"), request.Name, maxWishlists)
+		if err != nil {
+			utils.ErrorHandler(c, wishlistErrorStatus(err), false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusCreated, true, "Wishlist created", wishlist)
+		ctx.Done()
+	}
+}
+
+// GetWishlist :- GET /wishlists/:wishlistId
+func GetWishlist() gin.HandlerFunc {
+	return wishlistAction(func(ctx context.Context, c *gin.Context, wishlistId primitive.ObjectID) (models.Wishlist, error) {
+		return database.FindWishlist(ctx, WishlistCollection, c.GetString("uid"), wishlistId)
+	})
+}
+
+// RenameWishlist :- PUT /wishlists/:wishlistId with {"name": "..."}
+func RenameWishlist() gin.HandlerFunc {
+	return wishlistAction(func(ctx context.Context, c *gin.Context, wishlistId primitive.ObjectID) (models.Wishlist, error) {
+		var request models.WishlistRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			return models.Wishlist{}, errBadWishlistRequest
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			return models.Wishlist{}, errBadWishlistRequest
+		}
+		return database.RenameWishlist(ctx, WishlistCollection, c.GetString("uid"), wishlistId, request.Name)
+	})
+}
+
+// DeleteWishlist :- DELETE /wishlists/:wishlistId
+func DeleteWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "DELETE" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		wishlistId, ok := objectIdParam(c, "wishlistId")
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := database.DeleteWishlist(ctx, WishlistCollection, c.GetString("uid"), wishlistId); err != nil {
+			utils.ErrorHandler(c, wishlistErrorStatus(err), false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "Wishlist deleted", nil)
+		ctx.Done()
+	}
+}
+
+// AddWishlistItem :- POST /wishlists/:wishlistId/items?productId=..&variantId=..
+func AddWishlistItem() gin.HandlerFunc {
+	return wishlistAction(func(ctx context.Context, c *gin.Context, wishlistId primitive.ObjectID) (models.Wishlist, error) {
+		productId, err := primitive.ObjectIDFromHex(c.Query("productId"))
+		if err != nil {
+			return models.Wishlist{}, errBadWishlistRequest
+		}
+		variantId, err := primitive.ObjectIDFromHex(c.Query("variantId"))
+		if err != nil {
+			return models.Wishlist{}, errBadWishlistRequest
+		}
+		return database.AddWishlistItem(ctx, ProdCollection, WishlistCollection, c.GetString("uid"), wishlistId, productId, variantId)
+	})
+}
+
+// RemoveWishlistItem :- DELETE /wishlists/:wishlistId/items/:variantId
+func RemoveWishlistItem() gin.HandlerFunc {
+	return wishlistAction(func(ctx context.Context, c *gin.Context, wishlistId primitive.ObjectID) (models.Wishlist, error) {
+		variantId, err := primitive.ObjectIDFromHex(c.Param("variantId"))
+		if err != nil {
+			return models.Wishlist{}, errBadWishlistRequest
+		}
+		return database.RemoveWishlistItem(ctx, WishlistCollection, c.GetString("uid"), wishlistId, variantId)
+	})
+}
+
+// MoveWishlistItemToCart :- POST /wishlists/:wishlistId/items/:variantId/move?quantity=2
+func MoveWishlistItemToCart() gin.HandlerFunc {
+	return wishlistAction(func(ctx context.Context, c *gin.Context, wishlistId primitive.ObjectID) (models.Wishlist, error) {
+		variantId, err := primitive.ObjectIDFromHex(c.Param("variantId"))
+		if err != nil {
+			return models.Wishlist{}, errBadWishlistRequest
+		}
+
+		quantity := 1
+		if quantityQuery := c.Query("quantity"); quantityQuery != "" {
+			quantity, err = strconv.Atoi(quantityQuery)
+			if err != nil || quantity < 1 {
+				return models.Wishlist{}, errBadWishlistRequest
+			}
+		}
+
+		return database.MoveWishlistItemToCart(ctx, ProdCollection, UserCollection, WishlistCollection, c.GetString("uid"), wishlistId, variantId, quantity)
+	})
+}
+
+// ShareWishlist :- POST /wishlists/:wishlistId/share gives the wishlist a read only link
+func ShareWishlist() gin.HandlerFunc {
+	return wishlistAction(func(ctx context.Context, c *gin.Context, wishlistId primitive.ObjectID) (models.Wishlist, error) {
+		return database.ShareWishlist(ctx, WishlistCollection, c.GetString("uid"), wishlistId)
+	})
+}
+
+// UnshareWishlist :- DELETE /wishlists/:wishlistId/share
+func UnshareWishlist() gin.HandlerFunc {
+	return wishlistAction(func(ctx context.Context, c *gin.Context, wishlistId primitive.ObjectID) (models.Wishlist, error) {
+		return database.UnshareWishlist(ctx, WishlistCollection, c.GetString("uid"), wishlistId)
+	})
+}
+
+// GetSharedWishlist :- GET /wishlists/shared/:token is public ; only the name and the items are shown, not the owner or the token
+func GetSharedWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"message": "Request method is invalid !"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		wishlist, err := database.FindSharedWishlist(ctx, WishlistCollection, c.Param("token"))
+		if err != nil {
+			utils.ErrorHandler(c, wishlistErrorStatus(err), false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", gin.H{"name": wishlist.Name, "items": wishlist.Items})
+		ctx.Done()
+	}
+}
+
+var errBadWishlistRequest = errors.New("the request is invalid")
+
+// wishlistAction reads the wishlist id of the url, runs one change of that wishlist and responds with the wishlist
+func wishlistAction(action func(ctx context.Context, c *gin.Context, wishlistId primitive.ObjectID) (models.Wishlist, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistId, ok := objectIdParam(c, "wishlistId")
+		if !ok {
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		wishlist, err := action(ctx, c, wishlistId)
+		if err != nil {
+			utils.ErrorHandler(c, wishlistErrorStatus(err), false, err.Error())
+			return
+		}
+
+		utils.ResponseHandler(c, http.StatusOK, true, "", wishlist)
+		ctx.Done()
+	}
+}
+
+func objectIdParam(c *gin.Context, name string) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param(name))
+	if err != nil {
+		log.Println(err)
+		utils.ErrorHandler(c, http.StatusBadRequest, false, "Invalid "+name+" !")
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+func wishlistErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errBadWishlistRequest), errors.Is(err, database.ErrCantFindVariant), errors.Is(err, database.ErrNotEnoughStock):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrCantFindWishlist), errors.Is(err, database.ErrCantFindWishlistItem), errors.Is(err, database.ErrCantFindProduct):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrTooManyWishlists):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// NotifyWishlists sends the price drop and back in stock notifications for these products (every product when nil).
+// A notification which can't be sent is only logged, the wishlists already saved the change it was about.
+func NotifyWishlists(ctx context.Context, productIds []primitive.ObjectID) error {
+	alerts, err := database.WishlistAlerts(ctx, ProdCollection, WishlistCollection, productIds)
+	if err != nil {
+		return err
+	}
+
+	for _, alert := range alerts {
+		notification := notify.Notification{
+			Event:   alert.Event,
+			User_ID: alert.User_ID,
+			Data: map[string]any{
+				"wishlist_id":   alert.Wishlist_ID.Hex(),
+				"wishlist_name": alert.Wishlist_Name,
+				"item":          alert.Item,
+				"old_price":     alert.Old_Price,
+				"new_price":     alert.Item.Price,
+			},
+			Created_At: time.Now(),
+		}
+
+		if err := Notifier.Notify(ctx, notification); err != nil {
+			log.Println("Error while sending the wishlist notification ", err)
+		}
+	}
+
+	return nil
+}
+
+// Job which compares the wishlists with the catalog
+const wishlistAlertsJob = "wishlist.alerts"
+
+type wishlistAlertsPayload struct {
+	Product_IDs []primitive.ObjectID `bson:"product_ids"` // Every product when empty
+}
+
+func runWishlistAlerts(ctx context.Context, job models.Job) error {
+	var payload wishlistAlertsPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	return NotifyWishlists(ctx, payload.Product_IDs)
+}
+
+// watchWishlists queues the wishlist check, so the admin api which changed the catalog doesn't wait for it and a failed check is retried
+func watchWishlists(productIds []primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := Jobs.Enqueue(ctx, wishlistAlertsJob, wishlistAlertsPayload{Product_IDs: productIds}); err != nil {
+		log.Println("Error while queueing the wishlist check ", err)
+	}
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrTooManyAddresses = errors.New("the address book is full, delete an address first")
+	ErrCantSaveAddress  = errors.New("cannot save the address")
+)
+
+// ListAddresses gives the address book of the user
+func ListAddresses(ctx context.Context, userCollection *mongo.Collection, userQueryID string) ([]models.Address, error) {
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrUserIdIsNotValid
+	}
+
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.D{{Key: "address", Value: 1}})
+	if err = userCollection.FindOne(ctx, bson.D{{Key: "_id", Value: userId}}, opts).Decode(&user); err != nil {
+		log.Println(err)
+		return nil, ErrUserIdIsNotValid
+	}
+
+	if user.Address_Details == nil {
+		return make([]models.Address, 0), nil
+	}
+	return user.Address_Details, nil
+}
+
+// FindAddress gives one address of the address book
+func FindAddress(ctx context.Context, userCollection *mongo.Collection, userQueryID string, addressId primitive.ObjectID) (models.Address, error) {
+	addresses, err := ListAddresses(ctx, userCollection, userQueryID)
+	if err != nil {
+		return models.Address{}, err
+	}
+
+	return savedAddress(models.User{Address_Details: addresses}, addressId)
+}
+
+// AddAddress adds an address to the address book, unless it already has maxAddresses of them.
+// The filter "address.<max - 1> does not exist" checks the count in the same update which pushes, so two requests at once can not pass the limit.
+// The first address of the book is the default shipping and billing address.
+func AddAddress(ctx context.Context, userCollection *mongo.Collection, userQueryID string, address models.Address, maxAddresses int) (models.Address, error) {
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return models.Address{}, ErrUserIdIsNotValid
+	}
+
+	address.Address_ID = primitive.NewObjectID()
+	makeShipping, makeBilling := address.Default_Shipping, address.Default_Billing
+	address.Default_Shipping, address.Default_Billing = false, false
+
+	filter := bson.D{
+		{Key: "_id", Value: userId},
+		{Key: "address." + strconv.Itoa(maxAddresses-1), Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$push", Value: bson.D{{Key: "address", Value: address}}}}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return models.Address{}, ErrCantSaveAddress
+	}
+	if result.MatchedCount == 0 {
+		return models.Address{}, ErrTooManyAddresses
+	}
+
+	if makeShipping || makeBilling {
+		if err = SetDefaultAddress(ctx, userCollection, userId, address.Address_ID, makeShipping, makeBilling); err != nil {
+			return models.Address{}, err
+		}
+	}
+
+	if err = ensureDefaultAddresses(ctx, userCollection, userId); err != nil {
+		return models.Address{}, err
+	}
+
+	return FindAddress(ctx, userCollection, userQueryID, address.Address_ID)
+}
+
+// UpdateAddress replaces the fields of one address, its id stays ; a true default flag makes it the default
+func UpdateAddress(ctx context.Context, userCollection *mongo.Collection, userQueryID string, addressId primitive.ObjectID, address models.Address) (models.Address, error) {
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return models.Address{}, ErrUserIdIsNotValid
+	}
+
+	filter := bson.D{{Key: "_id", Value: userId}, {Key: "address.address_id", Value: addressId}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "address.$.label", Value: address.Label},
+		{Key: "address.$.recipient_name", Value: address.Recipient_Name},
+		{Key: "address.$.phone", Value: address.Phone},
+		{Key: "address.$.house", Value: address.House},
+		{Key: "address.$.street", Value: address.Street},
+		{Key: "address.$.city", Value: address.City},
+		{Key: "address.$.state", Value: address.State},
+		{Key: "address.$.pincode", Value: address.Pincode},
+		{Key: "address.$.country", Value: address.Country},
+	}}}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return models.Address{}, ErrCantSaveAddress
+	}
+	if result.MatchedCount == 0 {
+		return models.Address{}, ErrCantFindAddress
+	}
+
+	if address.Default_Shipping || address.Default_Billing {
+		if err = SetDefaultAddress(ctx, userCollection, userId, addressId, address.Default_Shipping, address.Default_Billing); err != nil {
+			return models.Address{}, err
+		}
+	}
+
+	return FindAddress(ctx, userCollection, userQueryID, addressId)
+}
+
+// DeleteAddress removes one address, when it was a default the first address left takes its place.
+// The orders keep their own copy of the address, so they do not change.
+func DeleteAddress(ctx context.Context, userCollection *mongo.Collection, userQueryID string, addressId primitive.ObjectID) error {
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	filter := bson.D{{Key: "_id", Value: userId}, {Key: "address.address_id", Value: addressId}}
+	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "address", Value: bson.D{{Key: "address_id", Value: addressId}}}}}}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveAddress
+	}
+	if result.MatchedCount == 0 {
+		return ErrCantFindAddress
+	}
+
+	return ensureDefaultAddresses(ctx, userCollection, userId)
+}
+
+// SetDefaultAddress makes one address the default shipping and/or billing address and takes the flag off all the others.
+// The update is an aggregation pipeline, $map rewrites every address of the array in one atomic step.
+func SetDefaultAddress(ctx context.Context, userCollection *mongo.Collection, userId primitive.ObjectID, addressId primitive.ObjectID, shipping bool, billing bool) error {
+	flags := bson.D{}
+	if shipping {
+		flags = append(flags, bson.E{Key: "default_shipping", Value: bson.D{{Key: "$eq", Value: bson.A{"$$a.address_id", addressId}}}})
+	}
+	if billing {
+		flags = append(flags, bson.E{Key: "default_billing", Value: bson.D{{Key: "$eq", Value: bson.A{"$$a.address_id", addressId}}}})
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+
+	filter := bson.D{{Key: "_id", Value: userId}, {Key: "address.address_id", Value: addressId}}
+	return mapAddresses(ctx, userCollection, filter, flags)
+}
+
+// ensureDefaultAddresses gives the default flags to the first address when no address has them, e.g. after the default one was deleted
+func ensureDefaultAddresses(ctx context.Context, userCollection *mongo.Collection, userId primitive.ObjectID) error {
+	first := bson.D{{Key: "$arrayElemAt", Value: bson.A{"$address.address_id", 0}}}
+	flag := func(field string) bson.D {
+		return bson.D{{Key: "$or", Value: bson.A{
+			"$$a." + field,
+			bson.D{{Key: "$and", Value: bson.A{
+				bson.D{{Key: "$not", Value: bson.A{bson.D{{Key: "$in", Value: bson.A{true, "$address." + field}}}}}},
+				bson.D{{Key: "$eq", Value: bson.A{"$$a.address_id", first}}},
+			}}},
+		}}}
+	}
+
+	flags := bson.D{
+		{Key: "default_shipping", Value: flag("default_shipping")},
+		{Key: "default_billing", Value: flag("default_billing")},
+	}
+
+	filter := bson.D{{Key: "_id", Value: userId}, {Key: "address.0", Value: bson.D{{Key: "$exists", Value: true}}}}
+	return mapAddresses(ctx, userCollection, filter, flags)
+}
+
+func mapAddresses(ctx context.Context, userCollection *mongo.Collection, filter bson.D, fields bson.D) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "address", Value: bson.D{{Key: "$map", Value: bson.D{
+			{Key: "input", Value: "$address"},
+			{Key: "as", Value: "a"},
+			{Key: "in", Value: bson.D{{Key: "$mergeObjects", Value: bson.A{"$$a", fields}}}},
+		}}}}}}},
+	}
+
+	if _, err := userCollection.UpdateOne(ctx, filter, pipeline); err != nil {
+		log.Println(err)
+		return ErrCantSaveAddress
+	}
+	return nil
+}
@@ -2,9 +2,15 @@ package database
 
 import (
 	"context"
+	"ecommerce/exchange"
 	"ecommerce/models"
+	"ecommerce/payment"
+	"ecommerce/pricing"
+	"ecommerce/shipping"
+	"ecommerce/tax"
 	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -21,36 +27,49 @@ var (
 	ErrCantRemoveItemFromCart = errors.New("cannot remove this item from the cart")
 	ErrCantGetItem            = errors.New("was unable to get the items from the cart")
 	ErrCantBuyCartItem        = errors.New("cannot update the purchase")
+	ErrCantFindVariant        = errors.New("can't find this variant of the product")
+	ErrNotEnoughStock         = errors.New("not enough stock for this variant")
+	ErrCartIsEmpty            = errors.New("the cart is empty")
+	ErrCartChangedInCheckout  = errors.New("the cart changed while the order was placed, check the cart and try again")
+	ErrCantFindAddress        = errors.New("can't find this address")
 )
 
+// Checkout has the choices of the customer and the services the checkout works with
+type Checkout struct {
+	Currency string // Currency the order is priced and paid in
+	Rates    *exchange.RateStore
+	Tax      tax.Calculator // nil places the order without tax
+
+	Shipping_Address_ID primitive.ObjectID // A saved address of the user, the zero id picks the default shipping address
+	Billing_Address_ID  primitive.ObjectID // The zero id picks the default billing address
+	Payment             models.Payment
+	Coupon_Code         *string // Replaces the coupon of the cart when it is not nil, "" removes it
+
+	Shipping        *shipping.Config // nil ships every order for free
+	Shipping_Method string           // Code of the delivery method, the first method of the config when empty
+
+	Payments payment.Provider // Gateway of the digital payments, nil refuses them
+}
+
 // Database Level Function
 
-func AddProductToCart(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, productId primitive.ObjectID, userQueryID string) error {
+func AddProductToCart(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, productId primitive.ObjectID, variantId primitive.ObjectID, quantity int, userQueryID string) error {
 
-	find := bson.M{"_id": productId}
-	searchFromDB, err := prodCollection.Find(ctx, find)
+	var product models.Product
+	err := prodCollection.FindOne(ctx, bson.D{{Key: "_id", Value: productId}}).Decode(&product)
 	if err != nil {
 		log.Println(err)
 		return ErrCantFindProduct
 	}
 
-	var productCart []models.ProductUser
-
-	for searchFromDB.Next(ctx) {
-		var product models.ProductUser
-		if err := searchFromDB.Decode(&product); err != nil {
-			log.Println(err)
-			return ErrCantDecodeProducts
-		}
-
-		productCart = append(productCart, product)
+	variant, err := FindVariant(product, variantId)
+	if err != nil {
+		return err
 	}
 
-	if err = searchFromDB.Err(); err != nil {
-		log.Println(err)
-		return ErrCantDecodeProducts
+	if variant.Stock == nil || *variant.Stock < int64(quantity) {
+		return ErrNotEnoughStock
 	}
-	defer searchFromDB.Close(ctx)
 
 	userId, err := primitive.ObjectIDFromHex(userQueryID)
 	if err != nil {
@@ -58,20 +77,57 @@ func AddProductToCart(ctx context.Context, prodCollection *mongo.Collection, use
 		return ErrUserIdIsNotValid
 	}
 
-	filter := bson.D{{Key: "_id", Value: userId}}
-	update := bson.D{{Key: "$push", Value: bson.D{{Key: "user_cart", Value: bson.D{{Key: "$each", Value: productCart}}}}}} // for pushing multiple products,
+	// The cart may hold this variant already, the pieces in the cart and the new ones together must fit in the stock
+	leftForCart := *variant.Stock - int64(quantity)
 
-	_, err = userCollection.UpdateOne(ctx, filter, update)
+	return withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
 
-	if err != nil {
-		log.Println(err)
-		return ErrCantUpdateUser
-	}
+		// If the variant is already in the cart just increase its quantity, the positional operator $ points to the matched cart line.
+		// The price of the line is left alone :- a price which moved is shown in the cart changes and only taken when the customer acknowledges it.
+		// The quantity is checked in the same filter, so two requests at once can't both add the last pieces.
+		filter := bson.D{
+			{Key: "_id", Value: userId},
+			{Key: "user_cart", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+				{Key: "variant_id", Value: variantId},
+				{Key: "quantity", Value: bson.D{{Key: "$lte", Value: leftForCart}}},
+			}}}},
+		}
+		update := bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "user_cart.$.quantity", Value: quantity}}},
+			{Key: "$set", Value: bson.D{cartUpdatedAt()}},
+		}
 
-	return nil
+		result, err := userCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			log.Println(err)
+			return nil, ErrCantUpdateUser
+		}
+
+		if result.MatchedCount == 0 {
+			// Otherwise push a brand new line for this variant, only when the cart really has no line of it
+			filter = bson.D{{Key: "_id", Value: userId}, {Key: "user_cart.variant_id", Value: bson.D{{Key: "$ne", Value: variantId}}}}
+			update = bson.D{
+				{Key: "$push", Value: bson.D{{Key: "user_cart", Value: NewCartLine(product, variant, quantity)}}},
+				{Key: "$set", Value: bson.D{cartUpdatedAt()}},
+			}
+
+			result, err = userCollection.UpdateOne(ctx, filter, update)
+			if err != nil {
+				log.Println(err)
+				return nil, ErrCantUpdateUser
+			}
+
+			// The cart has the variant already and with the new pieces it would hold more than the stock
+			if result.MatchedCount == 0 {
+				return nil, ErrNotEnoughStock
+			}
+		}
+
+		return eventList(cartEvent(userId, models.CartItemAdded, variantId, quantity))
+	})
 }
 
-func RemoveCartItem(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, productId primitive.ObjectID, userQueryID string) error {
+func RemoveCartItem(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, variantId primitive.ObjectID, userQueryID string) error {
 
 	userId, err := primitive.ObjectIDFromHex(userQueryID)
 	if err != nil {
@@ -79,159 +135,687 @@ func RemoveCartItem(ctx context.Context, prodCollection *mongo.Collection, userC
 		return ErrUserIdIsNotValid
 	}
 
-	filter := bson.D{{Key: "_id", Value: userId}}
-	update := bson.M{"$pull": bson.M{"user_cart": bson.M{"_id": productId}}} // Removes specific elements from an array that match a condition.
-	_, err = userCollection.UpdateMany(ctx, filter, update)
-	if err != nil {
-		log.Println(err)
-		return ErrCantRemoveItemFromCart
-	}
+	return withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+		filter := bson.D{{Key: "_id", Value: userId}}
+		update := bson.M{"$pull": bson.M{"user_cart": bson.M{"variant_id": variantId}}, "$set": bson.D{cartUpdatedAt()}} // Removes specific elements from an array that match a condition.
+		_, err := userCollection.UpdateMany(ctx, filter, update)
+		if err != nil {
+			log.Println(err)
+			return nil, ErrCantRemoveItemFromCart
+		}
 
-	return nil
+		return eventList(cartEvent(userId, models.CartItemRemoved, variantId, 0))
+	})
 }
 
-func BuyItemFromCart(ctx context.Context, userCollection *mongo.Collection, userQueryId string) error {
+// BuyItemFromCart places the order of the cart ; a digital order also gets its payment at the gateway, the customer pays it with the returned intent
+func BuyItemFromCart(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, promotionCollection *mongo.Collection, userQueryId string, checkout Checkout) (models.Order, *payment.Intent, error) {
 
 	userId, err := primitive.ObjectIDFromHex(userQueryId)
 	if err != nil {
 		log.Println(err)
-		return ErrUserIdIsNotValid
+		return models.Order{}, nil, ErrUserIdIsNotValid
 	}
 
 	var getCartItems models.User
 	var orderCart models.Order
 
+	// Fetch the cart items from the user collection ; Retrieves the current state of the user's cart purpose to get User_Cart items.
+	find := bson.D{{Key: "_id", Value: userId}}
+	err = userCollection.FindOne(ctx, find).Decode(&getCartItems)
+	if err != nil {
+		log.Println(err)
+		return models.Order{}, nil, ErrCantGetItem
+	}
+
+	if len(getCartItems.User_Cart) == 0 {
+		return models.Order{}, nil, ErrCartIsEmpty
+	}
+
+	// The cart is bought only at the prices the customer saw ; a changed price or a gone product has to be acknowledged first
+	changes, err := ReviewCart(ctx, prodCollection, getCartItems.User_Cart)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+	if len(changes) > 0 {
+		return models.Order{}, nil, &CartChangedError{Changes: changes}
+	}
+
+	address, billing, err := checkoutAddresses(getCartItems, checkout)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+
 	// Making an order information for user
 	orderCart.Order_ID = primitive.NewObjectID()
 	orderCart.Ordered_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	orderCart.Order_Cart = make([]models.ProductUser, 0)
-	orderCart.Payment_Method.COD = true
-
-	// Aggregate Total Price of Items in User Cart
-	// path tell us where do you want to unwind either array or slice
-	unwind := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$user_cart"}}}}
-	grouping := bson.D{{Key: "$group", Value: bson.D{
-		{Key: "_id", Value: "$_id"},
-		{Key: "total", Value: bson.D{
-			{Key: "$sum", Value: "$user_cart.price"},
-		}},
-	},
-	}}
-
-	cursor, err := userCollection.Aggregate(ctx, mongo.Pipeline{unwind, grouping})
+	orderCart.Order_Cart = getCartItems.User_Cart
+	orderCart.Payment_Method = checkout.Payment
+	orderCart.Shipping_Address = address
+	orderCart.Billing_Address = billing
+
+	// The coupon of the checkout request wins over the one applied to the cart
+	couponCode := getCartItems.Cart_Coupon
+	if checkout.Coupon_Code != nil {
+		couponCode = checkoutCoupon(checkout.Coupon_Code)
+	}
+
+	// The promotions and the coupon are priced again with the cart of this moment, the cart may have changed since the coupon was applied
+	quote, coupon, err := PriceCart(ctx, prodCollection, couponCollection, promotionCollection, userQueryId, getCartItems.User_Cart, couponCode)
 	if err != nil {
-		log.Println(err)
-		return ErrCantBuyCartItem
+		return models.Order{}, nil, err
+	}
+	if quote.CouponErr != nil {
+		return models.Order{}, nil, quote.CouponErr
+	}
+	if err = checkGuestCoupon(getCartItems, coupon); err != nil {
+		return models.Order{}, nil, err
 	}
 
-	var allItemsAddition []bson.M
+	applyQuote(&orderCart, quote)
 
-	if err = cursor.All(ctx, &allItemsAddition); err != nil {
-		panic(err)
+	if err = applyShipping(&orderCart, checkout, NewParcel(orderCart.Order_Cart, address, quote)); err != nil {
+		return models.Order{}, nil, err
 	}
 
-	if err = cursor.Err(); err != nil {
-		log.Println(err)
-		return ErrCantBuyCartItem
+	if err = applyTax(ctx, &orderCart, quote.Lines, address, checkout.Tax); err != nil {
+		return models.Order{}, nil, err
 	}
-	defer cursor.Close(ctx)
 
-	var total_price int32
+	if err = convertOrder(&orderCart, checkout.Currency, checkout.Rates); err != nil {
+		return models.Order{}, nil, err
+	}
 
-	for _, user_item := range allItemsAddition {
-		price := user_item["total"]
-		// Below uses a type assertion to convert the price value (which is user_item["total"]) to the type int32.
-		// If price is not of type int32, this assertion will cause a runtime panic.
-		total_price = price.(int32) // Price we got, converted to int32
+	// Take the stock out from every variant before placing the order ; if one line fails give back what we already took
+	reserved := make([]models.ProductUser, 0, len(orderCart.Order_Cart))
+	redeemed := false
+	release := func() {
+		for _, done := range reserved {
+			ReleaseVariantStock(ctx, prodCollection, done)
+		}
+		if redeemed {
+			ReleaseCoupon(ctx, couponCollection, *coupon, userQueryId)
+		}
 	}
 
-	orderCart.Price = int(total_price)
+	for _, line := range orderCart.Order_Cart {
+		if err = ReserveVariantStock(ctx, prodCollection, line); err != nil {
+			release()
+			return models.Order{}, nil, err
+		}
+		reserved = append(reserved, line)
+	}
 
-	// Insert the Order into the User's order list
-	filter := bson.D{{Key: "_id", Value: userId}}
-	update := bson.D{{Key: "$push", Value: bson.D{{Key: "orders", Value: orderCart}}}}
+	if coupon != nil {
+		if err = RedeemCoupon(ctx, couponCollection, *coupon, userQueryId); err != nil {
+			release()
+			return models.Order{}, nil, err
+		}
+		redeemed = true
+	}
 
-	_, err = userCollection.UpdateMany(ctx, filter, update)
+	intent, err := startPayment(ctx, &orderCart, checkout.Payments)
 	if err != nil {
-		log.Println(err)
-		return ErrCantBuyCartItem
+		release()
+		return models.Order{}, nil, err
 	}
 
-	// Fetch the cart items from the user collection ; Retrieves the current state of the user's cart purpose to get User_Cart items.
-	find := bson.D{{Key: "_id", Value: userId}}
-	err = userCollection.FindOne(ctx, find).Decode(&getCartItems)
+	// Insert the Order into the User's order list and Clear the User's Cart and coupon in the same update.
+	// Only the cart which was priced is bought :- every change of the cart moves cart_updated_at, so a line added in the meantime
+	// or a second checkout of the same cart does not match and nothing is pushed (a cart never changed has no cart_updated_at, nil matches that)
+	filter := bson.D{
+		{Key: "_id", Value: userId},
+		{Key: "cart_updated_at", Value: getCartItems.Cart_Updated_At},
+		{Key: "cart_coupon", Value: getCartItems.Cart_Coupon},
+	}
+	update := bson.D{
+		{Key: "$push", Value: bson.D{{Key: "orders", Value: orderCart}}},
+		{Key: "$set", Value: bson.D{{Key: "user_cart", Value: make([]models.ProductUser, 0)}, cartUpdatedAt()}},
+		{Key: "$unset", Value: bson.D{{Key: "cart_coupon", Value: ""}}},
+	}
+
+	// The order and the emptied cart are saved with their events, other services hear about the order only when it is really placed
+	err = withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+		result, err := userCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			log.Println(err)
+			return nil, ErrCantBuyCartItem
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrCartChangedInCheckout
+		}
+		return eventList(orderEvent(userId, orderCart), cartEvent(userId, models.CartCheckedOut, primitive.NilObjectID, 0))
+	})
 	if err != nil {
-		log.Println(err)
-		return ErrCantGetItem
+		release()
+		voidPayment(ctx, checkout.Payments, intent)
+		if errors.Is(err, ErrCartChangedInCheckout) {
+			return models.Order{}, nil, err
+		}
+		return models.Order{}, nil, ErrCantBuyCartItem
 	}
 
-	// Add Cart Items (which retrieves from getCartItems) to the Order's Cart
-	filter2 := bson.D{{Key: "_id", Value: userId}}
-	// 	Use orders.$[].order_list to update all orders.
-	// Use orders.$[<identifier>].order_list with arrayFilters for selective updates.
-	update2 := bson.M{"$push": bson.M{"orders.$[].order_list": bson.M{"$each": getCartItems.User_Cart}}}
+	return orderCart, intent, nil
+}
+
+func InstantBuyer(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, promotionCollection *mongo.Collection, productId primitive.ObjectID, variantId primitive.ObjectID, userQueryID string, checkout Checkout) (models.Order, *payment.Intent, error) {
 
-	_, err = userCollection.UpdateOne(ctx, filter2, update2)
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
 	if err != nil {
 		log.Println(err)
-		return ErrCantUpdateUser
+		return models.Order{}, nil, ErrUserIdIsNotValid
 	}
 
-	//  Deleting / Updating / Clear the User's Cart after transferng user cart items to the order's cart
-	// Empty the UserCart after completing the purchase.
-	usercart_empty := make([]models.ProductUser, 0)
-	filter3 := bson.D{{Key: "_id", Value: userId}}
-	update3 := bson.D{{Key: "$set", Value: bson.D{{Key: "user_cart", Value: usercart_empty}}}}
+	var product models.Product
+	var orders_detail models.Order
+	var buyer models.User
 
-	_, err = userCollection.UpdateOne(ctx, filter3, update3)
+	err = userCollection.FindOne(ctx, bson.D{{Key: "_id", Value: userId}}).Decode(&buyer)
 	if err != nil {
 		log.Println(err)
-		return ErrCantBuyCartItem
+		return models.Order{}, nil, ErrUserIdIsNotValid
 	}
 
-	return nil
-}
-
-func InstantBuyer(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, productId primitive.ObjectID, userQueryID string) error {
+	address, billing, err := checkoutAddresses(buyer, checkout)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
 
-	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	// Find that specific product by the id which user want to buy
+	err = prodCollection.FindOne(ctx, bson.D{{Key: "_id", Value: productId}}).Decode(&product)
 	if err != nil {
 		log.Println(err)
-		return ErrUserIdIsNotValid
+		return models.Order{}, nil, ErrCantDecodeProducts
 	}
 
-	var product_details models.ProductUser
-	var orders_detail models.Order
+	variant, err := FindVariant(product, variantId)
+	if err != nil {
+		return models.Order{}, nil, err
+	}
+
+	line := NewCartLine(product, variant, 1)
 
 	orders_detail.Order_ID = primitive.NewObjectID()
 	orders_detail.Ordered_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	orders_detail.Order_Cart = make([]models.ProductUser, 0)
-	orders_detail.Payment_Method.COD = true
+	orders_detail.Order_Cart = []models.ProductUser{line}
+	orders_detail.Payment_Method = checkout.Payment
+	orders_detail.Shipping_Address = address
+	orders_detail.Billing_Address = billing
 
-	// Find that specific product by the id which user want to add them into their cart
-	err = prodCollection.FindOne(ctx, bson.D{{Key: "_id", Value: productId}}).Decode(&product_details)
+	// The automatic promotions work for an instant buy as well and the coupon only comes from the checkout request, the cart coupon is for the cart
+	quote, coupon, err := PriceCart(ctx, prodCollection, couponCollection, promotionCollection, userQueryID, orders_detail.Order_Cart, checkoutCoupon(checkout.Coupon_Code))
 	if err != nil {
-		log.Println(err)
-		return ErrCantDecodeProducts
+		return models.Order{}, nil, err
+	}
+	if quote.CouponErr != nil {
+		return models.Order{}, nil, quote.CouponErr
+	}
+	applyQuote(&orders_detail, quote)
+
+	if err = applyShipping(&orders_detail, checkout, NewParcel(orders_detail.Order_Cart, address, quote)); err != nil {
+		return models.Order{}, nil, err
+	}
+
+	if err = applyTax(ctx, &orders_detail, quote.Lines, address, checkout.Tax); err != nil {
+		return models.Order{}, nil, err
+	}
+
+	if err = convertOrder(&orders_detail, checkout.Currency, checkout.Rates); err != nil {
+		return models.Order{}, nil, err
+	}
+
+	if err = ReserveVariantStock(ctx, prodCollection, line); err != nil {
+		return models.Order{}, nil, err
+	}
+
+	if coupon != nil {
+		if err = RedeemCoupon(ctx, couponCollection, *coupon, userQueryID); err != nil {
+			ReleaseVariantStock(ctx, prodCollection, line)
+			return models.Order{}, nil, err
+		}
+	}
+
+	release := func() {
+		ReleaseVariantStock(ctx, prodCollection, line)
+		if coupon != nil {
+			ReleaseCoupon(ctx, couponCollection, *coupon, userQueryID)
+		}
+	}
+
+	intent, err := startPayment(ctx, &orders_detail, checkout.Payments)
+	if err != nil {
+		release()
+		return models.Order{}, nil, err
 	}
 
 	// Add Orders Details into the usercollection order's
 	filter := bson.D{{Key: "_id", Value: userId}}
 	update := bson.D{{Key: "$push", Value: bson.D{{Key: "orders", Value: orders_detail}}}}
-	_, err = userCollection.UpdateOne(ctx, filter, update)
+	err = withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+		if _, err := userCollection.UpdateOne(ctx, filter, update); err != nil {
+			log.Println(err)
+			return nil, ErrCantUpdateUser
+		}
+		return eventList(orderEvent(userId, orders_detail))
+	})
+	if err != nil {
+		release()
+		voidPayment(ctx, checkout.Payments, intent)
+		return models.Order{}, nil, ErrCantUpdateUser
+	}
+
+	return orders_detail, intent, nil
+}
+
+// applyQuote copies the price of the cart into the order
+func applyQuote(order *models.Order, quote pricing.CartQuote) {
+	order.Subtotal = quote.Subtotal
+	order.Adjustments = quote.Adjustments
+	order.Discount = quote.Discount
+	order.Price = quote.Total
+	order.Free_Shipping = quote.Free_Shipping
+	if quote.Coupon != nil {
+		order.Coupon_Code = &quote.Coupon.Code
+	}
+}
+
+// startPayment sets the status of a new order ; a digital order opens its payment at the gateway and waits for it,
+// a cash on delivery order is placed straight away
+func startPayment(ctx context.Context, order *models.Order, provider payment.Provider) (*payment.Intent, error) {
+	order.Payment_Method.Captured = models.NewMoney(0, order.Price.Currency)
+	order.Payment_Method.Refunded = models.NewMoney(0, order.Price.Currency)
+	order.Refunded = models.NewMoney(0, order.Price.Currency)
+
+	if !order.Payment_Method.Digital {
+		order.Status = models.OrderPlaced
+		return nil, nil
+	}
+
+	// Nothing to pay, e.g. a coupon took the whole amount
+	if order.Price.Amount == 0 {
+		order.Status = models.OrderPaid
+		return nil, nil
+	}
+
+	if provider == nil {
+		return nil, payment.ErrPaymentUnavailable
+	}
+
+	intent, err := provider.CreateIntent(ctx, order.Order_ID.Hex(), order.Price)
+	if err != nil {
+		log.Println(err)
+		return nil, payment.ErrPaymentUnavailable
+	}
+
+	order.Status = models.OrderPendingPayment
+	order.Payment_Method.Provider = provider.Name()
+	order.Payment_Method.Intent_ID = intent.ID
+	order.Payment_Method.Status = intent.Status
+
+	return &intent, nil
+}
+
+// voidPayment cancels the payment of an order which could not be saved
+func voidPayment(ctx context.Context, provider payment.Provider, intent *payment.Intent) {
+	if provider == nil || intent == nil {
+		return
+	}
+	if _, err := provider.Void(ctx, intent.ID); err != nil {
+		log.Println("Error while voiding the payment ", err)
+	}
+}
+
+// shippingAddress picks the address a cart quote ships to, the zero id picks the default shipping address of the user.
+// A user without any address gets the rates and the tax rules which are not tied to a region.
+func shippingAddress(user models.User, addressId primitive.ObjectID) (models.Address, error) {
+	if addressId.IsZero() {
+		if address, ok := defaultAddress(user, false); ok {
+			return address, nil
+		}
+		return models.Address{}, nil
+	}
+
+	return savedAddress(user, addressId)
+}
+
+// checkoutAddresses finds the shipping and billing addresses of the checkout in the address book of the user.
+// Without an id the default address is used ; the billing address falls back to the shipping address.
+// The order keeps a copy of both, so they are always looked up in the user document and never taken from the request.
+func checkoutAddresses(user models.User, checkout Checkout) (models.Address, models.Address, error) {
+	address, err := checkoutAddress(user, checkout.Shipping_Address_ID)
+	if err != nil {
+		return models.Address{}, models.Address{}, err
+	}
+
+	if checkout.Billing_Address_ID.IsZero() {
+		if billing, ok := defaultAddress(user, true); ok {
+			return address, billing, nil
+		}
+		return address, address, nil
+	}
+
+	billing, err := savedAddress(user, checkout.Billing_Address_ID)
+	if err != nil {
+		return models.Address{}, models.Address{}, err
+	}
+
+	return address, billing, nil
+}
+
+func checkoutAddress(user models.User, addressId primitive.ObjectID) (models.Address, error) {
+	if !addressId.IsZero() {
+		return savedAddress(user, addressId)
+	}
+	if address, ok := defaultAddress(user, false); ok {
+		return address, nil
+	}
+	return models.Address{}, ErrCantFindAddress
+}
+
+// defaultAddress is the address with the default flag, or the first address of the book for the ones saved before the flags existed
+func defaultAddress(user models.User, billing bool) (models.Address, bool) {
+	for _, address := range user.Address_Details {
+		if (billing && address.Default_Billing) || (!billing && address.Default_Shipping) {
+			return address, true
+		}
+	}
+	if len(user.Address_Details) > 0 {
+		return user.Address_Details[0], true
+	}
+	return models.Address{}, false
+}
+
+func savedAddress(user models.User, addressId primitive.ObjectID) (models.Address, error) {
+	for _, address := range user.Address_Details {
+		if !addressId.IsZero() && address.Address_ID == addressId {
+			return address, nil
+		}
+	}
+
+	return models.Address{}, ErrCantFindAddress
+}
+
+// checkoutCoupon turns the coupon code of the checkout request into the code to price with, an empty code means no coupon
+func checkoutCoupon(code *string) *string {
+	if code == nil || strings.TrimSpace(*code) == "" {
+		return nil
+	}
+	return code
+}
+
+// NewParcel describes the cart for the shipping rates :- the weight of all the pieces and the amount after the discounts
+func NewParcel(lines []models.ProductUser, address models.Address, quote pricing.CartQuote) shipping.Parcel {
+	parcel := shipping.Parcel{
+		Address:       address,
+		Order_Amount:  quote.Total,
+		Free_Shipping: quote.Free_Shipping,
+	}
+
+	for _, line := range lines {
+		parcel.Weight_Grams += line.Weight_Grams * int64(cartLineQuantity(line))
+	}
+
+	return parcel
+}
+
+// applyShipping prices the delivery method the customer picked and adds it to the order total
+func applyShipping(order *models.Order, checkout Checkout, parcel shipping.Parcel) error {
+	order.Shipping = models.Shipping{Weight_Grams: parcel.Weight_Grams, Price: models.NewMoney(0, order.Subtotal.Currency)}
+
+	if checkout.Shipping == nil {
+		return nil
+	}
+
+	method := checkout.Shipping_Method
+	if method == "" {
+		method = checkout.Shipping.DefaultMethod()
+	}
+
+	quote, err := checkout.Shipping.QuoteMethod(method, parcel)
+	if err != nil {
+		return err
+	}
+
+	order.Shipping.Method = quote.Method
+	order.Shipping.Name = quote.Name
+	order.Shipping.Zone = quote.Zone
+	order.Shipping.Delivery_Days = quote.Delivery_Days
+	order.Shipping.Price = quote.Price
+	order.Price = order.Price.Add(quote.Price)
+
+	return nil
+}
+
+// applyTax charges the tax on what is left of every line after all its discounts.
+// Exclusive tax is added on top of the order total, inclusive tax is already inside the prices and is only written down.
+func applyTax(ctx context.Context, order *models.Order, lines []pricing.Line, address models.Address, calculator tax.Calculator) error {
+	order.Tax_Lines = make([]models.TaxLine, 0)
+	order.Tax = models.NewMoney(0, order.Subtotal.Currency)
+
+	if calculator == nil {
+		return nil
+	}
+
+	request := tax.Request{Address: address, Lines: make([]tax.Line, 0, len(lines))}
+	for _, line := range lines {
+		request.Lines = append(request.Lines, tax.Line{Variant_ID: line.Variant_ID, Tax_Class: line.Tax_Class, Amount: line.Net()})
+	}
+
+	result, err := calculator.Calculate(ctx, request)
 	if err != nil {
 		log.Println(err)
-		return ErrCantUpdateUser
+		return err
+	}
+
+	order.Tax_Lines = result.Lines
+	order.Tax = result.Total
+	order.Tax_Inclusive = result.Inclusive
+	if !result.Inclusive {
+		order.Price = order.Price.Add(order.Tax)
+	}
+
+	return nil
+}
+
+// convertOrder prices the order in the currency the customer picked and records the rate used.
+// Every line is converted on its own (or takes the fixed price of the admin) and the subtotal is the sum of the converted lines,
+// so the subtotal always matches the lines the customer sees. The store currency total stays in Base_Price.
+func convertOrder(order *models.Order, orderCurrency string, rates *exchange.RateStore) error {
+	order.Base_Price = order.Price
+
+	rate, err := rates.Rate(orderCurrency)
+	if err != nil {
+		return err
+	}
+
+	order.Currency = strings.ToUpper(orderCurrency)
+	order.Exchange_Rate = rate
+
+	if order.Currency == order.Price.Currency {
+		return nil
 	}
 
-	// Add Product Details into the User's Order.Order_Cart
-	filter2 := bson.D{{Key: "_id", Value: userId}}
-	update2 := bson.M{"$push": bson.M{"orders.$[].order_list": product_details}}
-	_, err = userCollection.UpdateOne(ctx, filter2, update2)
+	subtotal := models.NewMoney(0, order.Currency)
+	for i, line := range order.Order_Cart {
+		price, err := rates.Price(line.Price, line.Price_Overrides, order.Currency)
+		if err != nil {
+			return err
+		}
+
+		order.Order_Cart[i].Price = price
+		subtotal = subtotal.Add(price.Mul(int64(cartLineQuantity(line))))
+	}
+
+	// Every adjustment is converted on its own and the discount is their sum again
+	discount := models.NewMoney(0, order.Currency)
+	for i, adjustment := range order.Adjustments {
+		amount, err := rates.Convert(adjustment.Amount, order.Currency)
+		if err != nil {
+			return err
+		}
+
+		order.Adjustments[i].Amount = amount
+		discount = discount.Add(amount)
+	}
+
+	// A fixed price override can make the converted subtotal smaller than the converted discount
+	if discount.Cmp(subtotal) > 0 {
+		discount = subtotal
+	}
+
+	taxTotal := models.NewMoney(0, order.Currency)
+	for i, taxLine := range order.Tax_Lines {
+		if order.Tax_Lines[i].Taxable, err = rates.Convert(taxLine.Taxable, order.Currency); err != nil {
+			return err
+		}
+		if order.Tax_Lines[i].Amount, err = rates.Convert(taxLine.Amount, order.Currency); err != nil {
+			return err
+		}
+		taxTotal = taxTotal.Add(order.Tax_Lines[i].Amount)
+	}
+
+	if order.Shipping.Price, err = rates.Convert(order.Shipping.Price, order.Currency); err != nil {
+		return err
+	}
+
+	order.Subtotal = subtotal
+	order.Discount = discount
+	order.Tax = taxTotal
+	order.Price = subtotal.Sub(discount).Add(order.Shipping.Price)
+	if !order.Tax_Inclusive {
+		order.Price = order.Price.Add(taxTotal)
+	}
+	return nil
+}
+
+// FindVariant picks the variant out of the product's variants list
+func FindVariant(product models.Product, variantId primitive.ObjectID) (models.Variant, error) {
+	for _, variant := range product.Variants {
+		if variant.Variant_ID == variantId {
+			return variant, nil
+		}
+	}
+
+	return models.Variant{}, ErrCantFindVariant
+}
+
+// NewCartLine copies the product and variant details which we want to show in the cart and keep in the order
+func NewCartLine(product models.Product, variant models.Variant, quantity int) models.ProductUser {
+	return models.ProductUser{
+		Product_ID:      product.Product_ID,
+		Variant_ID:      variant.Variant_ID,
+		SKU:             variant.SKU,
+		Product_Name:    product.Product_Name,
+		Attributes:      variant.Attributes,
+		Price:           variant.Price,
+		Price_Overrides: variant.Price_Overrides,
+		Quantity:        quantity,
+		Weight_Grams:    variant.Weight_Grams,
+		Rating:          product.Rating,
+		Image:           variant.Image,
+		Priced_At:       time.Now(),
+	}
+}
+
+// cartUpdatedAt marks when the cart was changed last, the abandoned cart reminders count from it
+func cartUpdatedAt() bson.E {
+	return bson.E{Key: "cart_updated_at", Value: time.Now()}
+}
+
+// cartLinePrice sets the catalog details of the line on the cart line matched by the positional operator $, the quantity is left alone
+func cartLinePrice(line models.ProductUser) bson.D {
+	return bson.D{
+		{Key: "user_cart.$.sku", Value: line.SKU},
+		{Key: "user_cart.$.product_name", Value: line.Product_Name},
+		{Key: "user_cart.$.price", Value: line.Price},
+		{Key: "user_cart.$.price_overrides", Value: line.Price_Overrides},
+		{Key: "user_cart.$.weight_grams", Value: line.Weight_Grams},
+		{Key: "user_cart.$.image", Value: line.Image},
+		{Key: "user_cart.$.priced_at", Value: line.Priced_At},
+	}
+}
+
+// ReserveVariantStock decrements the variant stock only if enough of it is left.
+// $elemMatch makes both conditions apply to the same variant and the positional operator $ then updates exactly that variant.
+func ReserveVariantStock(ctx context.Context, prodCollection *mongo.Collection, line models.ProductUser) error {
+	// Lines saved before variants were introduced have no variant to take the stock from
+	if line.Variant_ID.IsZero() {
+		return nil
+	}
+
+	quantity := cartLineQuantity(line)
+
+	filter := bson.D{
+		{Key: "_id", Value: line.Product_ID},
+		{Key: "variants", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+			{Key: "variant_id", Value: line.Variant_ID},
+			{Key: "stock", Value: bson.D{{Key: "$gte", Value: quantity}}},
+		}}}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "variants.$.stock", Value: -quantity}}}}
+
+	result, err := prodCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		log.Println(err)
-		return ErrCantUpdateUser
+		return ErrCantBuyCartItem
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotEnoughStock
 	}
 
 	return nil
 }
+
+// ReleaseVariantStock gives the reserved stock back to the variant
+func ReleaseVariantStock(ctx context.Context, prodCollection *mongo.Collection, line models.ProductUser) {
+	if line.Variant_ID.IsZero() {
+		return
+	}
+
+	filter := bson.D{{Key: "_id", Value: line.Product_ID}, {Key: "variants.variant_id", Value: line.Variant_ID}}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "variants.$.stock", Value: cartLineQuantity(line)}}}}
+
+	if _, err := prodCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println("Error while releasing the variant stock ", err)
+	}
+}
+
+func cartLineQuantity(line models.ProductUser) int {
+	if line.Quantity < 1 {
+		return 1
+	}
+	return line.Quantity
+}
+
+// CartParcel prices the cart of the user like the checkout does and describes it for the shipping rates
+func CartParcel(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, promotionCollection *mongo.Collection, userQueryID string, addressId primitive.ObjectID) (shipping.Parcel, error) {
+
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return shipping.Parcel{}, ErrUserIdIsNotValid
+	}
+
+	var user models.User
+	if err = userCollection.FindOne(ctx, bson.D{{Key: "_id", Value: userId}}).Decode(&user); err != nil {
+		log.Println(err)
+		return shipping.Parcel{}, ErrCantGetItem
+	}
+
+	if len(user.User_Cart) == 0 {
+		return shipping.Parcel{}, ErrCartIsEmpty
+	}
+
+	address, err := shippingAddress(user, addressId)
+	if err != nil {
+		return shipping.Parcel{}, err
+	}
+
+	quote, _, err := PriceCart(ctx, prodCollection, couponCollection, promotionCollection, userQueryID, user.User_Cart, user.Cart_Coupon)
+	if err != nil {
+		return shipping.Parcel{}, err
+	}
+
+	return NewParcel(user.User_Cart, address, quote), nil
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrCartChanged = errors.New("the cart does not match the catalog any more, check the changes and acknowledge them")
+
+// CartChangedError carries the changes which stopped the checkout, errors.Is(err, ErrCartChanged) matches it
+type CartChangedError struct {
+	Changes []models.CartChange
+}
+
+func (e *CartChangedError) Error() string {
+	return ErrCartChanged.Error()
+}
+
+func (e *CartChangedError) Is(target error) bool {
+	return target == ErrCartChanged
+}
+
+// ReviewCart compares every cart line with the live catalog :- a different price, a deleted product or variant and missing stock are reported.
+// Lines saved before variants were introduced are left out, they have no variant to compare with.
+func ReviewCart(ctx context.Context, prodCollection *mongo.Collection, cart []models.ProductUser) ([]models.CartChange, error) {
+	changes, _, err := reviewCart(ctx, prodCollection, cart)
+	return changes, err
+}
+
+// reviewCart also gives the catalog version of every line which is still for sale, keyed by the variant id
+func reviewCart(ctx context.Context, prodCollection *mongo.Collection, cart []models.ProductUser) ([]models.CartChange, map[primitive.ObjectID]models.ProductUser, error) {
+
+	changes := make([]models.CartChange, 0)
+	fresh := make(map[primitive.ObjectID]models.ProductUser, len(cart))
+
+	productIds := make([]primitive.ObjectID, 0, len(cart))
+	for _, line := range cart {
+		if !line.Variant_ID.IsZero() {
+			productIds = append(productIds, line.Product_ID)
+		}
+	}
+	if len(productIds) == 0 {
+		return changes, fresh, nil
+	}
+
+	cursor, err := prodCollection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: productIds}}}})
+	if err != nil {
+		log.Println(err)
+		return nil, nil, ErrCantDecodeProducts
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err = cursor.All(ctx, &products); err != nil {
+		log.Println(err)
+		return nil, nil, ErrCantDecodeProducts
+	}
+
+	catalog := make(map[primitive.ObjectID]models.Product, len(products))
+	for _, product := range products {
+		catalog[product.Product_ID] = product
+	}
+
+	for _, line := range cart {
+		if line.Variant_ID.IsZero() {
+			continue
+		}
+
+		change := models.CartChange{
+			Product_ID:   line.Product_ID,
+			Variant_ID:   line.Variant_ID,
+			Product_Name: line.Product_Name,
+			Quantity:     cartLineQuantity(line),
+		}
+
+		product, found := catalog[line.Product_ID]
+		variant, err := FindVariant(product, line.Variant_ID)
+		if !found || err != nil || variant.Stock == nil || *variant.Stock <= 0 {
+			change.Reason = models.CartLineUnavailable
+			changes = append(changes, change)
+			continue
+		}
+
+		current := NewCartLine(product, variant, line.Quantity)
+		fresh[line.Variant_ID] = current
+
+		if !samePrice(line, current) {
+			priceChange := change
+			priceChange.Reason = models.CartLinePriceChanged
+			priceChange.Old_Price, priceChange.Old_Price_Overrides = &line.Price, line.Price_Overrides
+			priceChange.New_Price, priceChange.New_Price_Overrides = &current.Price, current.Price_Overrides
+			changes = append(changes, priceChange)
+		}
+
+		if *variant.Stock < int64(change.Quantity) {
+			change.Reason = models.CartLineInsufficientStock
+			change.Available = *variant.Stock
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, fresh, nil
+}
+
+// samePrice compares the store price and the fixed prices of the other currencies, either one changes what the customer pays
+func samePrice(line models.ProductUser, current models.ProductUser) bool {
+	if line.Price != current.Price || len(line.Price_Overrides) != len(current.Price_Overrides) {
+		return false
+	}
+
+	overrides := make(map[models.Money]bool, len(line.Price_Overrides))
+	for _, price := range line.Price_Overrides {
+		overrides[price] = true
+	}
+	for _, price := range current.Price_Overrides {
+		if !overrides[price] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AcknowledgeCartChanges brings the cart in line with the catalog once the customer saw the changes :-
+// the new prices are taken, the unavailable lines are removed and a quantity is lowered to the stock which is left.
+// Every line is updated on its own with the positional operator, the rest of the cart is not touched. The applied changes are returned.
+func AcknowledgeCartChanges(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, userQueryID string) ([]models.CartChange, error) {
+
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrUserIdIsNotValid
+	}
+
+	var user models.User
+	if err = userCollection.FindOne(ctx, bson.D{{Key: "_id", Value: userId}}).Decode(&user); err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+
+	changes, fresh, err := reviewCart(ctx, prodCollection, user.User_Cart)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(changes) == 0 {
+		return changes, nil
+	}
+
+	err = withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+		for _, change := range changes {
+			if err := applyCartChange(ctx, userCollection, userId, change, fresh); err != nil {
+				return nil, err
+			}
+		}
+		return eventList(cartEvent(userId, models.CartChangesAccepted, primitive.NilObjectID, 0))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// applyCartChange updates the one cart line of the change
+func applyCartChange(ctx context.Context, userCollection *mongo.Collection, userId primitive.ObjectID, change models.CartChange, fresh map[primitive.ObjectID]models.ProductUser) error {
+	filter := bson.D{{Key: "_id", Value: userId}, {Key: "user_cart.variant_id", Value: change.Variant_ID}}
+
+	var update bson.D
+	switch change.Reason {
+	case models.CartLinePriceChanged:
+		update = bson.D{{Key: "$set", Value: append(cartLinePrice(fresh[change.Variant_ID]), cartUpdatedAt())}}
+	case models.CartLineInsufficientStock:
+		update = bson.D{{Key: "$set", Value: bson.D{{Key: "user_cart.$.quantity", Value: change.Available}, cartUpdatedAt()}}}
+	default:
+		filter = bson.D{{Key: "_id", Value: userId}}
+		update = bson.D{
+			{Key: "$pull", Value: bson.D{{Key: "user_cart", Value: bson.D{{Key: "variant_id", Value: change.Variant_ID}}}}},
+			{Key: "$set", Value: bson.D{cartUpdatedAt()}},
+		}
+	}
+
+	if _, err := userCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+
+	return nil
+}
@@ -0,0 +1,358 @@
+package database
+
+import (
+	"context"
+	"ecommerce/catalog"
+	"ecommerce/models"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantImportRow       = errors.New("cannot save this row")
+	ErrSKUOfAnotherProduct = errors.New("this sku already belongs to another product")
+	ErrCantExportProducts  = errors.New("cannot export the products")
+	ErrCantSaveProduct     = errors.New("cannot save the product")
+	ErrSKUExists           = errors.New("SKU already exists")
+)
+
+// What happened (or would happen in a dry run) to a row of the import
+const (
+	importCreateProduct = "create_product"
+	importAddVariant    = "add_variant"
+	importUpdateVariant = "update_variant"
+)
+
+// ImportProducts upserts every row by its SKU :-
+// 1. The SKU is already in the catalog -->> that variant (and the product details) gets updated
+// 2. The product exists (by product_id, otherwise by product_name) -->> the variant is added to it
+// 3. Otherwise a new product is created with this variant
+// A broken row never stops the import, it is written in the report and the next row is processed.
+// With dryRun the same checks run but nothing is written to the database.
+func ImportProducts(ctx context.Context, prodCollection *mongo.Collection, reader catalog.RowReader, dryRun bool) (*catalog.Report, error) {
+
+	report := catalog.NewReport(dryRun)
+	seenSKUs := make(map[string]int)         // sku -->> line, the same sku twice in one file is a mistake
+	plannedProducts := make(map[string]bool) // Products which a dry run would have created by the earlier rows
+
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		var rowErr catalog.RowError
+		if errors.As(err, &rowErr) {
+			report.Rows++
+			report.AddError(rowErr)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.Rows++
+
+		if errs := row.Validate(); len(errs) > 0 {
+			for _, validationErr := range errs {
+				report.AddError(validationErr)
+			}
+			continue
+		}
+
+		if line, ok := seenSKUs[row.SKU]; ok {
+			report.AddError(catalog.RowError{Line: row.Line, SKU: row.SKU, Field: "sku", Message: fmt.Sprintf("duplicate of line %d", line)})
+			continue
+		}
+		seenSKUs[row.SKU] = row.Line
+
+		action, err := importRow(ctx, prodCollection, row, dryRun, plannedProducts)
+		if err != nil {
+			report.AddError(catalog.RowError{Line: row.Line, SKU: row.SKU, Message: err.Error()})
+			continue
+		}
+
+		switch action {
+		case importCreateProduct:
+			report.Products_Created++
+		case importAddVariant:
+			report.Variants_Added++
+		case importUpdateVariant:
+			report.Variants_Updated++
+		}
+	}
+
+	return report, nil
+}
+
+func importRow(ctx context.Context, prodCollection *mongo.Collection, row catalog.Row, dryRun bool, plannedProducts map[string]bool) (string, error) {
+
+	// 1. Upsert by SKU
+	var existing models.Product
+	err := prodCollection.FindOne(ctx, bson.D{{Key: "variants.sku", Value: row.SKU}}).Decode(&existing)
+	if err == nil {
+		if row.Product_ID != "" && row.Product_ID != existing.Product_ID.Hex() {
+			return "", ErrSKUOfAnotherProduct
+		}
+
+		if !dryRun {
+			if err := updateVariantFromRow(ctx, prodCollection, existing.Product_ID, row); err != nil {
+				return "", err
+			}
+		}
+		return importUpdateVariant, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Println(err)
+		return "", ErrCantImportRow
+	}
+
+	// 2. Add the variant to an existing product
+	productFilter := bson.D{{Key: "product_name", Value: row.Product_Name}}
+	productKey := "name:" + row.Product_Name
+	if row.Product_ID != "" {
+		productId, err := primitive.ObjectIDFromHex(row.Product_ID)
+		if err != nil {
+			return "", errors.New("product_id is not a valid id")
+		}
+		productFilter = bson.D{{Key: "_id", Value: productId}}
+		productKey = "id:" + row.Product_ID
+	}
+
+	if dryRun && plannedProducts[productKey] {
+		return importAddVariant, nil
+	}
+
+	var product models.Product
+	err = prodCollection.FindOne(ctx, productFilter).Decode(&product)
+	if err == nil {
+		if !dryRun {
+			update := bson.D{{Key: "$push", Value: bson.D{{Key: "variants", Value: newVariantFromRow(row)}}}}
+			err := withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+				_, err := prodCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: product.Product_ID}}, update)
+				if mongo.IsDuplicateKeyError(err) {
+					return nil, ErrSKUOfAnotherProduct
+				}
+				if err != nil {
+					log.Println(err)
+					return nil, ErrCantImportRow
+				}
+
+				if err := RefreshFromPrice(ctx, prodCollection, product.Product_ID); err != nil {
+					return nil, err
+				}
+				return eventList(productEvent(product.Product_ID, models.ProductVariantAdded, row.SKU))
+			})
+			if err != nil {
+				return "", err
+			}
+		}
+		return importAddVariant, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Println(err)
+		return "", ErrCantImportRow
+	}
+
+	if row.Product_ID != "" {
+		return "", ErrCantFindProduct
+	}
+
+	// 3. A brand new product
+	if !dryRun {
+		variant := newVariantFromRow(row)
+		product = models.Product{
+			Product_ID:   primitive.NewObjectID(),
+			Product_Name: &row.Product_Name,
+			Brand:        optionalString(row.Brand),
+			Category:     optionalString(row.Category),
+			Price:        variant.Price,
+			Image:        variant.Image,
+			Images:       make([]primitive.ObjectID, 0),
+			Variants:     []models.Variant{variant},
+		}
+
+		if err := AddProduct(ctx, prodCollection, product); err != nil {
+			if errors.Is(err, ErrSKUExists) {
+				return "", ErrSKUOfAnotherProduct
+			}
+			return "", ErrCantImportRow
+		}
+	}
+
+	plannedProducts[productKey] = true
+	return importCreateProduct, nil
+}
+
+// AddProduct saves a new product of the catalog, the other services hear about it with a ProductChanged event
+func AddProduct(ctx context.Context, prodCollection *mongo.Collection, product models.Product) error {
+	return withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+		_, err := prodCollection.InsertOne(ctx, product)
+		if mongo.IsDuplicateKeyError(err) {
+			// The unique index of variants.sku refused it, another product got one of the SKUs first
+			return nil, ErrSKUExists
+		}
+		if err != nil {
+			log.Println(err)
+			return nil, ErrCantSaveProduct
+		}
+		return eventList(productEvent(product.Product_ID, models.ProductCreated, ""))
+	})
+}
+
+func updateVariantFromRow(ctx context.Context, prodCollection *mongo.Collection, productId primitive.ObjectID, row catalog.Row) error {
+
+	// The positional operator $ points to the variant matched by variants.sku in the filter
+	price, _ := row.Money() // The row is already validated
+	set := bson.D{{Key: "variants.$.price", Value: price}}
+
+	// Only what the file has is changed, a file with only the prices keeps the stock and the attributes of the variant
+	if row.Stock != nil {
+		set = append(set, bson.E{Key: "variants.$.stock", Value: *row.Stock})
+	}
+	if row.Attributes != nil {
+		set = append(set, bson.E{Key: "variants.$.attributes", Value: row.Attributes})
+	}
+	if row.Image != "" {
+		set = append(set, bson.E{Key: "variants.$.image", Value: row.Image})
+	}
+	if row.Product_Name != "" {
+		set = append(set, bson.E{Key: "product_name", Value: row.Product_Name})
+	}
+	if row.Brand != "" {
+		set = append(set, bson.E{Key: "brand", Value: row.Brand})
+	}
+	if row.Category != "" {
+		set = append(set, bson.E{Key: "category", Value: row.Category})
+	}
+
+	filter := bson.D{{Key: "_id", Value: productId}, {Key: "variants.sku", Value: row.SKU}}
+	return withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+		if _, err := prodCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: set}}); err != nil {
+			log.Println(err)
+			return nil, ErrCantImportRow
+		}
+
+		if err := RefreshFromPrice(ctx, prodCollection, productId); err != nil {
+			return nil, err
+		}
+		return eventList(productEvent(productId, models.ProductVariantUpdated, row.SKU))
+	})
+}
+
+// RefreshFromPrice sets the product price to its cheapest variant, the update pipeline reads the variants of the same document.
+// $min compares the {amount, currency} documents field by field, so with one store currency the smallest amount wins.
+func RefreshFromPrice(ctx context.Context, prodCollection *mongo.Collection, productId primitive.ObjectID) error {
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: "price", Value: bson.D{{Key: "$min", Value: "$variants.price"}}}}}}}
+
+	if _, err := prodCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: productId}}, update); err != nil {
+		log.Println(err)
+		return ErrCantImportRow
+	}
+
+	return nil
+}
+
+func newVariantFromRow(row catalog.Row) models.Variant {
+	price, _ := row.Money()
+	// A new variant without a stock column starts with nothing in stock
+	var stock int64
+	if row.Stock != nil {
+		stock = *row.Stock
+	}
+	attributes := row.Attributes
+	if attributes == nil {
+		attributes = make(map[string]string)
+	}
+	return models.Variant{
+		Variant_ID: primitive.NewObjectID(),
+		SKU:        &row.SKU,
+		Attributes: attributes,
+		Price:      price,
+		Stock:      &stock,
+		Image:      optionalString(row.Image),
+	}
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// ExportProducts streams the catalog with a cursor, one row per variant, so the whole catalog is never held in the memory
+func ExportProducts(ctx context.Context, prodCollection *mongo.Collection, writer catalog.RowWriter) error {
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := prodCollection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		log.Println(err)
+		return ErrCantExportProducts
+	}
+	defer cursor.Close(ctx)
+
+	written := 0
+	for cursor.Next(ctx) {
+		var product models.Product
+		if err := cursor.Decode(&product); err != nil {
+			log.Println(err)
+			return ErrCantExportProducts
+		}
+
+		for _, variant := range product.Variants {
+			if err := writer.Write(rowFromVariant(product, variant)); err != nil {
+				return err
+			}
+
+			written++
+			if written%100 == 0 {
+				if err := writer.Flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return ErrCantExportProducts
+	}
+
+	return writer.Flush()
+}
+
+func rowFromVariant(product models.Product, variant models.Variant) catalog.Row {
+	row := catalog.Row{
+		Product_ID: product.Product_ID.Hex(),
+		Attributes: variant.Attributes,
+	}
+
+	if product.Product_Name != nil {
+		row.Product_Name = *product.Product_Name
+	}
+	if product.Brand != nil {
+		row.Brand = *product.Brand
+	}
+	if product.Category != nil {
+		row.Category = *product.Category
+	}
+	if variant.SKU != nil {
+		row.SKU = *variant.SKU
+	}
+	row.Price = variant.Price.String()
+	row.Currency = variant.Price.Currency
+	row.Stock = variant.Stock
+	if variant.Image != nil {
+		row.Image = *variant.Image
+	}
+
+	return row
+}
@@ -0,0 +1,256 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"ecommerce/pricing"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindCoupon   = errors.New("can't find this coupon")
+	ErrCouponCodeTaken  = errors.New("a coupon with this code already exists")
+	ErrCantSaveCoupon   = errors.New("cannot save the coupon")
+	ErrCantRedeemCoupon = errors.New("cannot redeem the coupon")
+)
+
+// CouponRedemptionCollection counts the uses of every coupon per customer, next to the total used_count of the coupon itself
+var CouponRedemptionCollection *mongo.Collection = CouponRedemptionData(Client, "CouponRedemptions")
+
+func CreateCoupon(ctx context.Context, couponCollection *mongo.Collection, coupon models.Coupon) (models.Coupon, error) {
+
+	coupon.Code = strings.ToUpper(coupon.Code)
+
+	coupon.Coupon_ID = primitive.NewObjectID()
+	coupon.Used_Count = 0
+	coupon.Created_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	// The unique index on the code refuses a code which exists already, also when two admins create it at the same moment
+	_, err := couponCollection.InsertOne(ctx, coupon)
+	if mongo.IsDuplicateKeyError(err) {
+		return coupon, ErrCouponCodeTaken
+	}
+	if err != nil {
+		log.Println(err)
+		return coupon, ErrCantSaveCoupon
+	}
+
+	return coupon, nil
+}
+
+func ListCoupons(ctx context.Context, couponCollection *mongo.Collection) ([]models.Coupon, error) {
+
+	coupons := make([]models.Coupon, 0)
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	cursor, err := couponCollection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		log.Println(err)
+		return coupons, ErrCantFindCoupon
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &coupons); err != nil {
+		log.Println(err)
+		return coupons, ErrCantFindCoupon
+	}
+
+	return coupons, nil
+}
+
+// SetCouponActive switches a coupon on or off, a coupon is never deleted because the orders keep its code
+func SetCouponActive(ctx context.Context, couponCollection *mongo.Collection, couponId primitive.ObjectID, active bool) error {
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "active", Value: active}}}}
+	result, err := couponCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: couponId}}, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveCoupon
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrCantFindCoupon
+	}
+
+	return nil
+}
+
+func FindCouponByCode(ctx context.Context, couponCollection *mongo.Collection, code string) (models.Coupon, error) {
+
+	var coupon models.Coupon
+	err := couponCollection.FindOne(ctx, bson.D{{Key: "code", Value: strings.ToUpper(strings.TrimSpace(code))}}).Decode(&coupon)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return coupon, ErrCantFindCoupon
+	}
+	if err != nil {
+		log.Println(err)
+		return coupon, ErrCantFindCoupon
+	}
+
+	return coupon, nil
+}
+
+// ApplyCartCoupon checks the coupon against the current cart and remembers it on the user, the checkout prices it again with the cart of that moment
+func ApplyCartCoupon(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, promotionCollection *mongo.Collection, userQueryID string, code string) (pricing.CartQuote, error) {
+
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return pricing.CartQuote{}, ErrUserIdIsNotValid
+	}
+
+	var user models.User
+	if err = userCollection.FindOne(ctx, bson.D{{Key: "_id", Value: userId}}).Decode(&user); err != nil {
+		log.Println(err)
+		return pricing.CartQuote{}, ErrCantGetItem
+	}
+
+	if len(user.User_Cart) == 0 {
+		return pricing.CartQuote{}, ErrCartIsEmpty
+	}
+
+	// The coupon works on the cart after its promotions, so the whole cart is priced to know the discount
+	quote, coupon, err := PriceCart(ctx, prodCollection, couponCollection, promotionCollection, userQueryID, user.User_Cart, &code)
+	if err != nil {
+		return quote, err
+	}
+	if quote.CouponErr != nil {
+		return quote, quote.CouponErr
+	}
+	if err = checkGuestCoupon(user, coupon); err != nil {
+		return quote, err
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "cart_coupon", Value: coupon.Code}}}}
+	if _, err = userCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: userId}}, update); err != nil {
+		log.Println(err)
+		return quote, ErrCantUpdateUser
+	}
+
+	return quote, nil
+}
+
+func RemoveCartCoupon(ctx context.Context, userCollection *mongo.Collection, userQueryID string) error {
+
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "cart_coupon", Value: ""}}}}
+	if _, err = userCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: userId}}, update); err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+
+	return nil
+}
+
+// checkGuestCoupon refuses a coupon with a per customer limit for a guest cart. Every guest cart is a new id,
+// so its uses could never be counted against one customer ; the guest has to log in (and bring the cart along) to use it.
+func checkGuestCoupon(user models.User, coupon *models.Coupon) error {
+	if user.Guest && coupon != nil && coupon.Per_User_Limit > 0 {
+		return pricing.ErrCouponNeedsAccount
+	}
+	return nil
+}
+
+// couponRedemptions is how many times the user has used the coupon
+func couponRedemptions(ctx context.Context, couponId primitive.ObjectID, userQueryID string) (int64, error) {
+
+	var redemption models.CouponRedemption
+	err := CouponRedemptionCollection.FindOne(ctx, bson.D{{Key: "coupon_id", Value: couponId}, {Key: "user_id", Value: userQueryID}}).Decode(&redemption)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	return redemption.Count, nil
+}
+
+// RedeemCoupon counts one use of the coupon for this user.
+// Both limits are checked inside the update filters, so two checkouts at the same moment can never use the last redemption twice :-
+// the use of the customer is an upsert which only matches below the per customer limit, at the limit the upsert tries to insert
+// a second document and the unique index on (coupon_id, user_id) refuses it. The total is checked with $expr on the coupon itself.
+func RedeemCoupon(ctx context.Context, couponCollection *mongo.Collection, coupon models.Coupon, userQueryID string) error {
+
+	filter := bson.D{{Key: "coupon_id", Value: coupon.Coupon_ID}, {Key: "user_id", Value: userQueryID}}
+	if coupon.Per_User_Limit > 0 {
+		filter = append(filter, bson.E{Key: "count", Value: bson.D{{Key: "$lt", Value: coupon.Per_User_Limit}}})
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "count", Value: 1}}}}
+
+	_, err := CouponRedemptionCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Two first uses at the same moment both try to insert, the second one finds the document on the retry
+		_, err = CouponRedemptionCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return pricing.ErrCouponUserLimit
+	}
+	if err != nil {
+		log.Println(err)
+		return ErrCantRedeemCoupon
+	}
+
+	filter = bson.D{
+		{Key: "_id", Value: coupon.Coupon_ID},
+		{Key: "active", Value: true},
+		{Key: "$expr", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "$eq", Value: bson.A{"$usage_limit", 0}}},
+			bson.D{{Key: "$lt", Value: bson.A{"$used_count", "$usage_limit"}}},
+		}}}},
+	}
+	update = bson.D{{Key: "$inc", Value: bson.D{{Key: "used_count", Value: 1}}}}
+
+	result, err := couponCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		releaseRedemption(ctx, coupon, userQueryID)
+		return ErrCantRedeemCoupon
+	}
+
+	if result.MatchedCount == 0 {
+		releaseRedemption(ctx, coupon, userQueryID)
+		return pricing.ErrCouponUsedUp
+	}
+
+	return nil
+}
+
+// ReleaseCoupon gives the redemption back when the order could not be placed after all
+func ReleaseCoupon(ctx context.Context, couponCollection *mongo.Collection, coupon models.Coupon, userQueryID string) {
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "used_count", Value: -1}}}}
+
+	if _, err := couponCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: coupon.Coupon_ID}}, update); err != nil {
+		log.Println("Error while releasing the coupon ", err)
+	}
+
+	releaseRedemption(ctx, coupon, userQueryID)
+}
+
+// releaseRedemption takes one use of the customer back, never below zero
+func releaseRedemption(ctx context.Context, coupon models.Coupon, userQueryID string) {
+	filter := bson.D{
+		{Key: "coupon_id", Value: coupon.Coupon_ID},
+		{Key: "user_id", Value: userQueryID},
+		{Key: "count", Value: bson.D{{Key: "$gt", Value: 0}}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "count", Value: -1}}}}
+
+	if _, err := CouponRedemptionCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println("Error while releasing the coupon use of the customer ", err)
+	}
+}
@@ -3,10 +3,10 @@ package database
 import (
 	"context"
 	"ecommerce/constants"
-	"fmt"
 	"log"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -32,20 +32,233 @@ func DBSetup() *mongo.Client {
 		return nil
 	}
 
-	fmt.Println("MongoDB Connected Successfully !!")
+	log.Println("MongoDB Connected Successfully !!") // log writes to stderr, so the stdout of the cli commands stays clean
 	return client
 }
 
 var Client *mongo.Client = DBSetup()
 
-// For User Data Collection
+// For User Data Collection ; the TTL index deletes the guest carts nobody touched until their guest_expires_at, accounts don't have the field
 func UserData(client *mongo.Client, collectionName string) *mongo.Collection {
 	var userCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "guest_expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	if _, err := userCollection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Println("Error creating the guest cart TTL index :- ", err)
+	}
+
 	return userCollection
 }
 
-// For Product Data Collection
+// For Product Data Collection ; the unique index keeps every SKU on one product, two admins adding the same SKU at once can't both win.
+// The products without variants (saved before the variants existed) are left out of it.
 func ProductData(client *mongo.Client, collectionName string) *mongo.Collection {
 	var productCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "variants.sku", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{
+			{Key: "variants.sku", Value: bson.D{{Key: "$type", Value: "string"}}},
+		}),
+	}
+	if _, err := productCollection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Println("Error creating the unique SKU index :- ", err)
+	}
+
 	return productCollection
 }
+
+// For Review Data Collection ; the unique index allows one review per customer and product
+func ReviewData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var reviewCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "product_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := reviewCollection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Println("Error creating the unique review index :- ", err)
+	}
+
+	return reviewCollection
+}
+
+// For Image Data Collection
+func ImageData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var imageCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+	return imageCollection
+}
+
+// For Coupon Data Collection ; the unique index on the code stops two admins from creating the same code at the same moment
+func CouponData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var couponCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := couponCollection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Println("Error creating the unique coupon code index :- ", err)
+	}
+
+	return couponCollection
+}
+
+// For Coupon Redemption Data Collection ; one document per coupon and customer, the unique index keeps it that way
+func CouponRedemptionData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var redemptionCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "coupon_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := redemptionCollection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Println("Error creating the unique coupon redemption index :- ", err)
+	}
+
+	return redemptionCollection
+}
+
+// For Promotion Data Collection
+func PromotionData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var promotionCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+	return promotionCollection
+}
+
+// For Payment Event Data Collection
+func PaymentEventData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var paymentEventCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+	return paymentEventCollection
+}
+
+// For Return Data Collection
+func ReturnData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var returnCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+	return returnCollection
+}
+
+// For Idempotency Data Collection ; the TTL index lets MongoDB delete the records once their window is over
+func IdempotencyData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var idempotencyCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	if _, err := idempotencyCollection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Println("Error creating the idempotency TTL index :- ", err)
+	}
+
+	return idempotencyCollection
+}
+
+// For Wishlist Data Collection ; the unique index keeps the share links apart, sparse leaves out the wishlists which are not shared
+func WishlistData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var wishlistCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "share_token", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+	}
+	if _, err := wishlistCollection.Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Println("Error creating the wishlist indexes :- ", err)
+	}
+
+	return wishlistCollection
+}
+
+// For Cart Reminder Data Collection ; the reminders of one user are looked up by the user id
+func CartReminderData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var reminderCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "sent_at", Value: -1}}}
+	if _, err := reminderCollection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Println("Error creating the cart reminder index :- ", err)
+	}
+
+	return reminderCollection
+}
+
+// For Job Data Collection ; the workers look for the due jobs by status and run_at, the TTL index removes the done jobs after a week
+func JobData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var jobCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}}},
+		{Keys: bson.D{{Key: "finished_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60)},
+	}
+	if _, err := jobCollection.Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Println("Error creating the job indexes :- ", err)
+	}
+
+	return jobCollection
+}
+
+// For Dead Job Data Collection, the jobs which failed every attempt
+func DeadJobData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var deadJobCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+	return deadJobCollection
+}
+
+// For Notification Delivery Data Collection ; the deliveries of one user are looked up by the user id
+func DeliveryData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var deliveryCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}}
+	if _, err := deliveryCollection.Indexes().CreateOne(ctx, index); err != nil {
+		log.Println("Error creating the notification delivery index :- ", err)
+	}
+
+	return deliveryCollection
+}
+
+// For Outbox Data Collection ; the dispatcher picks the due pending events in the order they happened
+func OutboxData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var outboxCollection *mongo.Collection = client.Database("ECommerce").Collection(collectionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}, {Key: "occurred_at", Value: 1}}},
+		{Keys: bson.D{{Key: "published_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60)},
+	}
+	if _, err := outboxCollection.Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Println("Error creating the outbox indexes :- ", err)
+	}
+
+	return outboxCollection
+}
@@ -0,0 +1,293 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"ecommerce/payment"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// A guest cart is a user document with guest: true and without email, password or tokens.
+// Keeping it in the Users collection lets the cart, the checkout, the payment webhooks and the orders work the same way for a guest.
+
+var (
+	ErrCantCreateGuestCart = errors.New("cannot create the guest cart")
+	ErrCantFindGuestCart   = errors.New("can't find the guest cart, it may already belong to an account")
+	ErrCantAttachGuestCart = errors.New("cannot move the guest cart to the account")
+)
+
+// CreateGuestCart makes an empty guest cart which is deleted when nobody touches it for ttl
+func CreateGuestCart(ctx context.Context, userCollection *mongo.Collection, ttl time.Duration) (primitive.ObjectID, error) {
+
+	guest := models.User{
+		ID:              primitive.NewObjectID(),
+		Guest:           true,
+		User_Cart:       make([]models.ProductUser, 0),
+		Address_Details: make([]models.Address, 0),
+		Order_Status:    make([]models.Order, 0),
+	}
+	guest.Created_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	guest.Updated_At = guest.Created_At
+	expiresAt := time.Now().Add(ttl)
+	guest.Guest_Expires_At = &expiresAt
+	hexValue := guest.ID.Hex()
+	guest.User_ID = &hexValue
+
+	if _, err := userCollection.InsertOne(ctx, guest); err != nil {
+		log.Println(err)
+		return primitive.NilObjectID, ErrCantCreateGuestCart
+	}
+
+	return guest.ID, nil
+}
+
+// FindGuestCart only finds guest documents, so a cart token can never open the document of a real account
+func FindGuestCart(ctx context.Context, userCollection *mongo.Collection, guestQueryID string) (models.User, error) {
+
+	guestId, err := primitive.ObjectIDFromHex(guestQueryID)
+	if err != nil {
+		log.Println(err)
+		return models.User{}, ErrUserIdIsNotValid
+	}
+
+	var guest models.User
+	err = userCollection.FindOne(ctx, bson.D{{Key: "_id", Value: guestId}, {Key: "guest", Value: true}}).Decode(&guest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.User{}, ErrCantFindGuestCart
+	}
+	if err != nil {
+		log.Println(err)
+		return models.User{}, ErrCantGetItem
+	}
+
+	return guest, nil
+}
+
+// TouchGuestCart pushes the expiry of a guest cart ttl into the future, a guest which placed an order has no expiry any more and keeps it that way
+func TouchGuestCart(ctx context.Context, userCollection *mongo.Collection, guestQueryID string, ttl time.Duration) error {
+
+	guestId, err := primitive.ObjectIDFromHex(guestQueryID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: guestId},
+		{Key: "guest", Value: true},
+		{Key: "guest_expires_at", Value: bson.D{{Key: "$exists", Value: true}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "guest_expires_at", Value: time.Now().Add(ttl)}}}}
+
+	if _, err = userCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+
+	return nil
+}
+
+// GuestCheckout places the order of a guest cart. The email and the addresses are captured with the order :-
+// they are saved on the guest document first and then the normal cart checkout picks them as the default addresses.
+func GuestCheckout(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, promotionCollection *mongo.Collection, guestQueryID string, email string, shippingAddress models.Address, billingAddress *models.Address, checkout Checkout) (models.Order, *payment.Intent, error) {
+
+	guestId, err := primitive.ObjectIDFromHex(guestQueryID)
+	if err != nil {
+		log.Println(err)
+		return models.Order{}, nil, ErrUserIdIsNotValid
+	}
+
+	shippingAddress.Address_ID = primitive.NewObjectID()
+	shippingAddress.Default_Shipping = true
+	shippingAddress.Default_Billing = billingAddress == nil
+	addresses := []models.Address{shippingAddress}
+
+	if billingAddress != nil {
+		billing := *billingAddress
+		billing.Address_ID = primitive.NewObjectID()
+		billing.Default_Shipping = false
+		billing.Default_Billing = true
+		addresses = append(addresses, billing)
+	}
+
+	// The addresses of the last checkout replace the earlier ones, a guest does not keep an address book
+	filter := bson.D{{Key: "_id", Value: guestId}, {Key: "guest", Value: true}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "guest_email", Value: email},
+		{Key: "address", Value: addresses},
+	}}}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return models.Order{}, nil, ErrCantBuyCartItem
+	}
+	if result.MatchedCount == 0 {
+		return models.Order{}, nil, ErrCantFindGuestCart
+	}
+
+	checkout.Shipping_Address_ID = primitive.NilObjectID
+	checkout.Billing_Address_ID = primitive.NilObjectID
+
+	order, intent, err := BuyItemFromCart(ctx, prodCollection, userCollection, couponCollection, promotionCollection, guestQueryID, checkout)
+	if err != nil {
+		return order, intent, err
+	}
+
+	// The guest now has an order to follow and to pay, the TTL index must not delete it with the cart
+	update = bson.D{{Key: "$unset", Value: bson.D{{Key: "guest_expires_at", Value: ""}}}}
+	if _, err = userCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println("Error while removing the expiry of the guest cart ", err)
+	}
+
+	return order, intent, nil
+}
+
+// AttachGuestCart moves the orders and the cart of a guest to the account which signed up or logged in with its cart token.
+// The guest document is deleted first, so the same token can't attach the orders twice ; when the orders can't be moved it is put back.
+// The guest cart is merged into the account cart :- the quantities of the same variant are added up and the newer price is kept.
+func AttachGuestCart(ctx context.Context, userCollection *mongo.Collection, guestQueryID string, userQueryID string) error {
+
+	guestId, err := primitive.ObjectIDFromHex(guestQueryID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	var user models.User
+	if err = userCollection.FindOne(ctx, bson.D{{Key: "_id", Value: userId}}).Decode(&user); err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+	if user.Guest {
+		return ErrUserIdIsNotValid
+	}
+
+	// With a transaction (a replica set) everything below is one change :- when any step fails the guest, its orders and
+	// its cart stay as they were and the token can be used again
+	err = withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+		inTransaction := mongo.SessionFromContext(ctx) != nil
+
+		var guest models.User
+		err := userCollection.FindOneAndDelete(ctx, bson.D{{Key: "_id", Value: guestId}, {Key: "guest", Value: true}}).Decode(&guest)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCantFindGuestCart
+		}
+		if err != nil {
+			log.Println(err)
+			return nil, ErrCantAttachGuestCart
+		}
+
+		update := bson.D{{Key: "$push", Value: bson.D{{Key: "orders", Value: bson.D{{Key: "$each", Value: nonNilOrders(guest.Order_Status)}}}}}}
+
+		// The coupon of the guest cart comes along only when the account has none of its own
+		if user.Cart_Coupon == nil && guest.Cart_Coupon != nil {
+			update = append(update, bson.E{Key: "$set", Value: bson.D{{Key: "cart_coupon", Value: *guest.Cart_Coupon}}})
+		}
+
+		if _, err = userCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: userId}}, update); err != nil {
+			log.Println(err)
+			if !inTransaction {
+				// Without a transaction nothing is rolled back, the guest is put back by hand
+				if _, insertErr := userCollection.InsertOne(ctx, guest); insertErr != nil {
+					log.Println("Error while putting back the guest cart ", insertErr)
+				}
+			}
+			return nil, ErrCantAttachGuestCart
+		}
+
+		for _, line := range guest.User_Cart {
+			if err := mergeCartLine(ctx, userCollection, userId, line); err != nil {
+				if inTransaction {
+					return nil, ErrCantAttachGuestCart
+				}
+				// Without a transaction the orders are moved already ; putting the guest back would add the other lines twice
+				log.Println("Error while merging the guest cart line ", err)
+			}
+		}
+
+		if len(guest.User_Cart) == 0 {
+			return nil, nil
+		}
+		return eventList(cartEvent(userId, models.CartGuestCartAttached, primitive.NilObjectID, 0))
+	})
+	return err
+}
+
+// mergeCartLine adds one line of another cart to the cart of the user, each step is a single atomic update like AddProductToCart
+func mergeCartLine(ctx context.Context, userCollection *mongo.Collection, userId primitive.ObjectID, line models.ProductUser) error {
+
+	// 1. The variant is in the cart with an older price :- add the quantity and take the newer price
+	filter := bson.D{
+		{Key: "_id", Value: userId},
+		{Key: "user_cart", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+			{Key: "variant_id", Value: line.Variant_ID},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "priced_at", Value: bson.D{{Key: "$lt", Value: line.Priced_At}}}},
+				bson.D{{Key: "priced_at", Value: bson.D{{Key: "$exists", Value: false}}}},
+			}},
+		}}}},
+	}
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "user_cart.$.quantity", Value: cartLineQuantity(line)}}},
+		{Key: "$set", Value: append(cartLinePrice(line), cartUpdatedAt())},
+	}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// 2. The variant is in the cart with the newer price already :- only add the quantity
+	filter = bson.D{{Key: "_id", Value: userId}, {Key: "user_cart.variant_id", Value: line.Variant_ID}}
+	update = bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "user_cart.$.quantity", Value: cartLineQuantity(line)}}},
+		{Key: "$set", Value: bson.D{cartUpdatedAt()}},
+	}
+
+	result, err = userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// 3. A new variant for this cart :- push the line, the $ne filter stops a line pushed meanwhile from being doubled
+	filter = bson.D{{Key: "_id", Value: userId}, {Key: "user_cart.variant_id", Value: bson.D{{Key: "$ne", Value: line.Variant_ID}}}}
+	update = bson.D{
+		{Key: "$push", Value: bson.D{{Key: "user_cart", Value: line}}},
+		{Key: "$set", Value: bson.D{cartUpdatedAt()}},
+	}
+
+	if _, err = userCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+
+	return nil
+}
+
+func nonNilOrders(orders []models.Order) []models.Order {
+	if orders == nil {
+		return make([]models.Order, 0)
+	}
+	return orders
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrIdempotencyKeyReused   = errors.New("this idempotency key was already used for a different request")
+	ErrIdempotencyInProgress  = errors.New("a request with this idempotency key is still being processed")
+	ErrCantSaveIdempotencyKey = errors.New("cannot save the idempotency key")
+)
+
+// A request which holds its key longer than this crashed or timed out, a retry may take the key over
+const idempotencyLockTimeout = 2 * time.Minute
+
+// StartIdempotentRequest claims the key for this request. It returns nil when the request is the first one and should run,
+// or the saved record when the request already ran and its response should be sent again.
+// The key is the _id of the record, so of two requests at the same moment only one can claim it.
+func StartIdempotentRequest(ctx context.Context, idempotencyCollection *mongo.Collection, key string, fingerprint string, window time.Duration) (*models.IdempotencyRecord, error) {
+
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now()
+		record := models.IdempotencyRecord{
+			Key:         key,
+			Fingerprint: fingerprint,
+			Status:      models.IdempotencyInProgress,
+			Created_At:  now,
+			Expires_At:  now.Add(window),
+		}
+
+		_, err := idempotencyCollection.InsertOne(ctx, record)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			log.Println(err)
+			return nil, ErrCantSaveIdempotencyKey
+		}
+
+		var existing models.IdempotencyRecord
+		if err = idempotencyCollection.FindOne(ctx, bson.D{{Key: "_id", Value: key}}).Decode(&existing); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue // It expired in between, try to claim it again
+			}
+			log.Println(err)
+			return nil, ErrCantSaveIdempotencyKey
+		}
+
+		// The TTL monitor only runs every minute, an expired record is removed here so the key can be used again
+		stale := existing.Expires_At.Before(now) ||
+			(existing.Status == models.IdempotencyInProgress && existing.Created_At.Before(now.Add(-idempotencyLockTimeout)))
+		if stale {
+			filter := bson.D{{Key: "_id", Value: key}, {Key: "created_at", Value: existing.Created_At}}
+			if _, err = idempotencyCollection.DeleteOne(ctx, filter); err != nil {
+				log.Println(err)
+				return nil, ErrCantSaveIdempotencyKey
+			}
+			continue
+		}
+
+		if existing.Fingerprint != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if existing.Status != models.IdempotencyCompleted {
+			return nil, ErrIdempotencyInProgress
+		}
+
+		return &existing, nil
+	}
+
+	return nil, ErrIdempotencyInProgress
+}
+
+// FinishIdempotentRequest saves the response of the request which claimed the key
+func FinishIdempotentRequest(ctx context.Context, idempotencyCollection *mongo.Collection, key string, status int, body []byte, contentType string) {
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: models.IdempotencyCompleted},
+		{Key: "response_status", Value: status},
+		{Key: "response_body", Value: body},
+		{Key: "content_type", Value: contentType},
+	}}}
+
+	if _, err := idempotencyCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: key}}, update); err != nil {
+		log.Println("Error while saving the idempotent response ", err)
+	}
+}
+
+// AbandonIdempotentRequest frees the key of a request which failed on the server side, so the client can retry it
+func AbandonIdempotentRequest(ctx context.Context, idempotencyCollection *mongo.Collection, key string) {
+	filter := bson.D{{Key: "_id", Value: key}, {Key: "status", Value: models.IdempotencyInProgress}}
+	if _, err := idempotencyCollection.DeleteOne(ctx, filter); err != nil {
+		log.Println("Error while releasing the idempotency key ", err)
+	}
+}
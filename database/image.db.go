@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrCantSaveImage = errors.New("cannot save the image")
+	ErrCantFindImage = errors.New("can't find the image")
+)
+
+// AddProductImage saves the image metadata and attaches its id to the product's images list
+func AddProductImage(ctx context.Context, prodCollection *mongo.Collection, imageCollection *mongo.Collection, image models.Image) error {
+
+	_, err := imageCollection.InsertOne(ctx, image)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveImage
+	}
+
+	filter := bson.D{{Key: "_id", Value: image.Product_ID}}
+	update := bson.D{{Key: "$push", Value: bson.D{{Key: "images", Value: image.Image_ID}}}}
+
+	err = withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+		result, err := prodCollection.UpdateOne(ctx, filter, update)
+		if err != nil || result.MatchedCount == 0 {
+			log.Println(err)
+			return nil, ErrCantFindProduct
+		}
+		return eventList(productEvent(image.Product_ID, models.ProductImageAdded, ""))
+	})
+	if err != nil {
+		// The product is gone, don't leave an image which nobody points to
+		_, _ = imageCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: image.Image_ID}})
+		return ErrCantFindProduct
+	}
+
+	return nil
+}
+
+// RemoveProductImage detaches the image from the product and deletes its metadata, the caller removes the files from the storage
+func RemoveProductImage(ctx context.Context, prodCollection *mongo.Collection, imageCollection *mongo.Collection, productId primitive.ObjectID, imageId primitive.ObjectID) (models.Image, error) {
+
+	var image models.Image
+
+	filter := bson.D{{Key: "_id", Value: imageId}, {Key: "product_id", Value: productId}}
+	err := imageCollection.FindOneAndDelete(ctx, filter).Decode(&image)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return image, ErrCantFindImage
+	}
+	if err != nil {
+		log.Println(err)
+		return image, ErrCantFindImage
+	}
+
+	update := bson.M{"$pull": bson.M{"images": imageId}}
+	err = withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+		if _, err := prodCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: productId}}, update); err != nil {
+			log.Println(err)
+			return nil, ErrCantFindProduct
+		}
+		return eventList(productEvent(productId, models.ProductImageRemoved, ""))
+	})
+	if err != nil {
+		return image, ErrCantFindProduct
+	}
+
+	return image, nil
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantEnqueueJob = errors.New("cannot save the job")
+	ErrCantClaimJob   = errors.New("cannot pick the next job")
+	ErrCantUpdateJob  = errors.New("cannot update the job")
+	ErrCantFindJob    = errors.New("can't find the job")
+)
+
+// EnqueueJob saves a job which a worker picks up at runAt, the payload must be a struct or a map
+func EnqueueJob(ctx context.Context, jobCollection *mongo.Collection, jobType string, payload any, runAt time.Time, maxAttempts int) (models.Job, error) {
+
+	raw, err := bson.Marshal(payload)
+	if err != nil {
+		log.Println(err)
+		return models.Job{}, ErrCantEnqueueJob
+	}
+
+	now := time.Now()
+	job := models.Job{
+		Job_ID:       primitive.NewObjectID(),
+		Type:         jobType,
+		Payload:      raw,
+		Status:       models.JobPending,
+		Max_Attempts: maxAttempts,
+		Run_At:       runAt,
+		Created_At:   now,
+		Updated_At:   now,
+	}
+
+	if _, err = jobCollection.InsertOne(ctx, job); err != nil {
+		log.Println(err)
+		return models.Job{}, ErrCantEnqueueJob
+	}
+
+	return job, nil
+}
+
+// ClaimJob gives the job of one of these types which is due the longest, locked for the worker until the lease is over.
+// A running job whose lease is over belongs to a worker which stopped (e.g. the service crashed), it is claimed again.
+// Claiming is one atomic update, so two workers or two instances of the service never get the same job.
+func ClaimJob(ctx context.Context, jobCollection *mongo.Collection, jobTypes []string, lease time.Duration) (models.Job, bool, error) {
+
+	now := time.Now()
+	filter := bson.D{
+		{Key: "type", Value: bson.D{{Key: "$in", Value: jobTypes}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "status", Value: models.JobPending}, {Key: "run_at", Value: bson.D{{Key: "$lte", Value: now}}}},
+			bson.D{{Key: "status", Value: models.JobRunning}, {Key: "locked_until", Value: bson.D{{Key: "$lt", Value: now}}}},
+		}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: models.JobRunning},
+			{Key: "locked_until", Value: now.Add(lease)},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "run_at", Value: 1}}).SetReturnDocument(options.After)
+
+	var job models.Job
+	err := jobCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Job{}, false, nil
+	}
+	if err != nil {
+		log.Println(err)
+		return models.Job{}, false, ErrCantClaimJob
+	}
+
+	return job, true, nil
+}
+
+// runningJob matches the job only while this attempt still holds it, a worker whose lease ran out can't change it any more
+func runningJob(job models.Job) bson.D {
+	return bson.D{{Key: "_id", Value: job.Job_ID}, {Key: "status", Value: models.JobRunning}, {Key: "attempts", Value: job.Attempts}}
+}
+
+// CompleteJob marks the job as done
+func CompleteJob(ctx context.Context, jobCollection *mongo.Collection, job models.Job) error {
+
+	now := time.Now()
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "status", Value: models.JobDone}, {Key: "finished_at", Value: now}, {Key: "updated_at", Value: now}}},
+		{Key: "$unset", Value: bson.D{{Key: "locked_until", Value: ""}}},
+	}
+
+	if _, err := jobCollection.UpdateOne(ctx, runningJob(job), update); err != nil {
+		log.Println(err)
+		return ErrCantUpdateJob
+	}
+
+	return nil
+}
+
+// RetryJob puts a failed job back in the queue, it runs again at runAt
+func RetryJob(ctx context.Context, jobCollection *mongo.Collection, job models.Job, jobErr string, runAt time.Time) error {
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: models.JobPending},
+			{Key: "run_at", Value: runAt},
+			{Key: "last_error", Value: jobErr},
+			{Key: "updated_at", Value: time.Now()},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: "locked_until", Value: ""}}},
+	}
+
+	if _, err := jobCollection.UpdateOne(ctx, runningJob(job), update); err != nil {
+		log.Println(err)
+		return ErrCantUpdateJob
+	}
+
+	return nil
+}
+
+// DeadLetterJob moves a job which failed too often to the dead letter collection, where an admin can look at it and run it again.
+// The copy is saved before the job is removed from the queue, so a job is never lost in between.
+func DeadLetterJob(ctx context.Context, jobCollection *mongo.Collection, deadJobCollection *mongo.Collection, job models.Job, jobErr string) error {
+
+	now := time.Now()
+	job.Status = models.JobDead
+	job.Last_Error = jobErr
+	job.Locked_Until = nil
+	job.Updated_At = now
+	job.Finished_At = &now
+
+	// A duplicate means an earlier try saved the copy but could not remove the job
+	if _, err := deadJobCollection.InsertOne(ctx, job); err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Println(err)
+		return ErrCantUpdateJob
+	}
+
+	if _, err := jobCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: job.Job_ID}}); err != nil {
+		log.Println(err)
+		return ErrCantUpdateJob
+	}
+
+	return nil
+}
+
+// RequeueDeadJob puts a dead job back in the queue with all its attempts again
+func RequeueDeadJob(ctx context.Context, jobCollection *mongo.Collection, deadJobCollection *mongo.Collection, jobId primitive.ObjectID) (models.Job, error) {
+
+	var job models.Job
+	err := deadJobCollection.FindOne(ctx, bson.D{{Key: "_id", Value: jobId}}).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Job{}, ErrCantFindJob
+	}
+	if err != nil {
+		log.Println(err)
+		return models.Job{}, ErrCantGetItem
+	}
+
+	now := time.Now()
+	job.Status = models.JobPending
+	job.Attempts = 0
+	job.Run_At = now
+	job.Updated_At = now
+	job.Finished_At = nil
+
+	if _, err = jobCollection.InsertOne(ctx, job); err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Println(err)
+		return models.Job{}, ErrCantEnqueueJob
+	}
+
+	if _, err = deadJobCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: jobId}}); err != nil {
+		log.Println(err)
+		return models.Job{}, ErrCantUpdateJob
+	}
+
+	return job, nil
+}
+
+// ListJobs gives the newest jobs of the collection first, only the ones with this status when it is not empty
+func ListJobs(ctx context.Context, jobCollection *mongo.Collection, status string, limit int64) ([]models.Job, error) {
+
+	filter := bson.D{}
+	if status != "" {
+		filter = bson.D{{Key: "status", Value: status}}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := jobCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+	defer cursor.Close(ctx)
+
+	jobs := make([]models.Job, 0)
+	if err = cursor.All(ctx, &jobs); err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+
+	return jobs, nil
+}
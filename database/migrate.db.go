@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrationReport counts the documents rewritten by a migration
+type MigrationReport struct {
+	Products int64 `json:"products"`
+	Users    int64 `json:"users"`
+}
+
+// MigrateMoney rewrites the prices saved before models.Money existed (bare numbers in whole units) into {amount, currency} documents.
+// models.Money already understands the old numbers while decoding, so every matching document is decoded and its price fields are saved back.
+// Running it twice is safe, the second run finds nothing to convert.
+func MigrateMoney(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection) (MigrationReport, error) {
+
+	var report MigrationReport
+
+	// $type "number" matches int, long, double and decimal ; on an array path it matches if any element has a number there
+	number := bson.D{{Key: "$type", Value: "number"}}
+
+	productFilter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "price", Value: number}},
+		bson.D{{Key: "variants.price", Value: number}},
+	}}}
+
+	productCursor, err := prodCollection.Find(ctx, productFilter)
+	if err != nil {
+		log.Println(err)
+		return report, err
+	}
+	defer productCursor.Close(ctx)
+
+	for productCursor.Next(ctx) {
+		var product models.Product
+		if err := productCursor.Decode(&product); err != nil {
+			log.Println(err)
+			return report, err
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "price", Value: product.Price}, {Key: "variants", Value: product.Variants}}}}
+		if _, err := prodCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: product.Product_ID}}, update); err != nil {
+			log.Println(err)
+			return report, err
+		}
+		report.Products++
+	}
+
+	if err := productCursor.Err(); err != nil {
+		return report, err
+	}
+
+	userFilter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "user_cart.price", Value: number}},
+		bson.D{{Key: "orders.total_price", Value: number}},
+		bson.D{{Key: "orders.discount", Value: number}},
+		bson.D{{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{{Key: "discount", Value: nil}}}}}},
+		bson.D{{Key: "orders.order_list.price", Value: number}},
+	}}}
+
+	userCursor, err := userCollection.Find(ctx, userFilter)
+	if err != nil {
+		log.Println(err)
+		return report, err
+	}
+	defer userCursor.Close(ctx)
+
+	for userCursor.Next(ctx) {
+		var user models.User
+		if err := userCursor.Decode(&user); err != nil {
+			log.Println(err)
+			return report, err
+		}
+
+		// Old orders had a null discount, it becomes a zero amount in the order currency
+		for i := range user.Order_Status {
+			if user.Order_Status[i].Discount.Currency == "" {
+				user.Order_Status[i].Discount = models.NewMoney(0, user.Order_Status[i].Price.Currency)
+			}
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "user_cart", Value: user.User_Cart}, {Key: "orders", Value: user.Order_Status}}}}
+		if _, err := userCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: user.ID}}, update); err != nil {
+			log.Println(err)
+			return report, err
+		}
+		report.Users++
+	}
+
+	return report, userCursor.Err()
+}
+
+// MigrateCouponRedemptions moves the used_by map which the coupons kept before (user id -->> uses) into the CouponRedemptions collection
+// and takes the map off the coupon. $max keeps a count the customer already has in the collection, so running it twice is safe.
+func MigrateCouponRedemptions(ctx context.Context, couponCollection *mongo.Collection) (int64, error) {
+
+	var moved int64
+
+	cursor, err := couponCollection.Find(ctx, bson.D{{Key: "used_by", Value: bson.D{{Key: "$exists", Value: true}}}})
+	if err != nil {
+		log.Println(err)
+		return moved, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var coupon struct {
+			Coupon_ID primitive.ObjectID `bson:"_id"`
+			Used_By   map[string]int64   `bson:"used_by"`
+		}
+		if err := cursor.Decode(&coupon); err != nil {
+			log.Println(err)
+			return moved, err
+		}
+
+		for userId, count := range coupon.Used_By {
+			filter := bson.D{{Key: "coupon_id", Value: coupon.Coupon_ID}, {Key: "user_id", Value: userId}}
+			update := bson.D{{Key: "$max", Value: bson.D{{Key: "count", Value: count}}}}
+			if _, err := CouponRedemptionCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+				log.Println(err)
+				return moved, err
+			}
+			moved++
+		}
+
+		update := bson.D{{Key: "$unset", Value: bson.D{{Key: "used_by", Value: ""}}}}
+		if _, err := couponCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: coupon.Coupon_ID}}, update); err != nil {
+			log.Println(err)
+			return moved, err
+		}
+	}
+
+	return moved, cursor.Err()
+}
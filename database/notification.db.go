@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantSaveDelivery = errors.New("cannot save the notification delivery")
+	ErrCantFindDelivery = errors.New("can't find the notification delivery")
+)
+
+// NotificationRecipient reads only what a message needs :- the name, the email (the guest email of a guest), the phone and the locale
+func NotificationRecipient(ctx context.Context, userCollection *mongo.Collection, userQueryID string) (models.User, error) {
+
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return models.User{}, ErrUserIdIsNotValid
+	}
+
+	projection := bson.D{
+		{Key: "first_name", Value: 1},
+		{Key: "email", Value: 1},
+		{Key: "phone", Value: 1},
+		{Key: "locale", Value: 1},
+		{Key: "guest", Value: 1},
+		{Key: "guest_email", Value: 1},
+	}
+
+	var user models.User
+	err = userCollection.FindOne(ctx, bson.D{{Key: "_id", Value: userId}}, options.FindOne().SetProjection(projection)).Decode(&user)
+	if err != nil {
+		log.Println(err)
+		return models.User{}, ErrUserIdIsNotValid
+	}
+
+	return user, nil
+}
+
+// QueueDelivery saves a rendered message before its job is queued
+func QueueDelivery(ctx context.Context, deliveryCollection *mongo.Collection, delivery models.NotificationDelivery) (models.NotificationDelivery, error) {
+
+	delivery.Delivery_ID = primitive.NewObjectID()
+	delivery.Status = models.DeliveryQueued
+	delivery.Created_At = time.Now()
+
+	if _, err := deliveryCollection.InsertOne(ctx, delivery); err != nil {
+		log.Println(err)
+		return models.NotificationDelivery{}, ErrCantSaveDelivery
+	}
+
+	return delivery, nil
+}
+
+func FindDelivery(ctx context.Context, deliveryCollection *mongo.Collection, deliveryId primitive.ObjectID) (models.NotificationDelivery, error) {
+
+	var delivery models.NotificationDelivery
+	err := deliveryCollection.FindOne(ctx, bson.D{{Key: "_id", Value: deliveryId}}).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.NotificationDelivery{}, ErrCantFindDelivery
+	}
+	if err != nil {
+		log.Println(err)
+		return models.NotificationDelivery{}, ErrCantGetItem
+	}
+
+	return delivery, nil
+}
+
+// RecordDeliveryAttempt writes down the result of one attempt :- sent when sendErr is nil, otherwise the error ;
+// the delivery stays queued for the next attempt unless this was the last one.
+func RecordDeliveryAttempt(ctx context.Context, deliveryCollection *mongo.Collection, deliveryId primitive.ObjectID, sendErr error, lastAttempt bool) error {
+
+	set := bson.D{{Key: "status", Value: models.DeliverySent}, {Key: "sent_at", Value: time.Now()}}
+	if sendErr != nil {
+		status := models.DeliveryQueued
+		if lastAttempt {
+			status = models.DeliveryFailed
+		}
+		set = bson.D{{Key: "status", Value: status}, {Key: "last_error", Value: sendErr.Error()}}
+	}
+
+	update := bson.D{{Key: "$set", Value: set}, {Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}}}
+
+	if _, err := deliveryCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: deliveryId}}, update); err != nil {
+		log.Println(err)
+		return ErrCantSaveDelivery
+	}
+
+	return nil
+}
+
+// ListDeliveries gives the newest deliveries first, filtered by the user and the status when they are not empty
+func ListDeliveries(ctx context.Context, deliveryCollection *mongo.Collection, userQueryID string, status string, limit int64) ([]models.NotificationDelivery, error) {
+
+	filter := bson.D{}
+	if userQueryID != "" {
+		filter = append(filter, bson.E{Key: "user_id", Value: userQueryID})
+	}
+	if status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: status})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := deliveryCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := make([]models.NotificationDelivery, 0)
+	if err = cursor.All(ctx, &deliveries); err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+
+	return deliveries, nil
+}
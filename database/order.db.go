@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrOrderNotShippable = errors.New("only a placed or paid order can be shipped")
+
+// ShipOrder hands a placed (cash on delivery) or paid order to the carrier. The status is part of the filter,
+// so an order which was cancelled or shipped meanwhile is never shipped (again). The shipped order and the id of its user are returned.
+func ShipOrder(ctx context.Context, userCollection *mongo.Collection, orderId primitive.ObjectID, carrier string, trackingNumber string) (primitive.ObjectID, models.Order, error) {
+
+	shipment := models.Shipment{Carrier: carrier, Tracking_Number: trackingNumber, Shipped_At: time.Now()}
+
+	filter := bson.D{{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+		{Key: "_id", Value: orderId},
+		{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{models.OrderPlaced, models.OrderPaid}}}},
+	}}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "orders.$.status", Value: models.OrderShipped},
+		{Key: "orders.$.shipment", Value: shipment},
+	}}}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return primitive.NilObjectID, models.Order{}, ErrCantUpdateUser
+	}
+
+	if result.MatchedCount == 0 {
+		// Either the order does not exist or it is in another status
+		if _, _, err = FindOrder(ctx, userCollection, orderId); err != nil {
+			return primitive.NilObjectID, models.Order{}, err
+		}
+		return primitive.NilObjectID, models.Order{}, ErrOrderNotShippable
+	}
+
+	return FindOrder(ctx, userCollection, orderId)
+}
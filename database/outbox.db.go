@@ -0,0 +1,325 @@
+package database
+
+import (
+	"context"
+	"ecommerce/constants"
+	"ecommerce/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantSaveEvent   = errors.New("cannot save the event")
+	ErrCantClaimEvent  = errors.New("cannot pick the next event")
+	ErrCantUpdateEvent = errors.New("cannot update the event")
+	ErrCantFindEvent   = errors.New("can't find the event")
+	ErrNoTransactions  = errors.New("MongoDB can't run transactions, it must be a replica set (or set OUTBOX_STANDALONE=true to save the events after their change)")
+)
+
+// OutboxCollection has the domain events of every write, the database functions save their events here themselves
+var OutboxCollection *mongo.Collection = OutboxData(Client, "Outbox")
+
+// NewEvent makes a pending event of the outbox, data becomes the json of the event
+func NewEvent(eventType string, aggregateId string, data any) (models.DomainEvent, error) {
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Println(err)
+		return models.DomainEvent{}, ErrCantSaveEvent
+	}
+
+	now := time.Now()
+	return models.DomainEvent{
+		Event_ID:        primitive.NewObjectID(),
+		Type:            eventType,
+		Aggregate_ID:    aggregateId,
+		Data:            raw,
+		Occurred_At:     now,
+		Status:          models.OutboxPending,
+		Published_To:    make([]string, 0),
+		Next_Attempt_At: now,
+	}, nil
+}
+
+// Whether the server can run transactions, a standalone server can't (only a replica set or a sharded cluster can).
+// Only an answer of the server is kept ; when it can't be asked, the next write asks again.
+var transactions struct {
+	mu        sync.Mutex
+	known     bool
+	supported bool
+}
+
+func transactionsSupported(ctx context.Context) (bool, error) {
+	transactions.mu.Lock()
+	defer transactions.mu.Unlock()
+
+	if transactions.known {
+		return transactions.supported, nil
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := Client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		log.Println("Error while asking the server about transactions ", err)
+		return false, ErrCantSaveEvent
+	}
+
+	transactions.supported = hello.SetName != "" || hello.Msg == "isdbgrid"
+	transactions.known = true
+	return transactions.supported, nil
+}
+
+// CheckTransactions is called once at the start of the server. Without transactions a change and its events can't be
+// saved together, so a standalone server is refused unless OUTBOX_STANDALONE=true says that is fine (e.g. for local development).
+func CheckTransactions(ctx context.Context) error {
+	supported, err := transactionsSupported(ctx)
+	if err != nil {
+		return err
+	}
+	if supported {
+		return nil
+	}
+	if constants.OUTBOX_STANDALONE != "true" {
+		return ErrNoTransactions
+	}
+
+	log.Println("WARNING :- MongoDB is a standalone server and OUTBOX_STANDALONE=true, the events are saved right after their change ; when that fails the event is lost")
+	return nil
+}
+
+// withEvents runs a write and saves the events it returns in one transaction :- either the change and its events are saved or none of them.
+// write must do all its updates with the context it gets, that context carries the transaction.
+// Without transactions the write is refused, unless OUTBOX_STANDALONE=true :- then the events are saved right after the write
+// and an event which can't be saved is lost, the change itself is already done.
+func withEvents(ctx context.Context, write func(ctx context.Context) ([]models.DomainEvent, error)) error {
+
+	supported, err := transactionsSupported(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		if constants.OUTBOX_STANDALONE != "true" {
+			log.Println(ErrNoTransactions)
+			return ErrNoTransactions
+		}
+
+		events, err := write(ctx)
+		if err != nil {
+			return err
+		}
+		if err = saveEvents(ctx, events); err != nil {
+			log.Println("ERROR :- the change is saved but its events are lost (OUTBOX_STANDALONE=true) ", err)
+		}
+		return nil
+	}
+
+	session, err := Client.StartSession()
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveEvent
+	}
+	defer session.EndSession(ctx)
+
+	// WithTransaction commits, or aborts when the write or the events fail and runs everything again on a transient error
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (any, error) {
+		events, err := write(sessionCtx)
+		if err != nil {
+			return nil, err
+		}
+		return nil, saveEvents(sessionCtx, events)
+	})
+	return err
+}
+
+func saveEvents(ctx context.Context, events []models.DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	documents := make([]any, 0, len(events))
+	for _, event := range events {
+		documents = append(documents, event)
+	}
+
+	if _, err := OutboxCollection.InsertMany(ctx, documents); err != nil {
+		log.Println(err)
+		return ErrCantSaveEvent
+	}
+	return nil
+}
+
+// eventList makes the events of a write, an event which can't be made stops the write
+func eventList(events ...func() (models.DomainEvent, error)) ([]models.DomainEvent, error) {
+	list := make([]models.DomainEvent, 0, len(events))
+	for _, event := range events {
+		e, err := event()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, nil
+}
+
+// cartEvent is the CartUpdated event of the cart of a user ; variantId and quantity are left out when the whole cart changed
+func cartEvent(userId primitive.ObjectID, reason string, variantId primitive.ObjectID, quantity int) func() (models.DomainEvent, error) {
+	return func() (models.DomainEvent, error) {
+		data := map[string]any{"user_id": userId.Hex(), "reason": reason}
+		if !variantId.IsZero() {
+			data["variant_id"] = variantId.Hex()
+			data["quantity"] = quantity
+		}
+		return NewEvent(models.EventCartUpdated, userId.Hex(), data)
+	}
+}
+
+// productEvent is the ProductChanged event of a product, sku is empty when the change is not about one variant
+func productEvent(productId primitive.ObjectID, change string, sku string) func() (models.DomainEvent, error) {
+	return func() (models.DomainEvent, error) {
+		data := map[string]any{"product_id": productId.Hex(), "change": change}
+		if sku != "" {
+			data["sku"] = sku
+		}
+		return NewEvent(models.EventProductChanged, productId.Hex(), data)
+	}
+}
+
+// orderEvent is the OrderPlaced event, it has the whole order with its lines, prices and addresses
+func orderEvent(userId primitive.ObjectID, order models.Order) func() (models.DomainEvent, error) {
+	return func() (models.DomainEvent, error) {
+		return NewEvent(models.EventOrderPlaced, order.Order_ID.Hex(), map[string]any{"user_id": userId.Hex(), "order": order})
+	}
+}
+
+// ClaimEvent gives the oldest event which is due, locked for the dispatcher until the lease is over.
+// A dispatcher which stopped in the middle of an event loses its lock when the lease is over, the event is claimed again.
+func ClaimEvent(ctx context.Context, outboxCollection *mongo.Collection, lease time.Duration) (models.DomainEvent, bool, error) {
+
+	now := time.Now()
+	filter := bson.D{
+		{Key: "status", Value: models.OutboxPending},
+		{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "locked_until", Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "locked_until", Value: bson.D{{Key: "$lt", Value: now}}}},
+		}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "locked_until", Value: now.Add(lease)}}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "occurred_at", Value: 1}}).SetReturnDocument(options.After)
+
+	var event models.DomainEvent
+	err := outboxCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.DomainEvent{}, false, nil
+	}
+	if err != nil {
+		log.Println(err)
+		return models.DomainEvent{}, false, ErrCantClaimEvent
+	}
+
+	return event, true, nil
+}
+
+// claimedEvent matches the event only while this attempt still holds it
+func claimedEvent(event models.DomainEvent) bson.D {
+	return bson.D{{Key: "_id", Value: event.Event_ID}, {Key: "status", Value: models.OutboxPending}, {Key: "attempts", Value: event.Attempts}}
+}
+
+// RecordEventAttempt writes down which sinks got the event in this attempt.
+// Without an error the event is published ; otherwise it waits until retryAt for the sinks which are left, or fails when retryAt is nil.
+func RecordEventAttempt(ctx context.Context, outboxCollection *mongo.Collection, event models.DomainEvent, publishedTo []string, publishErr error, retryAt *time.Time) error {
+
+	if publishedTo == nil {
+		publishedTo = make([]string, 0) // $each needs an array
+	}
+
+	set := bson.D{}
+	switch {
+	case publishErr == nil:
+		set = append(set, bson.E{Key: "status", Value: models.OutboxPublished}, bson.E{Key: "published_at", Value: time.Now()})
+	case retryAt != nil:
+		set = append(set, bson.E{Key: "next_attempt_at", Value: *retryAt}, bson.E{Key: "last_error", Value: publishErr.Error()})
+	default:
+		set = append(set, bson.E{Key: "status", Value: models.OutboxFailed}, bson.E{Key: "last_error", Value: publishErr.Error()})
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$unset", Value: bson.D{{Key: "locked_until", Value: ""}}},
+		{Key: "$addToSet", Value: bson.D{{Key: "published_to", Value: bson.D{{Key: "$each", Value: publishedTo}}}}},
+	}
+
+	if _, err := outboxCollection.UpdateOne(ctx, claimedEvent(event), update); err != nil {
+		log.Println(err)
+		return ErrCantUpdateEvent
+	}
+
+	return nil
+}
+
+// RetryEvent sends a failed event again with all its attempts, only to the sinks which did not get it yet
+func RetryEvent(ctx context.Context, outboxCollection *mongo.Collection, eventId primitive.ObjectID) (models.DomainEvent, error) {
+
+	filter := bson.D{{Key: "_id", Value: eventId}, {Key: "status", Value: models.OutboxFailed}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: models.OutboxPending},
+		{Key: "attempts", Value: 0},
+		{Key: "next_attempt_at", Value: time.Now()},
+	}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var event models.DomainEvent
+	err := outboxCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.DomainEvent{}, ErrCantFindEvent
+	}
+	if err != nil {
+		log.Println(err)
+		return models.DomainEvent{}, ErrCantUpdateEvent
+	}
+
+	return event, nil
+}
+
+// ListEvents gives the newest events first, only the ones with this status and type when they are not empty
+func ListEvents(ctx context.Context, outboxCollection *mongo.Collection, status string, eventType string, limit int64) ([]models.DomainEvent, error) {
+
+	filter := bson.D{}
+	if status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: status})
+	}
+	if eventType != "" {
+		filter = append(filter, bson.E{Key: "type", Value: eventType})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "occurred_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := outboxCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+	defer cursor.Close(ctx)
+
+	events := make([]models.DomainEvent, 0)
+	if err = cursor.All(ctx, &events); err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+
+	return events, nil
+}
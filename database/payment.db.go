@@ -0,0 +1,380 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"ecommerce/payment"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindOrder     = errors.New("can't find this order")
+	ErrCantUpdatePayment = errors.New("cannot update the payment of the order")
+	ErrNotDigitalOrder   = errors.New("this order is not paid online")
+	ErrPaymentEventBusy  = errors.New("this payment event is being handled, send it again later")
+)
+
+// The states of a recorded webhook event. The records written before the status existed count as done.
+const (
+	paymentEventProcessing = "processing"
+	paymentEventDone       = "done"
+)
+
+// How long a delivery may take to handle an event, after that the handling is taken as crashed and a new delivery takes it over
+const paymentEventLease = 5 * time.Minute
+
+// RecordPaymentEvent claims a webhook event before it is handled ; false means the event was already handled.
+// The event id is the _id of the document, so two deliveries of the same event can never both be handled at once.
+// The event only counts as handled after CompletePaymentEvent, so when the service dies in between, the next delivery
+// of the gateway handles it again instead of dropping it.
+func RecordPaymentEvent(ctx context.Context, eventCollection *mongo.Collection, event payment.Event) (bool, error) {
+	now := time.Now()
+	document := bson.D{
+		{Key: "_id", Value: event.ID},
+		{Key: "type", Value: event.Type},
+		{Key: "intent_id", Value: event.Intent.ID},
+		{Key: "status", Value: paymentEventProcessing},
+		{Key: "received_at", Value: now},
+	}
+
+	_, err := eventCollection.InsertOne(ctx, document)
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		log.Println(err)
+		return false, ErrCantUpdatePayment
+	}
+
+	// The event is known, it is taken over only when its handling started long ago and never finished
+	filter := bson.D{
+		{Key: "_id", Value: event.ID},
+		{Key: "status", Value: paymentEventProcessing},
+		{Key: "received_at", Value: bson.D{{Key: "$lt", Value: now.Add(-paymentEventLease)}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "received_at", Value: now}}}}
+
+	result, err := eventCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return false, ErrCantUpdatePayment
+	}
+	if result.ModifiedCount == 1 {
+		return true, nil
+	}
+
+	var recorded struct {
+		Status string `bson:"status"`
+	}
+	err = eventCollection.FindOne(ctx, bson.D{{Key: "_id", Value: event.ID}}).Decode(&recorded)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// It was forgotten in the meantime because its handling failed, the gateway delivers it again
+		return false, ErrPaymentEventBusy
+	}
+	if err != nil {
+		log.Println(err)
+		return false, ErrCantUpdatePayment
+	}
+	if recorded.Status == paymentEventProcessing {
+		// Another delivery is still handling it, the gateway must not take this one as a success
+		return false, ErrPaymentEventBusy
+	}
+
+	return false, nil
+}
+
+// CompletePaymentEvent marks an event as handled, every later delivery of it is a duplicate
+func CompletePaymentEvent(ctx context.Context, eventCollection *mongo.Collection, eventId string) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: paymentEventDone}, {Key: "handled_at", Value: time.Now()}}}}
+
+	if _, err := eventCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: eventId}}, update); err != nil {
+		log.Println(err)
+		return ErrCantUpdatePayment
+	}
+	return nil
+}
+
+// ForgetPaymentEvent removes an event which could not be handled, so the gateway can deliver it again
+func ForgetPaymentEvent(ctx context.Context, eventCollection *mongo.Collection, eventId string) {
+	if _, err := eventCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: eventId}}); err != nil {
+		log.Println("Error while removing the payment event ", err)
+	}
+}
+
+// FindOrder finds an order of any user by its id and returns the id of its user with it
+func FindOrder(ctx context.Context, userCollection *mongo.Collection, orderId primitive.ObjectID) (primitive.ObjectID, models.Order, error) {
+	return findOrder(ctx, userCollection, bson.D{{Key: "orders._id", Value: orderId}})
+}
+
+// FindOrderByIntent finds the order a payment of the gateway belongs to
+func FindOrderByIntent(ctx context.Context, userCollection *mongo.Collection, intentId string) (primitive.ObjectID, models.Order, error) {
+	return findOrder(ctx, userCollection, bson.D{{Key: "orders.payment_method.intent_id", Value: intentId}})
+}
+
+// The positional projection "orders.$" gives back only the order which matched the filter
+func findOrder(ctx context.Context, userCollection *mongo.Collection, filter bson.D) (primitive.ObjectID, models.Order, error) {
+	var user models.User
+
+	opts := options.FindOne().SetProjection(bson.D{{Key: "orders.$", Value: 1}})
+	err := userCollection.FindOne(ctx, filter, opts).Decode(&user)
+	if err != nil || len(user.Order_Status) == 0 {
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Println(err)
+		}
+		return primitive.NilObjectID, models.Order{}, ErrCantFindOrder
+	}
+
+	return user.ID, user.Order_Status[0], nil
+}
+
+// ApplyPaymentIntent copies the state of a payment at the gateway into its order.
+// A state the payment already went past is ignored (webhooks can come twice or out of order), and the update only
+// goes through if the payment status did not change since it was read, so only one request moves an order on.
+// A payment which failed or was voided cancels the order and gives its stock and coupon back.
+func ApplyPaymentIntent(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, intent payment.Intent) (models.Order, error) {
+
+	for attempt := 0; attempt < 3; attempt++ {
+		userId, order, err := FindOrderByIntent(ctx, userCollection, intent.ID)
+		if err != nil {
+			return models.Order{}, err
+		}
+
+		current := order.Payment_Method.Status
+		refunded := order.Payment_Method.Refunded
+
+		order, changed := payment.ApplyIntent(order, intent)
+		if !changed {
+			return order, nil
+		}
+
+		filter := bson.D{
+			{Key: "_id", Value: userId},
+			{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+				{Key: "_id", Value: order.Order_ID},
+				{Key: "payment_method.status", Value: current},
+				{Key: "payment_method.refunded", Value: refunded},
+			}}}},
+		}
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "orders.$.status", Value: order.Status},
+			{Key: "orders.$.payment_method.status", Value: order.Payment_Method.Status},
+			{Key: "orders.$.payment_method.captured", Value: order.Payment_Method.Captured},
+			{Key: "orders.$.payment_method.refunded", Value: order.Payment_Method.Refunded},
+			{Key: "orders.$.refunded", Value: order.Payment_Method.Refunded}, // Everything of a digital order is refunded through the gateway
+		}}}
+
+		result, err := userCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			log.Println(err)
+			return models.Order{}, ErrCantUpdatePayment
+		}
+
+		// Someone else moved the payment in the meantime, read it again
+		if result.MatchedCount == 0 {
+			continue
+		}
+
+		if intent.Status == payment.StatusFailed || intent.Status == payment.StatusVoided {
+			releaseOrder(ctx, prodCollection, couponCollection, userId.Hex(), order)
+		}
+
+		return order, nil
+	}
+
+	return models.Order{}, ErrCantUpdatePayment
+}
+
+// ProcessPaymentEvent handles one webhook event once. With autoCapture an authorized payment is captured straight away.
+// It returns false for an event which was already handled.
+func ProcessPaymentEvent(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, eventCollection *mongo.Collection, provider payment.Provider, event payment.Event, autoCapture bool) (bool, error) {
+
+	fresh, err := RecordPaymentEvent(ctx, eventCollection, event)
+	if err != nil || !fresh {
+		return false, err
+	}
+
+	order, err := ApplyPaymentIntent(ctx, prodCollection, userCollection, couponCollection, event.Intent)
+	if err != nil {
+		ForgetPaymentEvent(ctx, eventCollection, event.ID)
+		return false, err
+	}
+
+	// The order is updated already ; if this fails the event is handled again after the lease, which changes nothing
+	// because the order only moves forward
+	if err := CompletePaymentEvent(ctx, eventCollection, event.ID); err != nil {
+		log.Println("Error while completing the payment event ", err)
+	}
+
+	if autoCapture && event.Type == payment.EventAuthorized && order.Payment_Method.Status == payment.StatusAuthorized {
+		// A failed capture leaves the payment authorized, the admin can capture it later
+		if _, err := CapturePayment(ctx, prodCollection, userCollection, couponCollection, provider, order); err != nil {
+			log.Println("Error while capturing the payment ", err)
+		}
+	}
+
+	return true, nil
+}
+
+// CapturePayment takes the money of an authorized payment
+func CapturePayment(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, provider payment.Provider, order models.Order) (models.Order, error) {
+	if err := checkDigitalOrder(provider, order); err != nil {
+		return models.Order{}, err
+	}
+
+	intent, err := provider.Capture(ctx, order.Payment_Method.Intent_ID)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	return ApplyPaymentIntent(ctx, prodCollection, userCollection, couponCollection, intent)
+}
+
+// RefundPayment gives back part or all of a captured payment, the zero amount refunds everything which is left
+func RefundPayment(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, provider payment.Provider, order models.Order, amount models.Money) (models.Order, error) {
+	if err := checkDigitalOrder(provider, order); err != nil {
+		return models.Order{}, err
+	}
+
+	if amount.IsZero() {
+		amount = order.Payment_Method.Captured.Sub(order.Payment_Method.Refunded)
+	}
+
+	intent, err := provider.Refund(ctx, order.Payment_Method.Intent_ID, amount)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	return ApplyPaymentIntent(ctx, prodCollection, userCollection, couponCollection, intent)
+}
+
+// VoidPayment cancels a payment which was not captured yet, the order is cancelled with it
+func VoidPayment(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, provider payment.Provider, order models.Order) (models.Order, error) {
+	if err := checkDigitalOrder(provider, order); err != nil {
+		return models.Order{}, err
+	}
+
+	intent, err := provider.Void(ctx, order.Payment_Method.Intent_ID)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	return ApplyPaymentIntent(ctx, prodCollection, userCollection, couponCollection, intent)
+}
+
+func checkDigitalOrder(provider payment.Provider, order models.Order) error {
+	if order.Payment_Method.Intent_ID == "" {
+		return ErrNotDigitalOrder
+	}
+	if provider == nil || provider.Name() != order.Payment_Method.Provider {
+		return payment.ErrPaymentUnavailable
+	}
+	return nil
+}
+
+// releaseOrder gives back the stock and the coupon of an order which will never be paid
+func releaseOrder(ctx context.Context, prodCollection *mongo.Collection, couponCollection *mongo.Collection, userQueryID string, order models.Order) {
+	for _, line := range order.Order_Cart {
+		ReleaseVariantStock(ctx, prodCollection, line)
+	}
+
+	if order.Coupon_Code == nil {
+		return
+	}
+
+	coupon, err := FindCouponByCode(ctx, couponCollection, *order.Coupon_Code)
+	if err != nil {
+		log.Println("Error while releasing the coupon of the order ", err)
+		return
+	}
+	ReleaseCoupon(ctx, couponCollection, coupon, userQueryID)
+}
+
+// PendingOrder is a digital order which still waits for its payment, with the user it belongs to
+type PendingOrder struct {
+	User_ID primitive.ObjectID `bson:"_id"`
+	Order   models.Order       `bson:"orders"`
+}
+
+// StalePendingOrders finds the digital orders which were placed before the cutoff and are still not paid, the oldest first.
+// Only the payments nobody started are taken :- an authorized payment waits for the admin to capture or void it, it would only come back on every run.
+func StalePendingOrders(ctx context.Context, userCollection *mongo.Collection, cutoff time.Time, limit int64) ([]PendingOrder, error) {
+
+	notStarted := bson.A{payment.StatusRequiresPayment, nil}
+	stale := bson.D{
+		{Key: "orders.status", Value: models.OrderPendingPayment},
+		{Key: "orders.ordered_at", Value: bson.D{{Key: "$lt", Value: cutoff}}},
+		{Key: "orders.payment_method.status", Value: bson.D{{Key: "$in", Value: notStarted}}},
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+			{Key: "status", Value: models.OrderPendingPayment},
+			{Key: "ordered_at", Value: bson.D{{Key: "$lt", Value: cutoff}}},
+			{Key: "payment_method.status", Value: bson.D{{Key: "$in", Value: notStarted}}},
+		}}}}}}},
+		{{Key: "$unwind", Value: "$orders"}},
+		{{Key: "$match", Value: stale}},
+		{{Key: "$sort", Value: bson.D{{Key: "orders.ordered_at", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$project", Value: bson.D{{Key: "orders", Value: 1}}}},
+	}
+
+	cursor, err := userCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+	defer cursor.Close(ctx)
+
+	orders := make([]PendingOrder, 0)
+	if err = cursor.All(ctx, &orders); err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+
+	return orders, nil
+}
+
+// ExpirePendingOrder cancels a digital order nobody paid in time and gives its stock and coupon back.
+// The payment is voided at the gateway first ; a gateway which does not know the intent any more (e.g. the mock after a restart)
+// or is not in use any more can't take the money either, so the order is voided here. A payment which moved on at the gateway
+// (authorized or captured meanwhile) can't be voided ; its webhook may never have arrived, so the intent is read from the gateway
+// and the order is brought up to date with it.
+func ExpirePendingOrder(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, provider payment.Provider, order models.Order) error {
+
+	if order.Payment_Method.Intent_ID == "" {
+		return ErrNotDigitalOrder
+	}
+
+	intent := payment.Intent{
+		ID:       order.Payment_Method.Intent_ID,
+		Status:   payment.StatusVoided,
+		Captured: order.Payment_Method.Captured,
+		Refunded: order.Payment_Method.Refunded,
+	}
+
+	if provider != nil && provider.Name() == order.Payment_Method.Provider {
+		voided, err := provider.Void(ctx, order.Payment_Method.Intent_ID)
+		switch {
+		case err == nil:
+			intent = voided
+		case errors.Is(err, payment.ErrInvalidTransition):
+			intent, err = provider.GetIntent(ctx, order.Payment_Method.Intent_ID)
+			if err != nil {
+				return err
+			}
+		case !errors.Is(err, payment.ErrCantFindIntent):
+			return err
+		}
+	}
+
+	// The update only goes through while the payment is still where it was read, a webhook in the meantime wins
+	_, err := ApplyPaymentIntent(ctx, prodCollection, userCollection, couponCollection, intent)
+	return err
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"ecommerce/pricing"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindPromotion = errors.New("can't find this promotion")
+	ErrCantSavePromotion = errors.New("cannot save the promotion")
+	ErrCantPriceCart     = errors.New("cannot work out the price of the cart")
+)
+
+func CreatePromotion(ctx context.Context, promotionCollection *mongo.Collection, promotion models.Promotion) (models.Promotion, error) {
+
+	promotion.Promotion_ID = primitive.NewObjectID()
+	promotion.Created_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	_, err := promotionCollection.InsertOne(ctx, promotion)
+	if err != nil {
+		log.Println(err)
+		return promotion, ErrCantSavePromotion
+	}
+
+	return promotion, nil
+}
+
+// ListPromotions gives all the promotions in the order they are applied, onlyActive leaves out the switched off ones
+func ListPromotions(ctx context.Context, promotionCollection *mongo.Collection, onlyActive bool) ([]models.Promotion, error) {
+
+	promotions := make([]models.Promotion, 0)
+
+	filter := bson.D{}
+	if onlyActive {
+		filter = bson.D{{Key: "active", Value: true}}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "_id", Value: 1}})
+	cursor, err := promotionCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return promotions, ErrCantFindPromotion
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &promotions); err != nil {
+		log.Println(err)
+		return promotions, ErrCantFindPromotion
+	}
+
+	return promotions, nil
+}
+
+func SetPromotionActive(ctx context.Context, promotionCollection *mongo.Collection, promotionId primitive.ObjectID, active bool) error {
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "active", Value: active}}}}
+	result, err := promotionCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: promotionId}}, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSavePromotion
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrCantFindPromotion
+	}
+
+	return nil
+}
+
+// PriceCart loads everything the pricing rules need (categories, active promotions and the coupon) and quotes the cart lines.
+// The coupon which was found is returned as well so the checkout can redeem it ; a missing or unusable coupon only ends up in quote.CouponErr.
+func PriceCart(ctx context.Context, prodCollection *mongo.Collection, couponCollection *mongo.Collection, promotionCollection *mongo.Collection, userQueryID string, cart []models.ProductUser, couponCode *string) (pricing.CartQuote, *models.Coupon, error) {
+
+	lines, err := PricingLines(ctx, prodCollection, cart)
+	if err != nil {
+		return pricing.CartQuote{}, nil, err
+	}
+	if err = pricing.CheckLines(lines); err != nil {
+		log.Println(err)
+		return pricing.CartQuote{}, nil, ErrCantPriceCart
+	}
+
+	promotions, err := ListPromotions(ctx, promotionCollection, true)
+	if err != nil {
+		return pricing.CartQuote{}, nil, ErrCantPriceCart
+	}
+
+	var coupon *models.Coupon
+	var couponErr error
+	if couponCode != nil {
+		found, err := FindCouponByCode(ctx, couponCollection, *couponCode)
+		if err != nil {
+			couponErr = err
+		} else {
+			// The per customer limit is checked with the uses of this customer
+			if found.Used_By_User, err = couponRedemptions(ctx, found.Coupon_ID, userQueryID); err != nil {
+				return pricing.CartQuote{}, nil, ErrCantPriceCart
+			}
+			coupon = &found
+		}
+	}
+
+	quote := pricing.QuoteCart(lines, promotions, coupon, time.Now())
+	if couponErr != nil {
+		quote.SetCouponError(couponErr)
+	}
+
+	return quote, coupon, nil
+}
+
+// PricingLines turns the cart lines into pricing lines ; the category and the tax class are not copied into the cart so they are read from the products in one query
+func PricingLines(ctx context.Context, prodCollection *mongo.Collection, cart []models.ProductUser) ([]pricing.Line, error) {
+
+	productIds := make([]primitive.ObjectID, 0, len(cart))
+	for _, line := range cart {
+		productIds = append(productIds, line.Product_ID)
+	}
+
+	opts := options.Find().SetProjection(bson.D{{Key: "category", Value: 1}, {Key: "tax_class", Value: 1}})
+	cursor, err := prodCollection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: productIds}}}}, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantDecodeProducts
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err = cursor.All(ctx, &products); err != nil {
+		log.Println(err)
+		return nil, ErrCantDecodeProducts
+	}
+
+	categories := make(map[primitive.ObjectID]string, len(products))
+	taxClasses := make(map[primitive.ObjectID]string, len(products))
+	for _, product := range products {
+		if product.Category != nil {
+			categories[product.Product_ID] = *product.Category
+		}
+		taxClasses[product.Product_ID] = product.Tax_Class
+	}
+
+	lines := make([]pricing.Line, 0, len(cart))
+	for _, line := range cart {
+		lines = append(lines, pricing.Line{
+			Product_ID: line.Product_ID,
+			Variant_ID: line.Variant_ID,
+			Category:   categories[line.Product_ID],
+			Tax_Class:  taxClasses[line.Product_ID],
+			Price:      line.Price,
+			Quantity:   int64(cartLineQuantity(line)),
+		})
+	}
+
+	return lines, nil
+}
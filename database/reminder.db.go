@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindAbandonedCarts = errors.New("can't find the abandoned carts")
+	ErrCantRecordCartReminder = errors.New("cannot save the cart reminder")
+)
+
+// A cart is abandoned when it has lines and cart_updated_at is older than the idle period.
+// cart_reminded keeps the cart_updated_at of the cart the last reminder was about, so one version of a cart gets one reminder ;
+// a change of the cart moves cart_updated_at and the cart can be reminded about again once it is idle again.
+
+// AbandonedCarts finds up to limit carts of accounts which were not changed for idleFor and were not reminded about yet.
+// Guests are left out, they have no email to remind.
+func AbandonedCarts(ctx context.Context, userCollection *mongo.Collection, idleFor time.Duration, limit int64) ([]models.User, error) {
+
+	filter := bson.D{
+		{Key: "guest", Value: bson.D{{Key: "$ne", Value: true}}},
+		{Key: "user_cart.0", Value: bson.D{{Key: "$exists", Value: true}}},
+		{Key: "cart_updated_at", Value: bson.D{{Key: "$lte", Value: time.Now().Add(-idleFor)}}},
+		{Key: "$expr", Value: bson.D{{Key: "$ne", Value: bson.A{"$cart_reminded", "$cart_updated_at"}}}},
+	}
+
+	// Only what the reminder is written from, never the password or the tokens
+	projection := bson.D{
+		{Key: "first_name", Value: 1},
+		{Key: "email", Value: 1},
+		{Key: "user_cart", Value: 1},
+		{Key: "cart_updated_at", Value: 1},
+	}
+
+	opts := options.Find().SetProjection(projection).SetSort(bson.D{{Key: "cart_updated_at", Value: 1}}).SetLimit(limit)
+
+	cursor, err := userCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantFindAbandonedCarts
+	}
+	defer cursor.Close(ctx)
+
+	users := make([]models.User, 0)
+	if err = cursor.All(ctx, &users); err != nil {
+		log.Println(err)
+		return nil, ErrCantFindAbandonedCarts
+	}
+
+	return users, nil
+}
+
+// ClaimCartReminder marks this version of the cart as reminded before the reminder goes out.
+// It gives false when the cart changed meanwhile or another instance of the service claimed it first, then no reminder is sent.
+func ClaimCartReminder(ctx context.Context, userCollection *mongo.Collection, userId primitive.ObjectID, cartUpdatedAt time.Time) (bool, error) {
+
+	filter := bson.D{
+		{Key: "_id", Value: userId},
+		{Key: "cart_updated_at", Value: cartUpdatedAt},
+		{Key: "cart_reminded", Value: bson.D{{Key: "$ne", Value: cartUpdatedAt}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "cart_reminded", Value: cartUpdatedAt}}}}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return false, ErrCantUpdateUser
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// ReleaseCartReminder takes the claim back when the reminder could not be sent, so the next run tries again
+func ReleaseCartReminder(ctx context.Context, userCollection *mongo.Collection, userId primitive.ObjectID, cartUpdatedAt time.Time) error {
+
+	filter := bson.D{{Key: "_id", Value: userId}, {Key: "cart_reminded", Value: cartUpdatedAt}}
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "cart_reminded", Value: ""}}}}
+
+	if _, err := userCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantUpdateUser
+	}
+
+	return nil
+}
+
+// RecordCartReminder saves a sent or a failed reminder, the record shows which reminders a user got
+func RecordCartReminder(ctx context.Context, reminderCollection *mongo.Collection, reminder models.CartReminder) error {
+
+	reminder.Reminder_ID = primitive.NewObjectID()
+
+	if _, err := reminderCollection.InsertOne(ctx, reminder); err != nil {
+		log.Println(err)
+		return ErrCantRecordCartReminder
+	}
+
+	return nil
+}
+
+// ListCartReminders gives the newest reminders first, only the ones of one user when userQueryID is not empty
+func ListCartReminders(ctx context.Context, reminderCollection *mongo.Collection, userQueryID string, limit int64) ([]models.CartReminder, error) {
+
+	filter := bson.D{}
+	if userQueryID != "" {
+		filter = bson.D{{Key: "user_id", Value: userQueryID}}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "sent_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := reminderCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+	defer cursor.Close(ctx)
+
+	reminders := make([]models.CartReminder, 0)
+	if err = cursor.All(ctx, &reminders); err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+
+	return reminders, nil
+}
@@ -0,0 +1,377 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"ecommerce/payment"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindReturn      = errors.New("can't find this return")
+	ErrCantSaveReturn      = errors.New("cannot save the return")
+	ErrOrderNotReturnable  = errors.New("this order can't be returned")
+	ErrReturnWindowClosed  = errors.New("the return window of this order is over")
+	ErrReturnQuantity      = errors.New("more pieces than were ordered or are already returned")
+	ErrReturnStatus        = errors.New("the return can't move to this status")
+	ErrRefundTooLarge      = errors.New("the refund is more than what is left to refund")
+	ErrCantRecordRefund    = errors.New("cannot record the refund of the order")
+	ErrReturnLineNotInCart = errors.New("this variant is not in the order")
+)
+
+// The statuses a return can move to from each status
+var returnSteps = map[string][]string{
+	models.ReturnRequested: {models.ReturnApproved, models.ReturnRejected},
+	models.ReturnApproved:  {models.ReturnReceived, models.ReturnRejected},
+	models.ReturnReceived:  {models.ReturnRefunded},
+}
+
+// CreateReturn opens a return for some lines of an order of the user.
+// The pieces are counted on the order lines straight away (in one conditional update), so two returns can never send back more than was bought.
+func CreateReturn(ctx context.Context, userCollection *mongo.Collection, returnCollection *mongo.Collection, userQueryID string, request models.ReturnRequest, window time.Duration) (models.Return, error) {
+
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		log.Println(err)
+		return models.Return{}, ErrUserIdIsNotValid
+	}
+
+	// The filter has the user id too, so a customer can only return their own orders
+	_, order, err := findOrder(ctx, userCollection, bson.D{{Key: "_id", Value: userId}, {Key: "orders._id", Value: request.Order_ID}})
+	if err != nil {
+		return models.Return{}, err
+	}
+
+	if !refundableOrder(order) {
+		return models.Return{}, ErrOrderNotReturnable
+	}
+
+	if time.Since(order.Ordered_At) > window {
+		return models.Return{}, ErrReturnWindowClosed
+	}
+
+	lines, err := returnLines(order, request.Lines)
+	if err != nil {
+		return models.Return{}, err
+	}
+
+	now := time.Now()
+	rma := models.Return{
+		Return_ID:     primitive.NewObjectID(),
+		Order_ID:      order.Order_ID,
+		User_ID:       userQueryID,
+		Lines:         lines,
+		Reason:        request.Reason,
+		Status:        models.ReturnRequested,
+		Refund_Amount: models.NewMoney(0, order.Price.Currency),
+		Refunded:      models.NewMoney(0, order.Price.Currency),
+		Created_At:    now,
+		Updated_At:    now,
+	}
+	for _, line := range lines {
+		rma.Refund_Amount = rma.Refund_Amount.Add(line.Refund)
+	}
+
+	if err = reserveReturn(ctx, userCollection, userId, order, lines); err != nil {
+		return models.Return{}, err
+	}
+
+	if _, err = returnCollection.InsertOne(ctx, rma); err != nil {
+		log.Println(err)
+		releaseReturn(ctx, userCollection, userId, order.Order_ID, lines)
+		return models.Return{}, ErrCantSaveReturn
+	}
+
+	return rma, nil
+}
+
+// returnLines checks the requested lines against the order (one line per variant) and prices them
+func returnLines(order models.Order, requested []models.ReturnLine) ([]models.ReturnLine, error) {
+	lines := make([]models.ReturnLine, 0, len(requested))
+	index := make(map[primitive.ObjectID]int)
+
+	for _, line := range requested {
+		if i, ok := index[line.Variant_ID]; ok {
+			lines[i].Quantity += line.Quantity
+			continue
+		}
+		index[line.Variant_ID] = len(lines)
+		lines = append(lines, line)
+	}
+
+	for i, line := range lines {
+		ordered, ok := orderLine(order, line.Variant_ID)
+		if !ok {
+			return nil, ErrReturnLineNotInCart
+		}
+		if line.Quantity > cartLineQuantity(ordered)-ordered.Returned {
+			return nil, ErrReturnQuantity
+		}
+
+		lines[i].Product_ID = ordered.Product_ID
+		lines[i].Refund = returnRefund(order, ordered, line.Quantity)
+	}
+
+	return lines, nil
+}
+
+func orderLine(order models.Order, variantId primitive.ObjectID) (models.ProductUser, bool) {
+	for _, line := range order.Order_Cart {
+		if line.Variant_ID == variantId {
+			return line, true
+		}
+	}
+	return models.ProductUser{}, false
+}
+
+// returnRefund is what the customer paid for some pieces of an order line :- the order total without the shipping
+// (so after every discount and with the tax) shared in the ratio of the line prices. The shipping is not refunded.
+func returnRefund(order models.Order, line models.ProductUser, quantity int) models.Money {
+	paid := order.Price.Sub(order.Shipping.Price)
+	if order.Subtotal.Amount <= 0 || paid.IsNegative() {
+		return models.NewMoney(0, order.Price.Currency)
+	}
+	return paid.MulRatio(line.Price.Mul(int64(quantity)).Amount, order.Subtotal.Amount)
+}
+
+// reserveReturn counts the pieces on the order lines, only if every line still has that many pieces left.
+// A missing "returned" field is 0, so the condition is "returned is not more than quantity - pieces".
+func reserveReturn(ctx context.Context, userCollection *mongo.Collection, userId primitive.ObjectID, order models.Order, lines []models.ReturnLine) error {
+	conditions := bson.A{}
+	for _, line := range lines {
+		ordered, _ := orderLine(order, line.Variant_ID)
+		conditions = append(conditions, bson.D{{Key: "$elemMatch", Value: bson.D{
+			{Key: "variant_id", Value: line.Variant_ID},
+			{Key: "returned", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$gt", Value: cartLineQuantity(ordered) - line.Quantity}}}}},
+		}}})
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: userId},
+		{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+			{Key: "_id", Value: order.Order_ID},
+			{Key: "order_list", Value: bson.D{{Key: "$all", Value: conditions}}},
+		}}}},
+	}
+
+	result, err := userCollection.UpdateOne(ctx, filter, returnedUpdate(lines, 1), returnedFilters(order.Order_ID, lines))
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveReturn
+	}
+	if result.MatchedCount == 0 {
+		return ErrReturnQuantity
+	}
+
+	return nil
+}
+
+// releaseReturn takes the pieces of a rejected (or unsaved) return off the order lines again
+func releaseReturn(ctx context.Context, userCollection *mongo.Collection, userId primitive.ObjectID, orderId primitive.ObjectID, lines []models.ReturnLine) {
+	filter := bson.D{{Key: "_id", Value: userId}}
+	if _, err := userCollection.UpdateOne(ctx, filter, returnedUpdate(lines, -1), returnedFilters(orderId, lines)); err != nil {
+		log.Println("Error while releasing the returned pieces ", err)
+	}
+}
+
+// The array filters "order" and "l0", "l1" ... point the $inc at the order and at each of its returned lines
+func returnedUpdate(lines []models.ReturnLine, sign int) bson.D {
+	inc := bson.D{}
+	for i, line := range lines {
+		inc = append(inc, bson.E{Key: "orders.$[order].order_list.$[l" + strconv.Itoa(i) + "].returned", Value: sign * line.Quantity})
+	}
+	return bson.D{{Key: "$inc", Value: inc}}
+}
+
+func returnedFilters(orderId primitive.ObjectID, lines []models.ReturnLine) *options.UpdateOptions {
+	filters := []interface{}{bson.D{{Key: "order._id", Value: orderId}}}
+	for i, line := range lines {
+		filters = append(filters, bson.D{{Key: "l" + strconv.Itoa(i) + ".variant_id", Value: line.Variant_ID}})
+	}
+	return options.Update().SetArrayFilters(options.ArrayFilters{Filters: filters})
+}
+
+// ListReturns gives the returns which match the filter, the newest first
+func ListReturns(ctx context.Context, returnCollection *mongo.Collection, filter bson.D) ([]models.Return, error) {
+	returns := make([]models.Return, 0)
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := returnCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return returns, ErrCantFindReturn
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &returns); err != nil {
+		log.Println(err)
+		return returns, ErrCantFindReturn
+	}
+
+	return returns, nil
+}
+
+// UpdateReturnStatus moves a return one step on :-
+// rejected gives the pieces back to the order, received puts the stock back on the shelf and refunded pays the customer back
+// (through the payment gateway for a digital order). A zero amount refunds the whole value of the returned lines.
+func UpdateReturnStatus(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, returnCollection *mongo.Collection, provider payment.Provider, returnId primitive.ObjectID, status string, note string, amount models.Money) (models.Return, error) {
+
+	var rma models.Return
+	if err := returnCollection.FindOne(ctx, bson.D{{Key: "_id", Value: returnId}}).Decode(&rma); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Println(err)
+		}
+		return models.Return{}, ErrCantFindReturn
+	}
+
+	if !canMoveReturn(rma.Status, status) {
+		return models.Return{}, ErrReturnStatus
+	}
+
+	userId, err := primitive.ObjectIDFromHex(rma.User_ID)
+	if err != nil {
+		log.Println(err)
+		return models.Return{}, ErrUserIdIsNotValid
+	}
+
+	set := bson.D{{Key: "status", Value: status}, {Key: "updated_at", Value: time.Now()}}
+	if note != "" {
+		set = append(set, bson.E{Key: "admin_note", Value: note})
+		rma.Admin_Note = note
+	}
+
+	if status == models.ReturnRefunded {
+		if amount.IsZero() {
+			amount = rma.Refund_Amount
+		}
+		if amount.IsNegative() || amount.Currency != rma.Refund_Amount.Currency {
+			return models.Return{}, payment.ErrInvalidAmount
+		}
+		if amount.Cmp(rma.Refund_Amount) > 0 {
+			return models.Return{}, ErrRefundTooLarge
+		}
+		set = append(set, bson.E{Key: "refunded", Value: amount})
+		rma.Refunded = amount
+	}
+
+	// Only the request which still sees the old status moves the return, so the side effects below run once
+	filter := bson.D{{Key: "_id", Value: returnId}, {Key: "status", Value: rma.Status}}
+	result, err := returnCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: set}})
+	if err != nil {
+		log.Println(err)
+		return models.Return{}, ErrCantSaveReturn
+	}
+	if result.MatchedCount == 0 {
+		return models.Return{}, ErrReturnStatus
+	}
+
+	previous := rma.Status
+	rma.Status = status
+
+	switch status {
+	case models.ReturnRejected:
+		releaseReturn(ctx, userCollection, userId, rma.Order_ID, rma.Lines)
+
+	case models.ReturnReceived:
+		for _, line := range rma.Lines {
+			ReleaseVariantStock(ctx, prodCollection, models.ProductUser{Product_ID: line.Product_ID, Variant_ID: line.Variant_ID, Quantity: line.Quantity})
+		}
+
+	case models.ReturnRefunded:
+		if err = RefundOrder(ctx, prodCollection, userCollection, couponCollection, provider, userId, rma.Order_ID, amount); err != nil {
+			// The money did not move, the return waits in its old status for another try
+			revert := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: previous}, {Key: "refunded", Value: models.NewMoney(0, amount.Currency)}}}}
+			if _, revertErr := returnCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: returnId}}, revert); revertErr != nil {
+				log.Println("Error while reverting the return ", revertErr)
+			}
+			return models.Return{}, err
+		}
+	}
+
+	return rma, nil
+}
+
+func canMoveReturn(current string, next string) bool {
+	for _, step := range returnSteps[current] {
+		if step == next {
+			return true
+		}
+	}
+	return false
+}
+
+// RefundOrder pays back part of an order ; a digital order is refunded through the gateway,
+// a cash on delivery order is paid back by the store and the refund is only written on the order
+func RefundOrder(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, couponCollection *mongo.Collection, provider payment.Provider, userId primitive.ObjectID, orderId primitive.ObjectID, amount models.Money) error {
+
+	_, order, err := findOrder(ctx, userCollection, bson.D{{Key: "_id", Value: userId}, {Key: "orders._id", Value: orderId}})
+	if err != nil {
+		return err
+	}
+
+	if amount.IsZero() {
+		return nil
+	}
+	// A cod order which was only placed was never paid, there is no money to give back
+	if !refundableOrder(order) {
+		return ErrOrderNotReturnable
+	}
+	if order.Price.Sub(order.Refunded).Cmp(amount) < 0 {
+		return ErrRefundTooLarge
+	}
+
+	if order.Payment_Method.Intent_ID != "" {
+		_, err = RefundPayment(ctx, prodCollection, userCollection, couponCollection, provider, order, amount)
+		return err
+	}
+
+	refunded := order.Refunded.Add(amount)
+	status := models.OrderPartiallyRefunded
+	if refunded.Cmp(order.Price) >= 0 {
+		status = models.OrderRefunded
+	}
+
+	// Orders placed before refunds existed have no refunded field yet
+	current := bson.E{Key: "refunded", Value: order.Refunded}
+	if order.Refunded.Currency == "" {
+		current = bson.E{Key: "refunded", Value: bson.D{{Key: "$exists", Value: false}}}
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: userId},
+		{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{{Key: "_id", Value: orderId}, current}}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "orders.$.refunded", Value: refunded},
+		{Key: "orders.$.status", Value: status},
+	}}}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantRecordRefund
+	}
+	if result.MatchedCount == 0 {
+		return ErrCantRecordRefund
+	}
+
+	return nil
+}
+
+// refundableOrder tells if the customer paid for the order, only then it can be returned and refunded.
+// A placed cod order is paid at the door and a pending digital order was not paid yet.
+func refundableOrder(order models.Order) bool {
+	switch order.Status {
+	case models.OrderPaid, models.OrderShipped, models.OrderPartiallyRefunded:
+		return true
+	}
+	return false
+}
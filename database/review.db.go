@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNotPurchased        = errors.New("only customers who ordered this product can review it")
+	ErrAlreadyReviewed     = errors.New("you have already reviewed this product")
+	ErrCantAddReview       = errors.New("cannot add the review")
+	ErrCantFindReview      = errors.New("can't find the review")
+	ErrInvalidReviewStatus = errors.New("review status must be approved or rejected")
+	ErrCantUpdateRating    = errors.New("cannot update the product rating")
+)
+
+func AddReview(ctx context.Context, userCollection *mongo.Collection, reviewCollection *mongo.Collection, review models.Review) (models.Review, error) {
+
+	// The user must have this product in one of their orders, matching on the nested order_list array finds it in any order
+	var customer models.User
+	filter := bson.D{{Key: "_id", Value: review.User_ID}, {Key: "orders.order_list._id", Value: review.Product_ID}}
+	err := userCollection.FindOne(ctx, filter).Decode(&customer)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return review, ErrNotPurchased
+	}
+	if err != nil {
+		log.Println(err)
+		return review, ErrCantAddReview
+	}
+
+	review.Review_ID = primitive.NewObjectID()
+	review.User_Name = customer.First_Name
+	review.Status = models.ReviewPending
+	review.Created_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	review.Updated_At = review.Created_At
+
+	// The unique index on (product_id, user_id) refuses a second review, also when two requests send it at the same moment
+	_, err = reviewCollection.InsertOne(ctx, review)
+	if mongo.IsDuplicateKeyError(err) {
+		return review, ErrAlreadyReviewed
+	}
+	if err != nil {
+		log.Println(err)
+		return review, ErrCantAddReview
+	}
+
+	return review, nil
+}
+
+// ModerateReview approves or rejects a review and keeps the product rating in step with it.
+// Only the change is applied to the product (+stars when a review gets approved, -stars when an approved one gets rejected) so we never re-read all the reviews.
+// The status and the rating are saved in one transaction :- when the rating can't be saved the status goes back too, so moderating again fixes it.
+func ModerateReview(ctx context.Context, reviewCollection *mongo.Collection, prodCollection *mongo.Collection, reviewId primitive.ObjectID, status string) (models.Review, error) {
+
+	var previous models.Review
+
+	if status != models.ReviewApproved && status != models.ReviewRejected {
+		return previous, ErrInvalidReviewStatus
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	err := withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+
+		// ReturnDocument Before gives us the old status so we know what the rating change has to be
+		filter := bson.D{{Key: "_id", Value: reviewId}}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: status}, {Key: "updated_at", Value: updated_at}}}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+		err := reviewCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&previous)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCantFindReview
+		}
+		if err != nil {
+			log.Println(err)
+			return nil, ErrCantFindReview
+		}
+
+		switch {
+		case previous.Status != models.ReviewApproved && status == models.ReviewApproved:
+			err = applyRatingChange(ctx, prodCollection, previous.Product_ID, int64(previous.Rating), 1)
+		case previous.Status == models.ReviewApproved && status == models.ReviewRejected:
+			err = applyRatingChange(ctx, prodCollection, previous.Product_ID, -int64(previous.Rating), -1)
+		default:
+			return nil, nil // The rating does not change
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return eventList(productEvent(previous.Product_ID, models.ProductRatingChanged, ""))
+	})
+	if err != nil {
+		return models.Review{}, err
+	}
+
+	moderated := previous
+	moderated.Status = status
+	moderated.Updated_At = updated_at
+
+	return moderated, nil
+}
+
+// applyRatingChange uses an update pipeline, the second $set can read the new total and count written by the first one and recompute the average in the same atomic update.
+func applyRatingChange(ctx context.Context, prodCollection *mongo.Collection, productId primitive.ObjectID, stars int64, count int64) error {
+
+	filter := bson.D{{Key: "_id", Value: productId}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "rating_total", Value: bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$rating_total", 0}}}, stars}}}},
+			{Key: "rating_count", Value: bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$rating_count", 0}}}, count}}}},
+		}}},
+		{{Key: "$set", Value: bson.D{
+			{Key: "rating", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$gt", Value: bson.A{"$rating_count", 0}}},
+				bson.D{{Key: "$round", Value: bson.A{bson.D{{Key: "$divide", Value: bson.A{"$rating_total", "$rating_count"}}}, 2}}},
+				0,
+			}}}},
+		}}},
+	}
+
+	_, err := prodCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantUpdateRating
+	}
+
+	return nil
+}
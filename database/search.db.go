@@ -0,0 +1,257 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrCantSearchProducts = errors.New("was unable to search the products")
+
+// ProductSearch holds the filters coming from the search query string like ?brand=X&colour=red&min_price=100&max_price=500
+// Multiple values of the same facet are OR'ed (colour=red,blue) and different facets are AND'ed.
+type ProductSearch struct {
+	Name       string
+	Brands     []string
+	Categories []string
+	MinPrice   *models.Money
+	MaxPrice   *models.Money
+	Attributes map[string][]string // Variant attributes e.g. {"colour": ["red"], "size": ["M", "L"]}
+	Page       int64               // 1 is the first page
+	Limit      int64               // Products per page, DefaultSearchLimit when 0
+}
+
+type FacetValue struct {
+	Value string `json:"value" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+type AttributeFacetValue struct {
+	Attribute string `json:"attribute" bson:"attribute"`
+	Value     string `json:"value" bson:"value"`
+	Count     int64  `json:"count" bson:"count"`
+}
+
+type PriceRange struct {
+	Min models.Money `json:"min" bson:"min"`
+	Max models.Money `json:"max" bson:"max"`
+}
+
+type SearchFacets struct {
+	Brands     []FacetValue          `json:"brands" bson:"brands"`
+	Categories []FacetValue          `json:"categories" bson:"categories"`
+	Attributes []AttributeFacetValue `json:"attributes" bson:"attributes"`
+	Price      []PriceRange          `json:"price" bson:"price"`
+}
+
+type SearchResult struct {
+	Products []models.Product `json:"products" bson:"products"`
+	Total    int64            `json:"total" bson:"total"` // Matching products on all the pages
+	Page     int64            `json:"page" bson:"-"`
+	Limit    int64            `json:"limit" bson:"-"`
+	Facets   SearchFacets     `json:"facets" bson:"facets"`
+}
+
+// Attribute names become a part of the field path (variants.attributes.<name>) so only plain names are allowed, never "$" or "."
+var attributeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func IsValidAttributeName(name string) bool {
+	return attributeNamePattern.MatchString(name)
+}
+
+// The page size of the search when none or a wrong one is asked, and the biggest page allowed
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// SearchProducts runs one aggregation which returns one page of the matching products, their total and the per facet value counts together.
+// The $facet stage runs several sub-pipelines over the same documents. Every facet is counted without its own filter
+// (with brand=Apple the brands facet still shows Samsung and how many it would add), the products use every filter.
+func SearchProducts(ctx context.Context, prodCollection *mongo.Collection, search ProductSearch) (SearchResult, error) {
+
+	var result SearchResult
+
+	if search.Limit <= 0 || search.Limit > MaxSearchLimit {
+		search.Limit = DefaultSearchLimit
+	}
+	if search.Page <= 0 {
+		search.Page = 1
+	}
+
+	// Only the name is common to every sub-pipeline, the other filters are left out by one facet or another
+	match_stage := bson.D{{Key: "$match", Value: buildSearchFilter(ProductSearch{Name: search.Name})}}
+
+	withoutBrands, withoutCategories, withoutPrice := search, search, search
+	withoutBrands.Brands = nil
+	withoutCategories.Categories = nil
+	withoutPrice.MinPrice, withoutPrice.MaxPrice = nil, nil
+
+	// Product level facets, one count per product
+	brand_facet := bson.A{
+		bson.D{{Key: "$match", Value: buildSearchFilter(withoutBrands)}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "brand", Value: bson.D{{Key: "$nin", Value: bson.A{nil, ""}}}}}}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$brand"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	category_facet := bson.A{
+		bson.D{{Key: "$match", Value: buildSearchFilter(withoutCategories)}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "category", Value: bson.D{{Key: "$nin", Value: bson.A{nil, ""}}}}}}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$category"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	// $min / $max on the {amount, currency} documents compares the amount first, all catalog prices are in the store currency
+	price_facet := bson.A{
+		bson.D{{Key: "$match", Value: buildSearchFilter(withoutPrice)}},
+		bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$variants"}}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "min", Value: bson.D{{Key: "$min", Value: "$variants.price"}}},
+			{Key: "max", Value: bson.D{{Key: "$max", Value: "$variants.price"}}},
+		}}},
+	}
+
+	// The attributes which are not filtered are counted with every filter, each filtered one with every filter but its own
+	filtered := make([]string, 0, len(search.Attributes))
+	for name := range search.Attributes {
+		filtered = append(filtered, name)
+	}
+	sort.Strings(filtered)
+
+	facets := bson.D{
+		{Key: "products", Value: bson.A{
+			bson.D{{Key: "$match", Value: buildSearchFilter(search)}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: -1}}}},
+			bson.D{{Key: "$skip", Value: (search.Page - 1) * search.Limit}},
+			bson.D{{Key: "$limit", Value: search.Limit}},
+		}},
+		{Key: "total", Value: bson.A{
+			bson.D{{Key: "$match", Value: buildSearchFilter(search)}},
+			bson.D{{Key: "$count", Value: "count"}},
+		}},
+		{Key: "brands", Value: brand_facet},
+		{Key: "categories", Value: category_facet},
+		{Key: "attributes", Value: attributeFacet(search, bson.D{{Key: "$nin", Value: filtered}})},
+		{Key: "price", Value: price_facet},
+	}
+
+	attributeLists := bson.A{"$attributes"}
+	for i, name := range filtered {
+		withoutAttribute := search
+		withoutAttribute.Attributes = make(map[string][]string, len(search.Attributes))
+		for other, values := range search.Attributes {
+			if other != name {
+				withoutAttribute.Attributes[other] = values
+			}
+		}
+
+		key := "attributes_" + strconv.Itoa(i)
+		facets = append(facets, bson.E{Key: key, Value: attributeFacet(withoutAttribute, name)})
+		attributeLists = append(attributeLists, "$"+key)
+	}
+
+	facet_stage := bson.D{{Key: "$facet", Value: facets}}
+
+	// $facet outputs a single document, the facets are moved under one key so it decodes straight into SearchResult
+	project_stage := bson.D{{Key: "$project", Value: bson.D{
+		{Key: "products", Value: 1},
+		{Key: "total", Value: bson.D{{Key: "$ifNull", Value: bson.A{bson.D{{Key: "$first", Value: "$total.count"}}, 0}}}},
+		{Key: "facets", Value: bson.D{
+			{Key: "brands", Value: "$brands"},
+			{Key: "categories", Value: "$categories"},
+			{Key: "attributes", Value: bson.D{{Key: "$concatArrays", Value: attributeLists}}},
+			{Key: "price", Value: "$price"},
+		}},
+	}}}
+
+	cursor, err := prodCollection.Aggregate(ctx, mongo.Pipeline{match_stage, facet_stage, project_stage})
+	if err != nil {
+		log.Println(err)
+		return result, ErrCantSearchProducts
+	}
+	defer cursor.Close(ctx)
+
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			log.Println("Error while doing aggregation in SearchProducts function ", err)
+			return result, ErrCantSearchProducts
+		}
+	}
+
+	if err = cursor.Err(); err != nil {
+		log.Println(err)
+		return result, ErrCantSearchProducts
+	}
+
+	result.Page, result.Limit = search.Page, search.Limit
+	return result, nil
+}
+
+// attributeFacet counts the products per value of the variant attributes whose name matches attribute (a name or a query like {$nin: [...]}).
+// Variant attributes are a map, $objectToArray turns {"colour": "red"} into [{k: "colour", v: "red"}] so that we can unwind and group on them.
+// The first $group removes duplicates so a product with three red variants is counted once for colour=red.
+func attributeFacet(search ProductSearch, attribute any) bson.A {
+	return bson.A{
+		bson.D{{Key: "$match", Value: buildSearchFilter(search)}},
+		bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$variants"}}}},
+		bson.D{{Key: "$project", Value: bson.D{{Key: "attribute", Value: bson.D{{Key: "$objectToArray", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$variants.attributes", bson.D{}}}}}}}}}},
+		bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$attribute"}}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "attribute.k", Value: attribute}}}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "product", Value: "$_id"}, {Key: "attribute", Value: "$attribute.k"}, {Key: "value", Value: "$attribute.v"}}}}}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "attribute", Value: "$_id.attribute"}, {Key: "value", Value: "$_id.value"}}}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "attribute", Value: "$_id.attribute"}, {Key: "value", Value: "$_id.value"}, {Key: "count", Value: 1}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "attribute", Value: 1}, {Key: "count", Value: -1}, {Key: "value", Value: 1}}}},
+	}
+}
+
+func buildSearchFilter(search ProductSearch) bson.D {
+	filter := bson.D{}
+
+	// The $regex operator is used to perform a regex search with the case-insensitive option, the caret ^ in the regex pattern ensures that the search starts with the given letters.
+	if search.Name != "" {
+		filter = append(filter, bson.E{Key: "product_name", Value: bson.D{
+			{Key: "$regex", Value: "^" + regexp.QuoteMeta(search.Name)},
+			{Key: "$options", Value: "i"},
+		}})
+	}
+
+	if len(search.Brands) > 0 {
+		filter = append(filter, bson.E{Key: "brand", Value: bson.D{{Key: "$in", Value: search.Brands}}})
+	}
+
+	if len(search.Categories) > 0 {
+		filter = append(filter, bson.E{Key: "category", Value: bson.D{{Key: "$in", Value: search.Categories}}})
+	}
+
+	// Price and attributes belongs to the variants, $elemMatch makes sure a single variant satisfies all of them (a red one which is also under 500)
+	variantFilter := bson.D{}
+	for name, values := range search.Attributes {
+		variantFilter = append(variantFilter, bson.E{Key: "attributes." + name, Value: bson.D{{Key: "$in", Value: values}}})
+	}
+
+	priceFilter := bson.D{}
+	if search.MinPrice != nil {
+		priceFilter = append(priceFilter, bson.E{Key: "$gte", Value: search.MinPrice.Amount})
+	}
+	if search.MaxPrice != nil {
+		priceFilter = append(priceFilter, bson.E{Key: "$lte", Value: search.MaxPrice.Amount})
+	}
+	if len(priceFilter) > 0 {
+		variantFilter = append(variantFilter, bson.E{Key: "price.amount", Value: priceFilter})
+	}
+
+	if len(variantFilter) > 0 {
+		filter = append(filter, bson.E{Key: "variants", Value: bson.D{{Key: "$elemMatch", Value: variantFilter}}})
+	}
+
+	return filter
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantCreateUser = errors.New("cannot create the user")
+	ErrCantFindUser   = errors.New("can't find the user")
+)
+
+// CreateUser saves a new account with its UserRegistered event ; the event only has the public details, never the password or the tokens
+func CreateUser(ctx context.Context, userCollection *mongo.Collection, user models.User) error {
+	return withEvents(ctx, func(ctx context.Context) ([]models.DomainEvent, error) {
+		if _, err := userCollection.InsertOne(ctx, user); err != nil {
+			log.Println(err)
+			return nil, ErrCantCreateUser
+		}
+
+		return eventList(func() (models.DomainEvent, error) {
+			return NewEvent(models.EventUserRegistered, user.ID.Hex(), map[string]any{
+				"user_id":    user.ID.Hex(),
+				"email":      user.Email,
+				"first_name": user.First_Name,
+				"last_name":  user.Last_Name,
+			})
+		})
+	})
+}
+
+// IsAdmin tells if the account has the admin role, it is read from the database on every request so taking the role away works at once
+func IsAdmin(ctx context.Context, userCollection *mongo.Collection, userQueryID string) (bool, error) {
+
+	userId, err := primitive.ObjectIDFromHex(userQueryID)
+	if err != nil {
+		return false, ErrUserIdIsNotValid
+	}
+
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.D{{Key: "role", Value: 1}})
+	err = userCollection.FindOne(ctx, bson.D{{Key: "_id", Value: userId}, {Key: "guest", Value: bson.D{{Key: "$ne", Value: true}}}}, opts).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		log.Println(err)
+		return false, ErrCantFindUser
+	}
+
+	return user.Role == models.RoleAdmin, nil
+}
+
+// SetUserRole gives the account with this email a role, the empty role makes it a customer again
+func SetUserRole(ctx context.Context, userCollection *mongo.Collection, email string, role string) error {
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "role", Value: role}}}}
+	if role == "" {
+		update = bson.D{{Key: "$unset", Value: bson.D{{Key: "role", Value: ""}}}}
+	}
+
+	result, err := userCollection.UpdateOne(ctx, bson.D{{Key: "email", Value: email}}, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantCreateUser
+	}
+	if result.MatchedCount == 0 {
+		return ErrCantFindUser
+	}
+
+	return nil
+}
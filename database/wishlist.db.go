@@ -0,0 +1,374 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"ecommerce/models"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindWishlist     = errors.New("can't find this wishlist")
+	ErrCantSaveWishlist     = errors.New("cannot save the wishlist")
+	ErrCantFindWishlistItem = errors.New("this variant is not in the wishlist")
+	ErrTooManyWishlists     = errors.New("the limit of wishlists is reached")
+)
+
+func CreateWishlist(ctx context.Context, wishlistCollection *mongo.Collection, userQueryID string, name string, maxWishlists int) (models.Wishlist, error) {
+
+	count, err := wishlistCollection.CountDocuments(ctx, bson.D{{Key: "user_id", Value: userQueryID}})
+	if err != nil {
+		log.Println(err)
+		return models.Wishlist{}, ErrCantSaveWishlist
+	}
+	if count >= int64(maxWishlists) {
+		return models.Wishlist{}, ErrTooManyWishlists
+	}
+
+	wishlist := models.Wishlist{
+		Wishlist_ID: primitive.NewObjectID(),
+		User_ID:     userQueryID,
+		Name:        name,
+		Items:       make([]models.WishlistItem, 0),
+	}
+	wishlist.Created_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	wishlist.Updated_At = wishlist.Created_At
+
+	if _, err = wishlistCollection.InsertOne(ctx, wishlist); err != nil {
+		log.Println(err)
+		return models.Wishlist{}, ErrCantSaveWishlist
+	}
+
+	return wishlist, nil
+}
+
+func ListWishlists(ctx context.Context, wishlistCollection *mongo.Collection, userQueryID string) ([]models.Wishlist, error) {
+
+	wishlists := make([]models.Wishlist, 0)
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := wishlistCollection.Find(ctx, bson.D{{Key: "user_id", Value: userQueryID}}, opts)
+	if err != nil {
+		log.Println(err)
+		return wishlists, ErrCantFindWishlist
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &wishlists); err != nil {
+		log.Println(err)
+		return wishlists, ErrCantFindWishlist
+	}
+
+	return wishlists, nil
+}
+
+// FindWishlist only finds the wishlist in the lists of this user
+func FindWishlist(ctx context.Context, wishlistCollection *mongo.Collection, userQueryID string, wishlistId primitive.ObjectID) (models.Wishlist, error) {
+
+	var wishlist models.Wishlist
+	err := wishlistCollection.FindOne(ctx, wishlistFilter(userQueryID, wishlistId)).Decode(&wishlist)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Wishlist{}, ErrCantFindWishlist
+	}
+	if err != nil {
+		log.Println(err)
+		return models.Wishlist{}, ErrCantFindWishlist
+	}
+
+	return wishlist, nil
+}
+
+func RenameWishlist(ctx context.Context, wishlistCollection *mongo.Collection, userQueryID string, wishlistId primitive.ObjectID, name string) (models.Wishlist, error) {
+	return updateWishlist(ctx, wishlistCollection, userQueryID, wishlistId, bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: name}}}})
+}
+
+func DeleteWishlist(ctx context.Context, wishlistCollection *mongo.Collection, userQueryID string, wishlistId primitive.ObjectID) error {
+
+	result, err := wishlistCollection.DeleteOne(ctx, wishlistFilter(userQueryID, wishlistId))
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveWishlist
+	}
+	if result.DeletedCount == 0 {
+		return ErrCantFindWishlist
+	}
+
+	return nil
+}
+
+// AddWishlistItem puts a variant in the wishlist with its price and stock of this moment, a variant which is already there is left alone
+func AddWishlistItem(ctx context.Context, prodCollection *mongo.Collection, wishlistCollection *mongo.Collection, userQueryID string, wishlistId primitive.ObjectID, productId primitive.ObjectID, variantId primitive.ObjectID) (models.Wishlist, error) {
+
+	var product models.Product
+	if err := prodCollection.FindOne(ctx, bson.D{{Key: "_id", Value: productId}}).Decode(&product); err != nil {
+		log.Println(err)
+		return models.Wishlist{}, ErrCantFindProduct
+	}
+
+	variant, err := FindVariant(product, variantId)
+	if err != nil {
+		return models.Wishlist{}, err
+	}
+
+	item := models.WishlistItem{
+		Product_ID:      product.Product_ID,
+		Variant_ID:      variant.Variant_ID,
+		SKU:             variant.SKU,
+		Product_Name:    product.Product_Name,
+		Attributes:      variant.Attributes,
+		Image:           variant.Image,
+		Price:           variant.Price,
+		Price_Overrides: variant.Price_Overrides,
+		In_Stock:        variant.Stock != nil && *variant.Stock > 0,
+	}
+	item.Added_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	// The $ne filter pushes the variant only once, even when two requests add it at the same time
+	filter := append(wishlistFilter(userQueryID, wishlistId), bson.E{Key: "items.variant_id", Value: bson.D{{Key: "$ne", Value: variantId}}})
+	update := bson.D{{Key: "$push", Value: bson.D{{Key: "items", Value: item}}}}
+
+	if _, err = wishlistCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return models.Wishlist{}, ErrCantSaveWishlist
+	}
+
+	return FindWishlist(ctx, wishlistCollection, userQueryID, wishlistId)
+}
+
+func RemoveWishlistItem(ctx context.Context, wishlistCollection *mongo.Collection, userQueryID string, wishlistId primitive.ObjectID, variantId primitive.ObjectID) (models.Wishlist, error) {
+
+	filter := append(wishlistFilter(userQueryID, wishlistId), bson.E{Key: "items.variant_id", Value: variantId})
+	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "items", Value: bson.D{{Key: "variant_id", Value: variantId}}}}}}
+
+	result, err := wishlistCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return models.Wishlist{}, ErrCantSaveWishlist
+	}
+	if result.MatchedCount == 0 {
+		return models.Wishlist{}, wishlistOrItemMissing(ctx, wishlistCollection, userQueryID, wishlistId)
+	}
+
+	return FindWishlist(ctx, wishlistCollection, userQueryID, wishlistId)
+}
+
+// MoveWishlistItemToCart adds the variant to the cart like AddProductToCart and then takes it out of the wishlist.
+// When the cart refuses it (no stock, the variant is gone) the wishlist stays as it was.
+func MoveWishlistItemToCart(ctx context.Context, prodCollection *mongo.Collection, userCollection *mongo.Collection, wishlistCollection *mongo.Collection, userQueryID string, wishlistId primitive.ObjectID, variantId primitive.ObjectID, quantity int) (models.Wishlist, error) {
+
+	wishlist, err := FindWishlist(ctx, wishlistCollection, userQueryID, wishlistId)
+	if err != nil {
+		return models.Wishlist{}, err
+	}
+
+	var item *models.WishlistItem
+	for i := range wishlist.Items {
+		if wishlist.Items[i].Variant_ID == variantId {
+			item = &wishlist.Items[i]
+			break
+		}
+	}
+	if item == nil {
+		return models.Wishlist{}, ErrCantFindWishlistItem
+	}
+
+	if err = AddProductToCart(ctx, prodCollection, userCollection, item.Product_ID, item.Variant_ID, quantity, userQueryID); err != nil {
+		return models.Wishlist{}, err
+	}
+
+	return RemoveWishlistItem(ctx, wishlistCollection, userQueryID, wishlistId, variantId)
+}
+
+// ShareWishlist gives the wishlist a share token, a wishlist which is already shared keeps its link
+func ShareWishlist(ctx context.Context, wishlistCollection *mongo.Collection, userQueryID string, wishlistId primitive.ObjectID) (models.Wishlist, error) {
+
+	token, err := newShareToken()
+	if err != nil {
+		log.Println(err)
+		return models.Wishlist{}, ErrCantSaveWishlist
+	}
+
+	filter := append(wishlistFilter(userQueryID, wishlistId), bson.E{Key: "share_token", Value: bson.D{{Key: "$exists", Value: false}}})
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "share_token", Value: token}}}}
+
+	if _, err = wishlistCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return models.Wishlist{}, ErrCantSaveWishlist
+	}
+
+	return FindWishlist(ctx, wishlistCollection, userQueryID, wishlistId)
+}
+
+// UnshareWishlist removes the share token, the old link stops working
+func UnshareWishlist(ctx context.Context, wishlistCollection *mongo.Collection, userQueryID string, wishlistId primitive.ObjectID) (models.Wishlist, error) {
+	return updateWishlist(ctx, wishlistCollection, userQueryID, wishlistId, bson.D{{Key: "$unset", Value: bson.D{{Key: "share_token", Value: ""}}}})
+}
+
+// FindSharedWishlist is the read only view of a shared wishlist, anybody with the token can see it
+func FindSharedWishlist(ctx context.Context, wishlistCollection *mongo.Collection, token string) (models.Wishlist, error) {
+
+	var wishlist models.Wishlist
+	err := wishlistCollection.FindOne(ctx, bson.D{{Key: "share_token", Value: token}}).Decode(&wishlist)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Println(err)
+		}
+		return models.Wishlist{}, ErrCantFindWishlist
+	}
+
+	return wishlist, nil
+}
+
+// WishlistAlerts compares the wishlisted variants of these products (every product when productIds is nil) with the catalog.
+// A lower price gives a price drop alert and stock after none gives a back in stock alert. The new price and stock are saved on the item,
+// so the user hears about every change once ; a price going up is saved too, so coming back down is a new drop.
+func WishlistAlerts(ctx context.Context, prodCollection *mongo.Collection, wishlistCollection *mongo.Collection, productIds []primitive.ObjectID) ([]models.WishlistAlert, error) {
+
+	alerts := make([]models.WishlistAlert, 0)
+
+	filter := bson.D{{Key: "items.0", Value: bson.D{{Key: "$exists", Value: true}}}}
+	if productIds != nil {
+		filter = bson.D{{Key: "items.product_id", Value: bson.D{{Key: "$in", Value: productIds}}}}
+	}
+
+	cursor, err := wishlistCollection.Find(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return alerts, ErrCantFindWishlist
+	}
+	defer cursor.Close(ctx)
+
+	var wishlists []models.Wishlist
+	if err = cursor.All(ctx, &wishlists); err != nil {
+		log.Println(err)
+		return alerts, ErrCantFindWishlist
+	}
+
+	catalog, err := wishlistCatalog(ctx, prodCollection, wishlists)
+	if err != nil {
+		return alerts, err
+	}
+
+	for _, wishlist := range wishlists {
+		for _, item := range wishlist.Items {
+			product, found := catalog[item.Product_ID]
+			if !found {
+				continue
+			}
+			variant, err := FindVariant(product, item.Variant_ID)
+			if err != nil {
+				continue
+			}
+
+			current := item
+			current.Price = variant.Price
+			current.Price_Overrides = variant.Price_Overrides
+			current.In_Stock = variant.Stock != nil && *variant.Stock > 0
+
+			if current.Price == item.Price && current.In_Stock == item.In_Stock {
+				continue
+			}
+
+			alert := models.WishlistAlert{User_ID: wishlist.User_ID, Wishlist_ID: wishlist.Wishlist_ID, Wishlist_Name: wishlist.Name, Item: current, Old_Price: item.Price}
+			if current.In_Stock && !item.In_Stock {
+				alert.Event = models.WishlistBackInStock
+				alerts = append(alerts, alert)
+			} else if current.In_Stock && current.Price.Currency == item.Price.Currency && current.Price.Cmp(item.Price) < 0 {
+				alert.Event = models.WishlistPriceDrop
+				alerts = append(alerts, alert)
+			}
+
+			// arrayFilters points the update at the item of this variant
+			update := bson.D{{Key: "$set", Value: bson.D{
+				{Key: "items.$[item].price", Value: current.Price},
+				{Key: "items.$[item].price_overrides", Value: current.Price_Overrides},
+				{Key: "items.$[item].in_stock", Value: current.In_Stock},
+			}}}
+			opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.D{{Key: "item.variant_id", Value: item.Variant_ID}}}})
+
+			if _, err := wishlistCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: wishlist.Wishlist_ID}}, update, opts); err != nil {
+				log.Println("Error while saving the price of the wishlist item ", err)
+			}
+		}
+	}
+
+	return alerts, nil
+}
+
+// wishlistCatalog reads the products of all the wishlisted variants in one query
+func wishlistCatalog(ctx context.Context, prodCollection *mongo.Collection, wishlists []models.Wishlist) (map[primitive.ObjectID]models.Product, error) {
+
+	productIds := make([]primitive.ObjectID, 0)
+	for _, wishlist := range wishlists {
+		for _, item := range wishlist.Items {
+			productIds = append(productIds, item.Product_ID)
+		}
+	}
+
+	catalog := make(map[primitive.ObjectID]models.Product)
+	if len(productIds) == 0 {
+		return catalog, nil
+	}
+
+	cursor, err := prodCollection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: productIds}}}})
+	if err != nil {
+		log.Println(err)
+		return catalog, ErrCantDecodeProducts
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err = cursor.All(ctx, &products); err != nil {
+		log.Println(err)
+		return catalog, ErrCantDecodeProducts
+	}
+
+	for _, product := range products {
+		catalog[product.Product_ID] = product
+	}
+
+	return catalog, nil
+}
+
+func updateWishlist(ctx context.Context, wishlistCollection *mongo.Collection, userQueryID string, wishlistId primitive.ObjectID, update bson.D) (models.Wishlist, error) {
+
+	result, err := wishlistCollection.UpdateOne(ctx, wishlistFilter(userQueryID, wishlistId), update)
+	if err != nil {
+		log.Println(err)
+		return models.Wishlist{}, ErrCantSaveWishlist
+	}
+	if result.MatchedCount == 0 {
+		return models.Wishlist{}, ErrCantFindWishlist
+	}
+
+	return FindWishlist(ctx, wishlistCollection, userQueryID, wishlistId)
+}
+
+// wishlistOrItemMissing tells which one was not found when an item update matched nothing
+func wishlistOrItemMissing(ctx context.Context, wishlistCollection *mongo.Collection, userQueryID string, wishlistId primitive.ObjectID) error {
+	if _, err := FindWishlist(ctx, wishlistCollection, userQueryID, wishlistId); err != nil {
+		return err
+	}
+	return ErrCantFindWishlistItem
+}
+
+func wishlistFilter(userQueryID string, wishlistId primitive.ObjectID) bson.D {
+	return bson.D{{Key: "_id", Value: wishlistId}, {Key: "user_id", Value: userQueryID}}
+}
+
+// newShareToken is 16 random bytes, long enough that a share link can't be guessed
+func newShareToken() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// AllEvents subscribes a handler to every type of event
+const AllEvents = "*"
+
+// Handler reacts to one event inside the service, an error makes the dispatcher publish the event to the bus again later
+type Handler func(ctx context.Context, event models.DomainEvent) error
+
+// Bus is the sink of the subscribers inside the service. It is one sink for the dispatcher, so when one handler fails
+// every handler of the event runs again on the retry ; the handlers must be safe to run twice.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler // event type (or AllEvents) -> its handlers in the order they subscribed
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe adds a handler for the events of this type, AllEvents gets every event
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *Bus) Name() string { return "bus" }
+
+// Publish runs every handler of the event one after the other, a failed handler does not stop the next ones
+func (b *Bus) Publish(ctx context.Context, event models.DomainEvent) error {
+	b.mu.RLock()
+	handlers := append(append([]Handler{}, b.handlers[event.Type]...), b.handlers[AllEvents]...)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := runHandler(ctx, handler, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runHandler turns a panic of a handler into an error, one broken subscriber must not stop the dispatcher
+func runHandler(ctx context.Context, handler Handler, event models.DomainEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler of %s panicked :- %v", event.Type, r)
+		}
+	}()
+	return handler(ctx, event)
+}
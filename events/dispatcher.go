@@ -0,0 +1,116 @@
+package events
+
+import (
+	"context"
+	"ecommerce/database"
+	"ecommerce/models"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// How long a dispatcher holds an event, after that another dispatcher may take it over
+	eventLease = time.Minute
+	// How long one sink may take for one event
+	publishTimeout = 10 * time.Second
+	// The wait before the first retry, it doubles with every attempt up to maxBackoff
+	baseBackoff = 10 * time.Second
+	maxBackoff  = 30 * time.Minute
+)
+
+// Dispatcher publishes the events of the outbox to the sinks. The events go out in the order they happened ;
+// an event which a sink refused waits for its retry while the later events go on, and a retry only goes to the sinks
+// which did not get the event yet. Several instances of the service can dispatch at once, each event is claimed by one.
+type Dispatcher struct {
+	outbox      *mongo.Collection
+	sinks       []Sink
+	maxAttempts int
+}
+
+func NewDispatcher(outboxCollection *mongo.Collection, sinks []Sink, maxAttempts int) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	return &Dispatcher{outbox: outboxCollection, sinks: sinks, maxAttempts: maxAttempts}
+}
+
+// Dispatch publishes the due events one at a time until none is left or the context is done, it returns how many it handled.
+// Without any sink nothing is published, the events wait in the outbox until a sink is set up.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	count := 0
+	if len(d.sinks) == 0 {
+		return count, nil
+	}
+
+	for ctx.Err() == nil {
+		event, ok, err := database.ClaimEvent(ctx, d.outbox, eventLease)
+		if err != nil {
+			return count, err
+		}
+		if !ok {
+			return count, nil
+		}
+
+		d.publish(ctx, event)
+		count++
+	}
+
+	return count, ctx.Err()
+}
+
+// publish sends the event to every sink which did not get it yet and writes down the result
+func (d *Dispatcher) publish(ctx context.Context, event models.DomainEvent) {
+	published := make([]string, 0, len(d.sinks))
+	var errs []error
+
+	for _, sink := range d.sinks {
+		if slices.Contains(event.Published_To, sink.Name()) {
+			continue
+		}
+
+		sinkCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+		err := sink.Publish(sinkCtx, event)
+		cancel()
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s :- %w", sink.Name(), err))
+			continue
+		}
+		published = append(published, sink.Name())
+	}
+
+	publishErr := errors.Join(errs...)
+
+	var retryAt *time.Time
+	if publishErr != nil {
+		if event.Attempts < d.maxAttempts {
+			next := time.Now().Add(backoff(event.Attempts))
+			retryAt = &next
+			log.Println("Event "+event.Event_ID.Hex()+" ("+event.Type+") is sent again later :- ", publishErr)
+		} else {
+			log.Println("Event "+event.Event_ID.Hex()+" ("+event.Type+") failed every attempt :- ", publishErr)
+		}
+	}
+
+	// The result is written even when the service is stopping, otherwise the sinks which got the event would get it again
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if err := database.RecordEventAttempt(recordCtx, d.outbox, event, published, publishErr, retryAt); err != nil {
+		log.Println("Error while recording the event attempt ", err)
+	}
+}
+
+// backoff is the wait after the given attempt :- 10s, 20s, 40s ... up to maxBackoff
+func backoff(attempt int) time.Duration {
+	wait := baseBackoff
+	for i := 1; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
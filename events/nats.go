@@ -0,0 +1,103 @@
+package events
+
+import (
+	"context"
+	"ecommerce/models"
+	"strings"
+	"sync"
+)
+
+// Publisher is the part of a NATS connection the sink needs, the Publish of *nats.Conn has the same signature,
+// so a real connection plugs in without this package knowing the NATS client
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSSink publishes every event as json on the subject "<prefix>.<type>"
+type NATSSink struct {
+	conn   Publisher
+	prefix string
+}
+
+func NewNATSSink(conn Publisher, prefix string) *NATSSink {
+	if prefix == "" {
+		prefix = "ecommerce"
+	}
+	return &NATSSink{conn: conn, prefix: prefix}
+}
+
+func (n *NATSSink) Name() string { return "nats" }
+
+func (n *NATSSink) Publish(ctx context.Context, event models.DomainEvent) error {
+	data, err := event.Message()
+	if err != nil {
+		return err
+	}
+	return n.conn.Publish(n.prefix+"."+event.Type, data)
+}
+
+// MemoryNATS is an in memory stand in for a NATS server, for local runs and for code which subscribes inside the service.
+// It delivers every message straight away to the subscribers whose subject matches, with the wildcards of NATS :-
+// "*" matches one token ("ecommerce.*") and ">" the rest of the subject ("ecommerce.>").
+type MemoryNATS struct {
+	mu          sync.RWMutex
+	subscribers map[int]memorySubscriber
+	nextId      int
+}
+
+type memorySubscriber struct {
+	subject string
+	handler func(subject string, data []byte)
+}
+
+func NewMemoryNATS() *MemoryNATS {
+	return &MemoryNATS{subscribers: make(map[int]memorySubscriber)}
+}
+
+func (m *MemoryNATS) Publish(subject string, data []byte) error {
+	m.mu.RLock()
+	var handlers []func(subject string, data []byte)
+	for _, subscriber := range m.subscribers {
+		if subjectMatches(subscriber.subject, subject) {
+			handlers = append(handlers, subscriber.handler)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(subject, data)
+	}
+	return nil
+}
+
+// Subscribe gets the messages of the subjects which match, the returned func ends the subscription
+func (m *MemoryNATS) Subscribe(subject string, handler func(subject string, data []byte)) func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextId
+	m.nextId++
+	m.subscribers[id] = memorySubscriber{subject: subject, handler: handler}
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.subscribers, id)
+	}
+}
+
+// subjectMatches compares the subject token by token with the pattern of a subscription
+func subjectMatches(pattern string, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
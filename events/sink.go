@@ -0,0 +1,62 @@
+package events
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnknownSink  = errors.New("unknown event sink")
+	ErrNoWebhookURL = errors.New("the webhook sink needs EVENT_WEBHOOK_URL")
+)
+
+// Sink is one place the events of the outbox are published to :- the subscribers inside the service, a webhook, NATS ...
+// An event can reach a sink more than once (e.g. the service stopped before it wrote down the publish), so the receivers
+// must skip an event_id they already handled.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event models.DomainEvent) error
+}
+
+// SinkConfig has the settings of every sink, each sink only reads its own
+type SinkConfig struct {
+	Bus            *Bus
+	Webhook_URL    string
+	Webhook_Secret string // Signs the body in the X-Event-Signature header, empty sends it unsigned
+	NATS           Publisher
+	Subject_Prefix string // The subject of an event is "<prefix>.<type>", e.g. ecommerce.OrderPlaced
+}
+
+// NewSinks makes the sinks of a comma separated list like "bus,webhook,nats"
+func NewSinks(names string, config SinkConfig) ([]Sink, error) {
+	sinks := make([]Sink, 0)
+
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+			continue
+		case "bus":
+			if config.Bus == nil {
+				config.Bus = NewBus()
+			}
+			sinks = append(sinks, config.Bus)
+		case "webhook":
+			if config.Webhook_URL == "" {
+				return nil, ErrNoWebhookURL
+			}
+			sinks = append(sinks, NewWebhookSink(config.Webhook_URL, config.Webhook_Secret))
+		case "nats":
+			if config.NATS == nil {
+				config.NATS = NewMemoryNATS()
+			}
+			sinks = append(sinks, NewNATSSink(config.NATS, config.Subject_Prefix))
+		default:
+			return nil, fmt.Errorf("%w :- %s", ErrUnknownSink, name)
+		}
+	}
+
+	return sinks, nil
+}
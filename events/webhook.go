@@ -0,0 +1,58 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"ecommerce/models"
+	"ecommerce/payment"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookSink posts every event as json to one url. With a secret the body is signed like the webhooks of the payment
+// gateway :- X-Event-Signature is "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">", so the receiver can check it
+// came from us and is not an old request sent again.
+type WebhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookSink(url string, secret string) *WebhookSink {
+	return &WebhookSink{url: url, secret: secret, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *WebhookSink) Name() string { return "webhook" }
+
+// Publish succeeds only on a 2xx answer, anything else is sent again later
+func (w *WebhookSink) Publish(ctx context.Context, event models.DomainEvent) error {
+	body, err := event.Message()
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Event-ID", event.Event_ID.Hex())
+	request.Header.Set("X-Event-Type", event.Type)
+	if w.secret != "" {
+		request.Header.Set("X-Event-Signature", payment.Sign(w.secret, body, time.Now()))
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10)) // Read the answer so the connection can be used again
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("the webhook answered %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package exchange
+
+import (
+	"ecommerce/models"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("this currency is not supported")
+	ErrInvalidRates        = errors.New("exchange rates are invalid")
+)
+
+// Rates is the content of the rates file ; "1 base = rate currency", e.g. base INR and USD "0.012".
+// The rates are decimal strings and never float64, so "0.012" is exactly 0.012 when we convert money with it.
+type Rates struct {
+	Base       string            `json:"base"`
+	Rates      map[string]string `json:"rates"`
+	Updated_At time.Time         `json:"updated_at"`
+}
+
+// RateStore keeps the rates of the local rates file in the memory, the admin can replace them at runtime
+type RateStore struct {
+	mu     sync.RWMutex
+	saveMu sync.Mutex // One Save at a time, so the file and the memory always end with the rates of the same Save
+	path   string
+	rates  Rates
+	parsed map[string]*big.Rat
+}
+
+// NewRateStore starts with only the store currency, Load reads the rates file into it
+func NewRateStore(path string, base string) *RateStore {
+	return &RateStore{
+		path:   path,
+		rates:  Rates{Base: strings.ToUpper(base), Rates: map[string]string{}},
+		parsed: map[string]*big.Rat{},
+	}
+}
+
+// Load reads the rates file again, the rates in the memory are only replaced when the file is valid
+func (s *RateStore) Load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var rates Rates
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return err
+	}
+
+	return s.set(rates)
+}
+
+// Save validates the new rates, writes them to the rates file and then starts using them
+func (s *RateStore) Save(rates Rates) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	rates.Updated_At = time.Now().UTC().Truncate(time.Second)
+
+	parsed, err := s.parse(rates)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(rates, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+
+	// Write a temporary file next to the rates file and rename it, a crash in between never leaves a half written rates file
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Nothing is left after the rename, only a failed save leaves it
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.rates, s.parsed = normalise(rates), parsed
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *RateStore) set(rates Rates) error {
+	parsed, err := s.parse(rates)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.rates, s.parsed = normalise(rates), parsed
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *RateStore) parse(rates Rates) (map[string]*big.Rat, error) {
+	s.mu.RLock()
+	base := s.rates.Base
+	s.mu.RUnlock()
+
+	// The catalog is priced in the store currency, rates for any other base would convert wrongly
+	if !strings.EqualFold(rates.Base, base) {
+		return nil, errors.New("the base of the rates must be " + base)
+	}
+
+	parsed := make(map[string]*big.Rat, len(rates.Rates))
+	for code, value := range rates.Rates {
+		rate, ok := new(big.Rat).SetString(value)
+		if len(code) != 3 || !ok || rate.Sign() <= 0 {
+			return nil, errors.New("invalid rate for " + code)
+		}
+		parsed[strings.ToUpper(code)] = rate
+	}
+
+	return parsed, nil
+}
+
+func normalise(rates Rates) Rates {
+	normalised := Rates{Base: strings.ToUpper(rates.Base), Rates: make(map[string]string, len(rates.Rates)), Updated_At: rates.Updated_At}
+	for code, value := range rates.Rates {
+		normalised.Rates[strings.ToUpper(code)] = value
+	}
+	return normalised
+}
+
+func (s *RateStore) Base() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rates.Base
+}
+
+// Snapshot returns a copy of the current rates, safe to send as json
+func (s *RateStore) Snapshot() Rates {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return normalise(s.rates)
+}
+
+// Currencies is the store currency and every currency with a rate
+func (s *RateStore) Currencies() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	currencies := []string{s.rates.Base}
+	for code := range s.parsed {
+		if code != s.rates.Base {
+			currencies = append(currencies, code)
+		}
+	}
+	sort.Strings(currencies[1:])
+	return currencies
+}
+
+func (s *RateStore) IsSupported(currency string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	currency = strings.ToUpper(currency)
+	_, ok := s.parsed[currency]
+	return ok || currency == s.rates.Base
+}
+
+// Rate returns "1 base = rate currency" as the decimal string saved in the order, "1" for the store currency itself
+func (s *RateStore) Rate(currency string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	currency = strings.ToUpper(currency)
+	if currency == s.rates.Base {
+		return "1", nil
+	}
+
+	if _, ok := s.parsed[currency]; !ok {
+		return "", ErrUnsupportedCurrency
+	}
+	return s.rates.Rates[currency], nil
+}
+
+// Convert changes an amount of the store currency into another currency.
+// The minor units can have a different number of digits (INR 2, JPY 0, KWD 3) so the result is scaled with the exponents and then rounded half to even.
+func (s *RateStore) Convert(money models.Money, to string) (models.Money, error) {
+	to = strings.ToUpper(to)
+	if money.Currency == to {
+		return money, nil
+	}
+
+	s.mu.RLock()
+	rate, ok := s.parsed[to]
+	base := s.rates.Base
+	s.mu.RUnlock()
+
+	if !ok || money.Currency != base {
+		return money, ErrUnsupportedCurrency
+	}
+
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(money.Amount), rate)
+
+	exponentDifference := models.CurrencyExponent(to) - models.CurrencyExponent(base)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exponentDifference))), nil))
+	if exponentDifference >= 0 {
+		converted.Mul(converted, scale)
+	} else {
+		converted.Quo(converted, scale)
+	}
+
+	return models.Money{Amount: models.RoundHalfEven(converted), Currency: to}, nil
+}
+
+// ToBase changes an amount of another currency back into the store currency, e.g. a price filter the customer typed in USD.
+// It is the opposite of Convert :- the amount is divided by the rate and then rounded half to even.
+func (s *RateStore) ToBase(money models.Money) (models.Money, error) {
+	s.mu.RLock()
+	rate, ok := s.parsed[money.Currency]
+	base := s.rates.Base
+	s.mu.RUnlock()
+
+	if money.Currency == base {
+		return money, nil
+	}
+	if !ok {
+		return money, ErrUnsupportedCurrency
+	}
+
+	converted := new(big.Rat).Quo(new(big.Rat).SetInt64(money.Amount), rate)
+
+	exponentDifference := models.CurrencyExponent(base) - models.CurrencyExponent(money.Currency)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exponentDifference))), nil))
+	if exponentDifference >= 0 {
+		converted.Mul(converted, scale)
+	} else {
+		converted.Quo(converted, scale)
+	}
+
+	return models.Money{Amount: models.RoundHalfEven(converted), Currency: base}, nil
+}
+
+// Price gives the price shown and charged in the wanted currency :- the fixed price of the admin for that currency if there is one, otherwise the converted one
+func (s *RateStore) Price(price models.Money, overrides []models.Money, to string) (models.Money, error) {
+	to = strings.ToUpper(to)
+	for _, override := range overrides {
+		if override.Currency == to {
+			return override, nil
+		}
+	}
+
+	return s.Convert(price, to)
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
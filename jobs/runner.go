@@ -0,0 +1,281 @@
+package jobs
+
+import (
+	"context"
+	"ecommerce/database"
+	"ecommerce/models"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Handler runs one job, an error (or a panic) makes the job run again later until it used all its attempts
+type Handler func(ctx context.Context, job models.Job) error
+
+const (
+	// How long an idle worker waits before it looks for due jobs again, a new job wakes a worker straight away
+	pollInterval = 5 * time.Second
+	// How long one attempt may run, its lock on the job ends at the same time so another worker can take a lost job over
+	jobTimeout = 5 * time.Minute
+	// The wait before the first retry, it doubles with every attempt up to maxBackoff
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// Runner is the job queue of the service :- the jobs are saved in Mongo, so they survive a restart and are shared by all the instances.
+// Workers (as many as the concurrency) pick the due jobs one at a time, a type can be limited to fewer workers at once.
+type Runner struct {
+	jobs        *mongo.Collection
+	deadJobs    *mongo.Collection
+	concurrency int
+	maxAttempts int
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	limits   map[string]int // Most jobs of a type running at once, a type without a limit may use every worker
+	running  map[string]int
+
+	wake       chan struct{}
+	quit       chan struct{}
+	stopOnce   sync.Once
+	jobCtx     context.Context
+	cancelJobs context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+func NewRunner(jobCollection *mongo.Collection, deadJobCollection *mongo.Collection, concurrency int, maxAttempts int) *Runner {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+
+	return &Runner{
+		jobs:        jobCollection,
+		deadJobs:    deadJobCollection,
+		concurrency: concurrency,
+		maxAttempts: maxAttempts,
+		handlers:    make(map[string]Handler),
+		limits:      make(map[string]int),
+		running:     make(map[string]int),
+		wake:        make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+		jobCtx:      jobCtx,
+		cancelJobs:  cancelJobs,
+	}
+}
+
+// Handle registers the handler of a job type, only the types with a handler are picked by this runner
+func (r *Runner) Handle(jobType string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[jobType] = handler
+}
+
+// Limit lets at most n jobs of this type run at once in this runner, e.g. for a mail server which takes few connections
+func (r *Runner) Limit(jobType string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits[jobType] = n
+}
+
+// Enqueue saves a job which runs as soon as a worker is free
+func (r *Runner) Enqueue(ctx context.Context, jobType string, payload any) (models.Job, error) {
+	return r.EnqueueAt(ctx, jobType, payload, time.Now())
+}
+
+// EnqueueIn saves a job which runs after the delay
+func (r *Runner) EnqueueIn(ctx context.Context, jobType string, payload any, delay time.Duration) (models.Job, error) {
+	return r.EnqueueAt(ctx, jobType, payload, time.Now().Add(delay))
+}
+
+// EnqueueAt saves a job which runs at runAt. The payload must be a struct or a map, the handler reads it back with job.Decode.
+func (r *Runner) EnqueueAt(ctx context.Context, jobType string, payload any, runAt time.Time) (models.Job, error) {
+	job, err := database.EnqueueJob(ctx, r.jobs, jobType, payload, runAt, r.maxAttempts)
+	if err != nil {
+		return job, err
+	}
+
+	// Wake one idle worker, when none is idle the job waits for the next free one
+	if !runAt.After(time.Now()) {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return job, nil
+}
+
+// Start runs the workers until Shutdown
+func (r *Runner) Start() {
+	for i := 0; i < r.concurrency; i++ {
+		r.wg.Add(1)
+		go r.work()
+	}
+}
+
+// Shutdown stops picking new jobs and waits for the running ones to finish. When ctx ends first the running jobs are cancelled ;
+// a job which does not stop keeps its lock until the job timeout and is then taken over by the next start of the service.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.quit) })
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		r.cancelJobs()
+		return nil
+	case <-ctx.Done():
+		r.cancelJobs()
+		return ctx.Err()
+	}
+}
+
+func (r *Runner) work() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.quit:
+			return
+		default:
+		}
+
+		job, found := r.claim()
+		if !found {
+			select {
+			case <-r.quit:
+				return
+			case <-r.wake:
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		r.run(job)
+	}
+}
+
+// claim picks the next due job of a type which has a handler and a free slot.
+// A slot of every limited type is reserved before Mongo is asked, so a type never goes over its limit
+// while the other workers claim at the same time ; the slots of the types which did not get the job are given back after.
+func (r *Runner) claim() (models.Job, bool) {
+	r.mu.Lock()
+	jobTypes := make([]string, 0, len(r.handlers))
+	reserved := make(map[string]bool)
+	for jobType := range r.handlers {
+		if limit, ok := r.limits[jobType]; ok {
+			if r.running[jobType] >= limit {
+				continue
+			}
+			r.running[jobType]++
+			reserved[jobType] = true
+		}
+		jobTypes = append(jobTypes, jobType)
+	}
+	r.mu.Unlock()
+
+	if len(jobTypes) == 0 {
+		return models.Job{}, false
+	}
+
+	// The lock is not held here, the other workers keep claiming and finishing their jobs while this one waits for Mongo
+	ctx, cancel := context.WithTimeout(r.jobCtx, 10*time.Second)
+	defer cancel()
+
+	job, found, err := database.ClaimJob(ctx, r.jobs, jobTypes, jobTimeout)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for jobType := range reserved {
+		if !found || err != nil || jobType != job.Type {
+			r.running[jobType]--
+		}
+	}
+
+	if err != nil || !found {
+		return models.Job{}, false
+	}
+
+	if !reserved[job.Type] {
+		r.running[job.Type]++
+	}
+	return job, true
+}
+
+func (r *Runner) run(job models.Job) {
+	defer func() {
+		r.mu.Lock()
+		r.running[job.Type]--
+		r.mu.Unlock()
+	}()
+
+	var err error
+	if job.Attempts > job.Max_Attempts {
+		// Only a job which was taken over from lost workers gets here, it is not run once more
+		err = fmt.Errorf("the job was lost %d times while it ran", job.Attempts-1)
+	} else {
+		err = r.call(job)
+	}
+
+	// The result is saved even when the shutdown cancelled the job context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch {
+	case err == nil:
+		err = database.CompleteJob(ctx, r.jobs, job)
+	case job.Attempts >= job.Max_Attempts:
+		log.Println("Job "+job.Type+" "+job.Job_ID.Hex()+" failed for the last time :- ", err)
+		err = database.DeadLetterJob(ctx, r.jobs, r.deadJobs, job, err.Error())
+	default:
+		log.Println("Job "+job.Type+" "+job.Job_ID.Hex()+" failed, it runs again later :- ", err)
+		err = database.RetryJob(ctx, r.jobs, job, err.Error(), time.Now().Add(backoff(job.Attempts)))
+	}
+
+	if err != nil {
+		log.Println("Error while saving the result of the job "+job.Job_ID.Hex()+" :- ", err)
+	}
+}
+
+// call runs the handler with the job timeout, a panic fails the attempt instead of the service
+func (r *Runner) call(job models.Job) (err error) {
+	r.mu.Lock()
+	handler := r.handlers[job.Type]
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.jobCtx, jobTimeout)
+	defer cancel()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("the job panicked :- %v", recovered)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// backoff is the wait after the attempt failed :- 30s, 1m, 2m, 4m ... at most an hour
+func backoff(attempt int) time.Duration {
+	wait := baseBackoff
+	for i := 1; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"ecommerce/constants"
 	"ecommerce/controllers"
 	"ecommerce/database"
 	"ecommerce/middleware"
 	"ecommerce/routes"
+	"ecommerce/scheduler"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,13 +36,52 @@ func init() {
 
 func main() {
 
+	// Sub commands like "ecommerce import products.csv" runs and exits without starting the server
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	// Every change saves its domain events in the same transaction, without transactions the server does not start
+	checkCtx, cancelCheck := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := database.CheckTransactions(checkCtx); err != nil {
+		log.Fatal("Error while checking the transactions of MongoDB :- ", err)
+	}
+	cancelCheck()
+
+	// Orders must not go out without their tax or their shipping price, a broken setup stops the start
+	if err := controllers.CheckCheckoutConfig(); err != nil {
+		log.Fatal("Error in the checkout configuration :- ", err)
+	}
+
 	// Product Data from Product Collection and User Data from User Collection
 	// Cart Controller
 	app := controllers.NewApplication(database.ProductData(database.Client, "Products"), database.UserData(database.Client, "Users"))
 
+	// Responses of the order creating api's, so a retried or double clicked checkout does not place a second order
+	idempotencyKeys := database.IdempotencyData(database.Client, "IdempotencyKeys")
+
 	router := gin.Default() // Default returns a gin engine instance which is used to build a middleware, logger and routing purposes. creates a new Gin router with two middlewares already included : Logger and Recovery Middleware
 
+	// Every api reads the currency of the request (X-Currency header or ?currency=), so it is registered before all the routes
+	router.Use(middleware.Currency(controllers.ExchangeRates))
+
 	routes.TestRoutes(router)
+	// These routes have public api's so they must be registered before UserRoutes puts the Authentication middleware on the whole router
+	routes.ReviewRoutes(router)
+	routes.ImageRoutes(router)
+	routes.CurrencyRoutes(router)
+	routes.CouponRoutes(router)
+	routes.PromotionRoutes(router)
+	routes.ShippingRoutes(router)
+	routes.PaymentRoutes(router)
+	routes.ReturnRoutes(router)
+	routes.AddressRoutes(router)
+	routes.CartRoutes(router)
+	routes.WishlistRoutes(router)
+	routes.GuestRoutes(router, idempotencyKeys)
+	routes.JobRoutes(router)
+	routes.NotificationRoutes(router)
+	routes.EventRoutes(router)
 	routes.UserRoutes(router)
 
 	// Pass the middleware in Use method
@@ -43,14 +89,47 @@ func main() {
 	// Below are the api's will authorize first from the middleware
 	router.GET("/addtocart", app.AddToCart())
 	router.GET("/removeitem", app.RemoveItemFromCart())
-	router.GET("/cartcheckout", app.BuyFromCart())
-	router.GET("/instantbuy", app.InstantBuy())
+	router.POST("/cartcheckout", middleware.Idempotency(idempotencyKeys), app.BuyFromCart())
+	router.POST("/instantbuy", middleware.Idempotency(idempotencyKeys), app.InstantBuy())
 
 	router.GET("/listcart", controllers.GetItemFromCart())
-	router.POST("/addaddress", controllers.AddAddress())
-	router.PUT("/edithomeaddress", controllers.EditHomeAddress())
-	router.PUT("/editworkaddress", controllers.EditWorkAddress())
-	router.GET("/deleteaddresses", controllers.DeleteAddress())
 
-	log.Fatal(router.Run(":" + port)) // when critical errors encounter in the program which stops the continuation of the program so we have to log the error messages and then immediately terminates the program with a non-zero exit status code
+	// Ctrl+C or the SIGTERM of docker / kubernetes cancels this context, that starts the graceful shutdown below
+	stopCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background work which runs inside the service :- the job workers and the scheduled tasks like the reminders of the abandoned carts
+	// and the publishing of the domain events
+	controllers.Jobs.Start()
+	tasks := scheduler.New()
+	tasks.Add(controllers.AbandonedCartTask())
+	tasks.Add(controllers.OutboxTask())
+	tasks.Add(controllers.PendingPaymentTask())
+	tasks.Start(stopCtx)
+
+	server := &http.Server{Addr: ":" + port, Handler: router}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err) // when critical errors encounter in the program which stops the continuation of the program so we have to log the error messages and then immediately terminates the program with a non-zero exit status code
+		}
+	}()
+
+	<-stopCtx.Done()
+	log.Println("Shutting down ...")
+
+	// The requests in flight and the running jobs get this long to finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error while stopping the http server :- ", err)
+	}
+	tasks.Wait()
+	if err := controllers.Jobs.Shutdown(shutdownCtx); err != nil {
+		log.Println("Some jobs did not finish, they run again after the restart :- ", err)
+	}
+	if err := database.Client.Disconnect(shutdownCtx); err != nil {
+		log.Println("Error while disconnecting mongoDB :- ", err)
+	}
 }
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"context"
+	"ecommerce/database"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Admin lets only the accounts with the admin role through, it runs after Authentication which puts the user id in "uid"
+func Admin(userCollection *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		admin, err := database.IsAdmin(ctx, userCollection, c.GetString("uid"))
+		if err != nil && !errors.Is(err, database.ErrUserIdIsNotValid) {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+			c.Abort()
+			return
+		}
+		if !admin {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "Only an admin can do this"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
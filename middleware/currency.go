@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"ecommerce/exchange"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Currency picks the currency of the request from the X-Currency header or the ?currency= query, the store currency by default.
+// The handlers read it back with c.GetString("currency").
+func Currency(rates *exchange.RateStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currency := c.GetHeader("X-Currency")
+		if currency == "" {
+			currency = c.Query("currency")
+		}
+		if currency == "" {
+			currency = rates.Base()
+		}
+
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		if !rates.IsSupported(currency) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Currency " + currency + " is not supported"})
+			c.Abort()
+			return
+		}
+
+		c.Set("currency", currency)
+		c.Next()
+	}
+}
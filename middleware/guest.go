@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"ecommerce/constants"
+	"ecommerce/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CartTokenHeader carries the signed token of a guest cart
+const CartTokenHeader = "X-Cart-Token"
+
+// GuestCart lets a visitor without an account use the guest cart of the X-Cart-Token header.
+// The cart id is put in "uid" like Authentication does, so the cart api's work the same way for a guest ; "guest" tells them apart.
+func GuestCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cartId, ok := utils.VerifyCartToken(constants.SECRET_KEY, c.GetHeader(CartTokenHeader))
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "The cart token is missing or invalid"})
+			c.Abort()
+			return
+		}
+
+		c.Set("uid", cartId)
+		c.Set("guest", true)
+		c.Next()
+	}
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"ecommerce/constants"
+	"ecommerce/database"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Keys longer than this are refused, a UUID is what the clients are expected to send
+const maxIdempotencyKeyLength = 255
+
+// A checkout body is a small json document, a bigger body is refused before it is read into memory
+const maxIdempotentBodyBytes = 1 << 20
+
+// How long the record of the key may take to save, the handler in between has its own time
+const idempotencyRecordTimeout = 10 * time.Second
+
+// responseRecorder keeps a copy of everything the handler writes, so the response can be saved for the repeats
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(data string) (int, error) {
+	r.body.WriteString(data)
+	return r.ResponseWriter.WriteString(data)
+}
+
+// Idempotency makes a route safe to retry :- the first request with an Idempotency-Key header runs and its response is kept
+// for IDEMPOTENCY_WINDOW_HOURS, a repeat of it gets the same response back without running again (with the Idempotent-Replayed header).
+// The same key with a different request is refused with 422, and 409 while the first request is still running.
+// A request without the header runs as usual. It must come after Authentication (or GuestCart), the keys of every user are separate.
+// The key is scoped to the "uid" of the request, so the handlers behind it must act on that user only and never on a user id of the query or the body.
+func Idempotency(idempotencyCollection *mongo.Collection) gin.HandlerFunc {
+	hours, err := strconv.Atoi(constants.IDEMPOTENCY_WINDOW_HOURS)
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+	window := time.Duration(hours) * time.Hour
+
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		// The body is read for the fingerprint and put back for the handler
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "message": "Request body is too large"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := hash(c.GetString("uid"), c.Request.Method, c.FullPath(), key)
+		fingerprint := hash(c.Request.URL.RawQuery, c.GetHeader("X-Currency"), string(body))
+
+		startCtx, cancelStart := context.WithTimeout(context.Background(), idempotencyRecordTimeout)
+		record, err := database.StartIdempotentRequest(startCtx, idempotencyCollection, scope, fingerprint, window)
+		cancelStart()
+		switch {
+		case errors.Is(err, database.ErrIdempotencyKeyReused):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "message": err.Error()})
+			c.Abort()
+			return
+		case errors.Is(err, database.ErrIdempotencyInProgress):
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusConflict, gin.H{"success": false, "message": err.Error()})
+			c.Abort()
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if record != nil {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.Response_Status, record.Content_Type, record.Response_Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+
+		c.Next()
+
+		// A fresh context, however long the handler took (e.g. a slow payment gateway) the response must still be saved,
+		// otherwise the key goes stale and a retry places the order a second time
+		finishCtx, cancelFinish := context.WithTimeout(context.Background(), idempotencyRecordTimeout)
+		defer cancelFinish()
+
+		// A server error may not have done anything, so the key is freed for a retry ; every other answer is final
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			database.AbandonIdempotentRequest(finishCtx, idempotencyCollection, scope)
+			return
+		}
+
+		database.FinishIdempotentRequest(finishCtx, idempotencyCollection, scope, status, recorder.body.Bytes(), recorder.Header().Get("Content-Type"))
+	}
+}
+
+// hash joins the parts with a separator which can not be in a header, so ("ab", "c") and ("a", "bc") differ
+func hash(parts ...string) string {
+	digest := sha256.New()
+	for _, part := range parts {
+		digest.Write([]byte(part))
+		digest.Write([]byte{0})
+	}
+	return hex.EncodeToString(digest.Sum(nil))
+}
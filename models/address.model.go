@@ -3,9 +3,16 @@ package models
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Address struct {
-	Address_ID primitive.ObjectID `json:"address_id,omitempty" bson:"address_id,omitempty"`
-	House      *string            `json:"house" bson:"house"`
-	Street     *string            `json:"street" bson:"street"`
-	City       *string            `json:"city" bson:"city"`
-	Pincode    *string            `json:"pincode" bson:"pincode"`
+	Address_ID       primitive.ObjectID `json:"address_id,omitempty" bson:"address_id,omitempty"`
+	Label            string             `json:"label" bson:"label,omitempty" validate:"max=30"` // Free text like "Home", "Work" or "Mom's place"
+	Recipient_Name   string             `json:"recipient_name" bson:"recipient_name,omitempty"`
+	Phone            *string            `json:"phone" bson:"phone,omitempty"`
+	House            *string            `json:"house" bson:"house"`
+	Street           *string            `json:"street" bson:"street"`
+	City             *string            `json:"city" bson:"city"`
+	State            *string            `json:"state" bson:"state,omitempty"`
+	Pincode          *string            `json:"pincode" bson:"pincode"`                   // The postal code, checked against the rules of the country
+	Country          string             `json:"country" bson:"country,omitempty"`         // ISO 3166-1 alpha-2 code, DEFAULT_COUNTRY when it is not given
+	Default_Shipping bool               `json:"default_shipping" bson:"default_shipping"` // Used by the checkout when no shipping address is picked, one address at most
+	Default_Billing  bool               `json:"default_billing" bson:"default_billing"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Why a cart line does not match the live catalog any more
+const (
+	CartLinePriceChanged      = "price_changed"
+	CartLineUnavailable       = "unavailable"        // The product or the variant was deleted, or it is out of stock
+	CartLineInsufficientStock = "insufficient_stock" // Fewer pieces are left than the cart has
+)
+
+// CartChange is one difference between a cart line and the catalog ; the checkout waits until the customer acknowledges all of them
+type CartChange struct {
+	Product_ID   primitive.ObjectID `json:"product_id"`
+	Variant_ID   primitive.ObjectID `json:"variant_id"`
+	Product_Name *string            `json:"product_name"`
+	Reason       string             `json:"reason"`
+	Old_Price    *Money             `json:"old_price,omitempty"` // Price in the cart, for price_changed
+	New_Price    *Money             `json:"new_price,omitempty"` // Price in the catalog, for price_changed
+	Quantity     int                `json:"quantity"`            // Pieces in the cart
+	Available    int64              `json:"available"`           // Pieces left, for insufficient_stock and unavailable
+
+	Old_Price_Overrides []Money `json:"-"` // Needed to show the prices in the currency of the request
+	New_Price_Overrides []Money `json:"-"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event of the abandoned cart reminder
+const CartAbandoned = "cart.abandoned"
+
+const (
+	CartReminderSent   = "sent"
+	CartReminderFailed = "failed"
+)
+
+// CartReminder records one reminder about one version of a cart, a cart gets a new reminder only after it changed again
+type CartReminder struct {
+	Reminder_ID     primitive.ObjectID `json:"_id" bson:"_id"`
+	User_ID         string             `json:"user_id" bson:"user_id"`
+	Cart_Updated_At time.Time          `json:"cart_updated_at" bson:"cart_updated_at"`
+	Items           int                `json:"items" bson:"items"` // Lines in the cart
+	Status          string             `json:"status" bson:"status"`
+	Error           string             `json:"error,omitempty" bson:"error,omitempty"`
+	Sent_At         time.Time          `json:"sent_at" bson:"sent_at"`
+}
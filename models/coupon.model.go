@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Coupon Types
+const (
+	CouponPercentage   = "percentage"    // Percent_Off of the eligible lines, optionally capped by Max_Discount
+	CouponFixed        = "fixed"         // Amount_Off, never more than the eligible lines
+	CouponFreeShipping = "free_shipping" // No discount on the items, the order ships for free
+)
+
+type Coupon struct {
+	Coupon_ID      primitive.ObjectID   `json:"_id,omitempty" bson:"_id,omitempty"`
+	Code           string               `json:"code" validate:"required,min=3,max=30,alphanum" bson:"code"` // Always saved in upper case
+	Type           string               `json:"type" validate:"required,oneof=percentage fixed free_shipping" bson:"type"`
+	Percent_Off    int64                `json:"percent_off" validate:"min=0,max=10000" bson:"percent_off"` // Basis points, 1250 = 12.5 %
+	Amount_Off     Money                `json:"amount_off" bson:"amount_off"`
+	Max_Discount   *Money               `json:"max_discount,omitempty" bson:"max_discount,omitempty"`
+	Min_Basket     Money                `json:"min_basket" bson:"min_basket"` // Cart subtotal needed before the coupon works
+	Starts_At      *time.Time           `json:"starts_at,omitempty" bson:"starts_at,omitempty"`
+	Expires_At     *time.Time           `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	Usage_Limit    int64                `json:"usage_limit" validate:"min=0" bson:"usage_limit"`       // Total redemptions of the coupon, 0 = unlimited
+	Per_User_Limit int64                `json:"per_user_limit" validate:"min=0" bson:"per_user_limit"` // Redemptions per customer, 0 = unlimited
+	Used_Count     int64                `json:"used_count" bson:"used_count"`
+	Used_By_User   int64                `json:"-" bson:"-"`                                         // Redemptions of the customer the cart is priced for, loaded from the CouponRedemptions collection
+	Product_IDs    []primitive.ObjectID `json:"product_ids,omitempty" bson:"product_ids,omitempty"` // When set only these products get the discount
+	Categories     []string             `json:"categories,omitempty" bson:"categories,omitempty"`   // When set only products of these categories get the discount
+	Active         bool                 `json:"active" bson:"active"`
+	Created_At     time.Time            `json:"created_at" bson:"created_at"`
+}
+
+// CouponRedemption counts the uses of one coupon by one customer. One small document per (coupon, customer) instead of a map
+// inside the coupon, a popular coupon would otherwise grow by one key per customer up to the document size limit.
+type CouponRedemption struct {
+	Coupon_ID primitive.ObjectID `json:"coupon_id" bson:"coupon_id"`
+	User_ID   string             `json:"user_id" bson:"user_id"`
+	Count     int64              `json:"count" bson:"count"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Domain events which the other services can react to, the type is also the last part of the subject on NATS
+const (
+	EventOrderPlaced    = "OrderPlaced"    // Data :- user_id, order
+	EventCartUpdated    = "CartUpdated"    // Data :- user_id, reason, variant_id / quantity when one line changed
+	EventProductChanged = "ProductChanged" // Data :- product_id, change, sku when one variant changed
+	EventUserRegistered = "UserRegistered" // Data :- user_id, email, first_name, last_name
+)
+
+// Why the cart changed
+const (
+	CartItemAdded         = "item_added"
+	CartItemRemoved       = "item_removed"
+	CartCheckedOut        = "checked_out"
+	CartChangesAccepted   = "changes_acknowledged"
+	CartGuestCartAttached = "guest_cart_attached"
+)
+
+// What changed on the product
+const (
+	ProductCreated        = "created"
+	ProductVariantAdded   = "variant_added"
+	ProductVariantUpdated = "variant_updated"
+	ProductImageAdded     = "image_added"
+	ProductImageRemoved   = "image_removed"
+	ProductRatingChanged  = "rating_changed"
+)
+
+const (
+	OutboxPending   = "pending"   // Waits for the dispatcher, Published_To has the sinks which already got it
+	OutboxPublished = "published" // Every sink got it
+	OutboxFailed    = "failed"    // A sink refused it Max_Attempts times, an admin can send it again
+)
+
+// DomainEvent is saved in the outbox together with the change it tells about, the dispatcher then publishes it to the sinks.
+// Data is the json the sinks get, so an event looks the same in the outbox, on the webhook and on NATS.
+type DomainEvent struct {
+	Event_ID        primitive.ObjectID `json:"event_id" bson:"_id"`
+	Type            string             `json:"type" bson:"type"`
+	Aggregate_ID    string             `json:"aggregate_id" bson:"aggregate_id"` // Id of the order, cart (user) or product the event is about
+	Data            json.RawMessage    `json:"data" bson:"data"`
+	Occurred_At     time.Time          `json:"occurred_at" bson:"occurred_at"`
+	Status          string             `json:"status" bson:"status"`
+	Attempts        int                `json:"attempts" bson:"attempts"`
+	Published_To    []string           `json:"published_to" bson:"published_to"`                     // Names of the sinks which got the event, a retry skips them
+	Next_Attempt_At time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`               // Not published before this time, a failed attempt moves it later
+	Locked_Until    *time.Time         `json:"locked_until,omitempty" bson:"locked_until,omitempty"` // A dispatcher is publishing it until then
+	Last_Error      string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	Published_At    *time.Time         `json:"published_at,omitempty" bson:"published_at,omitempty"` // A TTL index removes the published events some days after this time
+}
+
+// Message is the event as the sinks send it, without the bookkeeping of the outbox
+func (e DomainEvent) Message() ([]byte, error) {
+	return json.Marshal(struct {
+		Event_ID     primitive.ObjectID `json:"event_id"`
+		Type         string             `json:"type"`
+		Aggregate_ID string             `json:"aggregate_id"`
+		Data         json.RawMessage    `json:"data"`
+		Occurred_At  time.Time          `json:"occurred_at"`
+	}{e.Event_ID, e.Type, e.Aggregate_ID, e.Data, e.Occurred_At})
+}
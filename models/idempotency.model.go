@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyRecord is the first response to a request with an Idempotency-Key, a repeat of the request gets this response again
+type IdempotencyRecord struct {
+	Key             string    `bson:"_id"`         // Hash of the user, the route and the key
+	Fingerprint     string    `bson:"fingerprint"` // Hash of the request, the same key with another request is refused
+	Status          string    `bson:"status"`
+	Response_Status int       `bson:"response_status"`
+	Response_Body   []byte    `bson:"response_body"`
+	Content_Type    string    `bson:"content_type"`
+	Created_At      time.Time `bson:"created_at"`
+	Expires_At      time.Time `bson:"expires_at"` // A TTL index removes the record after this time
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Image is the metadata of an uploaded product image, the files itself live in the blob storage under the keys below.
+type Image struct {
+	Image_ID       primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Product_ID     primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Content_Type   string             `json:"content_type" bson:"content_type"`
+	Width          int                `json:"width" bson:"width"`
+	Height         int                `json:"height" bson:"height"`
+	Size           int64              `json:"size" bson:"size"`        // Bytes of the original upload
+	Original       string             `json:"-" bson:"original"`       // Storage key of the original file
+	Thumbnails     map[string]string  `json:"-" bson:"thumbnails"`     // "small" -->> storage key
+	Thumbnail_Type string             `json:"-" bson:"thumbnail_type"` // Thumbnails are png for png / gif uploads (keeps transparency), otherwise jpeg
+	Created_At     time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	JobPending = "pending" // Waits for its Run_At
+	JobRunning = "running" // A worker has it until Locked_Until
+	JobDone    = "done"
+	JobDead    = "dead" // Failed Max_Attempts times, it is kept in the dead letter collection
+)
+
+// Job is one piece of background work, Type picks the handler which runs it and Payload has its input
+type Job struct {
+	Job_ID       primitive.ObjectID `json:"_id" bson:"_id"`
+	Type         string             `json:"type" bson:"type"`
+	Payload      bson.Raw           `json:"-" bson:"payload"`
+	Status       string             `json:"status" bson:"status"`
+	Attempts     int                `json:"attempts" bson:"attempts"`
+	Max_Attempts int                `json:"max_attempts" bson:"max_attempts"`
+	Run_At       time.Time          `json:"run_at" bson:"run_at"`                                 // Not started before this time, a retry moves it later
+	Locked_Until *time.Time         `json:"locked_until,omitempty" bson:"locked_until,omitempty"` // A running job still running after this time was lost with its worker and runs again
+	Last_Error   string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	Created_At   time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At   time.Time          `json:"updated_at" bson:"updated_at"`
+	Finished_At  *time.Time         `json:"finished_at,omitempty" bson:"finished_at,omitempty"` // A TTL index removes the done jobs some days after this time
+}
+
+// Decode reads the payload into v, the same type the job was enqueued with
+func (j Job) Decode(v any) error {
+	return bson.Unmarshal(j.Payload, v)
+}
@@ -0,0 +1,288 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"ecommerce/constants"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("cannot mix amounts of different currencies")
+	ErrInvalidAmount    = errors.New("invalid amount")
+)
+
+// Money is an amount in the minor unit of its currency (paisa, cent) together with the ISO 4217 currency code.
+// Integers never lose a paisa like float64 does and int64 never overflows for any realistic basket, unlike the old int32 totals.
+//
+// Rounding rule :- every operation which can produce a fraction of the minor unit (percentages, tax, exchange rates) rounds half to even (banker's rounding),
+// so rounding many lines does not drift upwards on average.
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+// Number of digits after the decimal point, currencies not listed here have 2
+var currencyExponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+	"JOD": 3,
+	"TND": 3,
+}
+
+func CurrencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// DefaultCurrency is the base currency of the store, DEFAULT_CURRENCY in the .env
+func DefaultCurrency() string {
+	if constants.DEFAULT_CURRENCY != "" {
+		return constants.DEFAULT_CURRENCY
+	}
+	return "INR"
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// ParseMoney reads a decimal amount in the major unit ("499.99") ; more decimals than the currency has is an error and never silently rounded.
+func ParseMoney(value string, currency string) (Money, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = DefaultCurrency()
+	}
+
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	exponent := CurrencyExponent(currency)
+
+	if whole == "" || len(fraction) > exponent || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, ErrInvalidAmount
+	}
+
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	amount, ok := new(big.Int).SetString(whole+fraction, 10)
+	if !ok || !amount.IsInt64() {
+		return Money{}, ErrInvalidAmount
+	}
+
+	money := Money{Amount: amount.Int64(), Currency: currency}
+	if negative {
+		money.Amount = -money.Amount
+	}
+	return money, nil
+}
+
+func isDigits(value string) bool {
+	for _, char := range value {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// In tells if the amount can be added to or compared with amounts of the currency without a panic
+func (m Money) In(currency string) bool {
+	return m.Currency == currency || (m.Currency == "" && m.Amount == 0)
+}
+
+// Add and Sub panics on different currencies, amounts must be converted first ; mixing them is always a bug in the caller.
+// A zero Money without a currency takes the currency of the other side, so a total can start from Money{}.
+// Amounts which come from outside the code (files, the database, other services) are checked with In before they are mixed.
+func (m Money) Add(other Money) Money {
+	currency := m.sameCurrency(other)
+	return Money{Amount: m.Amount + other.Amount, Currency: currency}
+}
+
+func (m Money) Sub(other Money) Money {
+	currency := m.sameCurrency(other)
+	return Money{Amount: m.Amount - other.Amount, Currency: currency}
+}
+
+// Mul multiplies by a whole quantity, no rounding is needed
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// MulRatio returns m * numerator / denominator rounded half to even
+func (m Money) MulRatio(numerator int64, denominator int64) Money {
+	result := new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(numerator)), big.NewInt(denominator))
+	return Money{Amount: RoundHalfEven(result), Currency: m.Currency}
+}
+
+// Percent takes basis points, 1250 = 12.5 %
+func (m Money) Percent(basisPoints int64) Money {
+	return m.MulRatio(basisPoints, 10000)
+}
+
+// Cmp returns -1, 0 or +1 like the other compare functions of Go
+func (m Money) Cmp(other Money) int {
+	m.sameCurrency(other)
+	switch {
+	case m.Amount < other.Amount:
+		return -1
+	case m.Amount > other.Amount:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) sameCurrency(other Money) string {
+	switch {
+	case m.Currency == other.Currency:
+		return m.Currency
+	case m.Currency == "" && m.Amount == 0:
+		return other.Currency
+	case other.Currency == "" && other.Amount == 0:
+		return m.Currency
+	}
+	panic(fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency))
+}
+
+// String gives the amount in the major unit with the currency digits, 49999 INR -->> "499.99"
+func (m Money) String() string {
+	exponent := CurrencyExponent(m.Currency)
+	amount := m.Amount
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+
+	absolute := new(big.Int).Abs(big.NewInt(amount)).String()
+	if exponent == 0 {
+		return sign + absolute
+	}
+
+	if len(absolute) <= exponent {
+		absolute = strings.Repeat("0", exponent-len(absolute)+1) + absolute
+	}
+
+	return sign + absolute[:len(absolute)-exponent] + "." + absolute[len(absolute)-exponent:]
+}
+
+// RoundHalfEven rounds a fraction to the nearest whole number, exactly half goes to the even neighbour (2.5 -->> 2, 3.5 -->> 4)
+func RoundHalfEven(value *big.Rat) int64 {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+
+	// Compare 2 * |remainder| with the denominator to know if we are below, at or above the half
+	twice := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2))
+	switch twice.Cmp(value.Denom()) {
+	case 1:
+		quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+	case 0:
+		if quotient.Bit(0) == 1 {
+			quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+		}
+	}
+
+	return quotient.Int64()
+}
+
+// The json has the exact minor units for the programs and the formatted value for the people :- {"amount": 49999, "currency": "INR", "value": "499.99"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+		Value    string `json:"value"`
+	}{m.Amount, m.Currency, m.String()})
+}
+
+// UnmarshalJSON accepts the minor units in "amount" or a decimal string in "value" ; without a currency the store currency is used
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var input struct {
+		Amount   *int64  `json:"amount"`
+		Currency string  `json:"currency"`
+		Value    *string `json:"value"`
+	}
+
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+
+	currency := strings.ToUpper(input.Currency)
+	if currency == "" {
+		currency = DefaultCurrency()
+	}
+
+	switch {
+	case input.Value != nil:
+		money, err := ParseMoney(*input.Value, currency)
+		if err != nil {
+			return err
+		}
+		*m = money
+	case input.Amount != nil:
+		*m = Money{Amount: *input.Amount, Currency: currency}
+	default:
+		return ErrInvalidAmount
+	}
+
+	return nil
+}
+
+// UnmarshalBSONValue reads the new {amount, currency} documents and also the old bare numbers saved before Money existed.
+// Those numbers were whole units of the store currency, so 499 becomes 49900 paisa. The migrate-money command rewrites them for good.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bsoncore.Value{Type: t, Data: data}
+	scale := int64(math.Pow10(CurrencyExponent(DefaultCurrency())))
+
+	switch t {
+	case bsontype.EmbeddedDocument:
+		type plainMoney Money // plainMoney has no UnmarshalBSONValue, so this does not call itself again
+		var plain plainMoney
+		if err := bson.Unmarshal(data, &plain); err != nil {
+			return err
+		}
+		*m = Money(plain)
+	case bsontype.Int32:
+		*m = Money{Amount: int64(value.Int32()) * scale, Currency: DefaultCurrency()}
+	case bsontype.Int64:
+		*m = Money{Amount: value.Int64() * scale, Currency: DefaultCurrency()}
+	case bsontype.Double:
+		amount := new(big.Rat).SetFloat64(value.Double())
+		if amount == nil {
+			return ErrInvalidAmount
+		}
+		*m = Money{Amount: RoundHalfEven(amount.Mul(amount, big.NewRat(scale, 1))), Currency: DefaultCurrency()}
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+	default:
+		return fmt.Errorf("cannot decode %s into Money", t)
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package models
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRoundHalfEven(t *testing.T) {
+	tests := []struct {
+		numerator   int64
+		denominator int64
+		want        int64
+	}{
+		{5, 2, 2},   // 2.5 -->> 2
+		{7, 2, 4},   // 3.5 -->> 4
+		{-5, 2, -2}, // -2.5 -->> -2
+		{-7, 2, -4}, // -3.5 -->> -4
+		{26, 10, 3}, // 2.6 -->> 3
+		{24, 10, 2}, // 2.4 -->> 2
+		{-26, 10, -3},
+		{1, 3, 0},
+		{2, 3, 1},
+		{10, 5, 2},
+		{0, 7, 0},
+	}
+
+	for _, test := range tests {
+		got := RoundHalfEven(big.NewRat(test.numerator, test.denominator))
+		if got != test.want {
+			t.Errorf("RoundHalfEven(%d/%d) = %d, want %d", test.numerator, test.denominator, got, test.want)
+		}
+	}
+}
+
+func TestMulRatioAndPercent(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want int64
+	}{
+		{"12.5 % of 1.00", NewMoney(100, "INR").Percent(1250), 12},     // 12.5 -->> 12
+		{"12.5 % of 3.00", NewMoney(300, "INR").Percent(1250), 38},     // 37.5 -->> 38
+		{"18 % of 499.99", NewMoney(49999, "INR").Percent(1800), 9000}, // 8999.82 -->> 9000
+		{"1/3 of 1.00", NewMoney(100, "INR").MulRatio(1, 3), 33},
+		{"inclusive 9 % of 118 %", NewMoney(11800, "INR").MulRatio(900, 11800), 900},
+	}
+
+	for _, test := range tests {
+		if test.got.Amount != test.want || test.got.Currency != "INR" {
+			t.Errorf("%s = %d %s, want %d INR", test.name, test.got.Amount, test.got.Currency, test.want)
+		}
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{"499.99", "INR", Money{49999, "INR"}, false},
+		{"499.9", "inr", Money{49990, "INR"}, false},
+		{"499", "USD", Money{49900, "USD"}, false},
+		{" 12.50 ", "", Money{1250, "INR"}, false}, // No currency is the store currency
+		{"-5.25", "INR", Money{-525, "INR"}, false},
+		{"0", "INR", Money{0, "INR"}, false},
+		{"1500", "JPY", Money{1500, "JPY"}, false},
+		{"1.234", "KWD", Money{1234, "KWD"}, false},
+		{"1.5", "JPY", Money{}, true},     // JPY has no minor unit
+		{"499.999", "INR", Money{}, true}, // Never rounded silently
+		{"", "INR", Money{}, true},
+		{".50", "INR", Money{}, true},
+		{"12a", "INR", Money{}, true},
+		{"1e3", "INR", Money{}, true},
+		{"99999999999999999999", "INR", Money{}, true}, // Does not fit in int64
+	}
+
+	for _, test := range tests {
+		got, err := ParseMoney(test.value, test.currency)
+		if test.wantErr {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("ParseMoney(%q, %q) error = %v, want ErrInvalidAmount", test.value, test.currency, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ParseMoney(%q, %q) = %v, %v ; want %v", test.value, test.currency, got, err, test.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{49999, "INR"}, "499.99"},
+		{Money{5, "INR"}, "0.05"},
+		{Money{-525, "INR"}, "-5.25"},
+		{Money{1500, "JPY"}, "1500"},
+		{Money{1234, "KWD"}, "1.234"},
+		{Money{0, "USD"}, "0.00"},
+	}
+
+	for _, test := range tests {
+		if got := test.money.String(); got != test.want {
+			t.Errorf("%d %s String() = %q, want %q", test.money.Amount, test.money.Currency, got, test.want)
+		}
+	}
+}
+
+func TestMoneyIn(t *testing.T) {
+	tests := []struct {
+		money    Money
+		currency string
+		want     bool
+	}{
+		{Money{100, "INR"}, "INR", true},
+		{Money{100, "USD"}, "INR", false},
+		{Money{}, "INR", true}, // A zero without a currency fits everywhere
+		{Money{100, ""}, "INR", false},
+	}
+
+	for _, test := range tests {
+		if got := test.money.In(test.currency); got != test.want {
+			t.Errorf("%v In(%s) = %v, want %v", test.money, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestAddPanicsOnCurrencyMismatch(t *testing.T) {
+	defer func() {
+		recovered := recover()
+		err, ok := recovered.(error)
+		if !ok || !errors.Is(err, ErrCurrencyMismatch) {
+			t.Errorf("Add of INR and USD recovered %v, want ErrCurrencyMismatch", recovered)
+		}
+	}()
+
+	NewMoney(100, "INR").Add(NewMoney(100, "USD"))
+}
+
+func TestAddTakesTheCurrencyOfAZeroTotal(t *testing.T) {
+	got := Money{}.Add(NewMoney(250, "INR"))
+	if got != (Money{250, "INR"}) {
+		t.Errorf("Money{}.Add(2.50 INR) = %v, want 250 INR", got)
+	}
+}
+
+// The prices saved before Money existed were bare numbers in whole units of the store currency
+func TestUnmarshalLegacyBSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  Money
+	}{
+		{"int32", int32(499), Money{49900, "INR"}},
+		{"int64", int64(1200), Money{120000, "INR"}},
+		{"double", 499.99, Money{49999, "INR"}},
+		{"double half", 0.125, Money{12, "INR"}}, // 12.5 paisa -->> 12
+		{"document", bson.D{{Key: "amount", Value: int64(1999)}, {Key: "currency", Value: "USD"}}, Money{1999, "USD"}},
+		{"null", nil, Money{}},
+	}
+
+	for _, test := range tests {
+		data, err := bson.Marshal(bson.D{{Key: "price", Value: test.value}})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		var decoded struct {
+			Price Money `bson:"price"`
+		}
+		if err := bson.Unmarshal(data, &decoded); err != nil {
+			t.Errorf("%s: decode error %v", test.name, err)
+			continue
+		}
+		if decoded.Price != test.want {
+			t.Errorf("%s: decoded %v, want %v", test.name, decoded.Price, test.want)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    Money
+		wantErr bool
+	}{
+		{`{"value": "499.99"}`, Money{49999, "INR"}, false},
+		{`{"amount": 49999, "currency": "usd"}`, Money{49999, "USD"}, false},
+		{`{"value": "1.5", "currency": "JPY"}`, Money{}, true},
+		{`{"currency": "INR"}`, Money{}, true},
+	}
+
+	for _, test := range tests {
+		var got Money
+		err := got.UnmarshalJSON([]byte(test.json))
+		if (err != nil) != test.wantErr || (!test.wantErr && got != test.want) {
+			t.Errorf("UnmarshalJSON(%s) = %v, %v ; want %v (error %v)", test.json, got, err, test.want, test.wantErr)
+		}
+	}
+}
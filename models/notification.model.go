@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Events the customers get an email or an sms about, next to CartAbandoned and the wishlist events
+const (
+	UserRegistered = "user.registered"
+	OrderConfirmed = "order.placed"
+	OrderSent      = "order.shipped"
+)
+
+const (
+	DeliveryQueued = "queued" // Waits for its job, also between two attempts
+	DeliverySent   = "sent"
+	DeliveryFailed = "failed" // Every attempt failed
+)
+
+// NotificationDelivery is the log of one message through one channel. The message is rendered when it is queued,
+// so a retry sends exactly the same message even when the data it was written from changed meanwhile.
+type NotificationDelivery struct {
+	Delivery_ID primitive.ObjectID `json:"_id" bson:"_id"`
+	Event       string             `json:"event" bson:"event"`
+	User_ID     string             `json:"user_id" bson:"user_id"`
+	Channel     string             `json:"channel" bson:"channel"`
+	Locale      string             `json:"locale" bson:"locale"`
+	To          string             `json:"to" bson:"to"`
+	Subject     string             `json:"subject,omitempty" bson:"subject,omitempty"`
+	Text        string             `json:"text" bson:"text"`
+	HTML        string             `json:"html,omitempty" bson:"html,omitempty"`
+	Status      string             `json:"status" bson:"status"`
+	Attempts    int                `json:"attempts" bson:"attempts"`
+	Last_Error  string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	Created_At  time.Time          `json:"created_at" bson:"created_at"`
+	Sent_At     *time.Time         `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+}
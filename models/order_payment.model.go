@@ -8,14 +8,117 @@ import (
 
 type Order struct {
 	Order_ID       primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Status         string             `json:"status" bson:"status"`
 	Order_Cart     []ProductUser      `json:"order_list" bson:"order_list"`
 	Ordered_At     time.Time          `json:"ordered_at" bson:"ordered_at"`
-	Price          int                `json:"total_price" bson:"total_price"`
-	Discount       *uint              `json:"discount" bson:"discount"`
+	Subtotal       Money              `json:"subtotal" bson:"subtotal"`       // Sum of the order lines
+	Adjustments    []Adjustment       `json:"adjustments" bson:"adjustments"` // Every promotion and coupon discount of the order, line by line
+	Discount       Money              `json:"discount" bson:"discount"`       // All the adjustments together
+	Shipping       Shipping           `json:"shipping" bson:"shipping"`
+	Tax_Lines      []TaxLine          `json:"tax_lines" bson:"tax_lines"`
+	Tax            Money              `json:"tax" bson:"tax"`
+	Tax_Inclusive  bool               `json:"tax_inclusive" bson:"tax_inclusive"` // The tax is already inside the prices and is not added on top
+	Price          Money              `json:"total_price" bson:"total_price"`     // Subtotal - Discount + Shipping (+ Tax when it is not inclusive), what the customer pays
+	Refunded       Money              `json:"refunded" bson:"refunded"`           // Paid back so far, through the gateway or by the store for cash on delivery
+	Coupon_Code    *string            `json:"coupon_code,omitempty" bson:"coupon_code,omitempty"`
+	Free_Shipping  bool               `json:"free_shipping" bson:"free_shipping"`
+	Currency       string             `json:"currency" bson:"currency"`           // Currency the customer picked and paid in
+	Exchange_Rate  string             `json:"exchange_rate" bson:"exchange_rate"` // 1 store currency = Exchange_Rate Currency at the time of checkout
+	Base_Price     Money              `json:"base_price" bson:"base_price"`       // Total in the store currency
 	Payment_Method Payment            `json:"payment_method" bson:"payment_method"`
+	Shipment       *Shipment          `json:"shipment,omitempty" bson:"shipment,omitempty"` // Set when the order is handed to the carrier
+
+	// Copies of the addresses at the time of checkout, editing or deleting a saved address later does not change the order
+	Shipping_Address Address `json:"shipping_address" bson:"shipping_address"`
+	Billing_Address  Address `json:"billing_address" bson:"billing_address"`
 }
 
 type Payment struct {
 	Digital bool `json:"digital" bson:"digital"`
 	COD     bool `json:"cod" bson:"cod"`
+
+	// Only digital payments go through the payment gateway
+	Provider  string `json:"provider,omitempty" bson:"provider,omitempty"`
+	Intent_ID string `json:"intent_id,omitempty" bson:"intent_id,omitempty"`
+	Status    string `json:"status,omitempty" bson:"status,omitempty"` // Status of the payment at the gateway
+	Captured  Money  `json:"captured" bson:"captured"`
+	Refunded  Money  `json:"refunded" bson:"refunded"`
+}
+
+// Status of an order, it follows the payment for digital orders
+const (
+	OrderPendingPayment    = "pending_payment" // Digital order waiting for the customer to pay
+	OrderPlaced            = "placed"          // Cash on delivery order
+	OrderPaid              = "paid"
+	OrderShipped           = "shipped" // Handed to the carrier, only a placed or paid order is shipped
+	OrderPaymentFailed     = "payment_failed"
+	OrderCancelled         = "cancelled"
+	OrderPartiallyRefunded = "partially_refunded"
+	OrderRefunded          = "refunded"
+)
+
+// Shipment is the parcel of a shipped order
+type Shipment struct {
+	Carrier         string    `json:"carrier" bson:"carrier"`
+	Tracking_Number string    `json:"tracking_number" bson:"tracking_number"`
+	Shipped_At      time.Time `json:"shipped_at" bson:"shipped_at"`
+}
+
+// ShipOrderRequest is the body of the admin api which ships an order
+type ShipOrderRequest struct {
+	Carrier         string `json:"carrier" validate:"required,max=50"`
+	Tracking_Number string `json:"tracking_number" validate:"required,max=100"`
+}
+
+// Payment methods a customer can pick at checkout
+const (
+	PaymentCOD     = "cod"
+	PaymentDigital = "digital"
+)
+
+// NewPayment turns the payment method of the checkout request into the flags stored on the order
+func NewPayment(method string) Payment {
+	return Payment{
+		Digital: method == PaymentDigital,
+		COD:     method == PaymentCOD,
+	}
+}
+
+// CheckoutRequest is the body of the checkout and the instant buy, the addresses must be in the address book of the user
+type CheckoutRequest struct {
+	Shipping_Address_ID primitive.ObjectID `json:"shipping_address_id"` // The default shipping address when it is not given
+	Billing_Address_ID  primitive.ObjectID `json:"billing_address_id"`  // The default billing address (or the shipping address) when it is not given
+	Payment_Method      string             `json:"payment_method" validate:"required,oneof=cod digital"`
+	Coupon_Code         *string            `json:"coupon_code"`     // Replaces the coupon applied to the cart, "" places the order without a coupon
+	Shipping_Method     string             `json:"shipping_method"` // The first shipping method when it is not given
+}
+
+// GuestCheckoutRequest is the body of the guest checkout, a guest has no address book so the addresses come with the order
+type GuestCheckoutRequest struct {
+	Email            string   `json:"email" validate:"required,email"` // Where the order confirmation goes
+	Shipping_Address Address  `json:"shipping_address"`
+	Billing_Address  *Address `json:"billing_address"` // The shipping address when it is not given
+	Payment_Method   string   `json:"payment_method" validate:"required,oneof=cod digital"`
+	Coupon_Code      *string  `json:"coupon_code"`
+	Shipping_Method  string   `json:"shipping_method"`
+}
+
+// TaxLine is one tax component (e.g. CGST 9 %) charged on one order line
+type TaxLine struct {
+	Variant_ID primitive.ObjectID `json:"variant_id" bson:"variant_id"`
+	Tax_Class  string             `json:"tax_class" bson:"tax_class"`
+	Name       string             `json:"name" bson:"name"`
+	Rate       int64              `json:"rate" bson:"rate"` // Basis points, 1800 = 18 %
+	Taxable    Money              `json:"taxable" bson:"taxable"`
+	Amount     Money              `json:"amount" bson:"amount"`
+}
+
+// Shipping is the delivery method the customer picked and what it costs
+type Shipping struct {
+	Method        string `json:"method" bson:"method"`
+	Name          string `json:"name" bson:"name"`
+	Zone          string `json:"zone" bson:"zone"`
+	Delivery_Days string `json:"delivery_days" bson:"delivery_days"`
+	Weight_Grams  int64  `json:"weight_grams" bson:"weight_grams"`
+	Price         Money  `json:"price" bson:"price"`
 }
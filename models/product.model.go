@@ -1,21 +1,54 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 // primitive.ObjectID is a type defined in the MongoDB Go driver (go.mongodb.org/mongo-driver/bson/primitive). It is used to represent MongoDB's ObjectId, which is the default unique identifier for documents in a MongoDB collection.
 
 type Product struct {
-	Product_ID   primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	Product_Name *string            `json:"product_name" bson:"product_name"`
-	Price        *uint64            `json:"price" bson:"price"`
-	Rating       *uint64            `json:"rating" bson:"rating"`
-	Image        *string            `json:"image" bson:"image"`
+	Product_ID   primitive.ObjectID   `json:"_id,omitempty" bson:"_id,omitempty"`
+	Product_Name *string              `json:"product_name" validate:"required" bson:"product_name"`
+	Brand        *string              `json:"brand" bson:"brand"`
+	Category     *string              `json:"category" bson:"category"`
+	Tax_Class    string               `json:"tax_class" bson:"tax_class,omitempty"` // Picks the tax rules of the product, "standard" when empty
+	Price        Money                `json:"price" bson:"price"`                   // Lowest variant price, used as the "from" price in listings
+	Rating       float64              `json:"rating" bson:"rating"`                 // Average of the approved reviews, never set by the admin
+	Rating_Count int64                `json:"rating_count" bson:"rating_count"`     // Number of approved reviews
+	Rating_Total int64                `json:"-" bson:"rating_total"`                // Sum of the approved stars, kept so the average can be updated incrementally
+	Image        *string              `json:"image" bson:"image"`
+	Images       []primitive.ObjectID `json:"images" bson:"images"` // Uploaded images, served from /images/:imageId
+	Variants     []Variant            `json:"variants" validate:"required,min=1,dive" bson:"variants"`
+}
+
+// A Variant is the actual sellable unit of a product, e.g. "T-Shirt / Red / XL".
+// Every variant carries its own SKU, attribute set, price, stock and image ; the cart and the orders always point to a variant.
+type Variant struct {
+	Variant_ID      primitive.ObjectID `json:"variant_id,omitempty" bson:"variant_id,omitempty"`
+	SKU             *string            `json:"sku" validate:"required" bson:"sku"`
+	Attributes      map[string]string  `json:"attributes" bson:"attributes"`                               // {"colour": "red", "size": "XL"}
+	Price           Money              `json:"price" bson:"price"`                                         // In the store currency
+	Price_Overrides []Money            `json:"price_overrides,omitempty" bson:"price_overrides,omitempty"` // Fixed prices for other currencies, used instead of the converted price
+	Stock           *int64             `json:"stock" validate:"required,min=0" bson:"stock"`
+	Weight_Grams    int64              `json:"weight_grams" validate:"min=0" bson:"weight_grams,omitempty"` // Shipping weight of one piece
+	Image           *string            `json:"image" bson:"image"`
 }
 
+// ProductUser is a single line of the user's cart (and of an order) ; one line per variant.
 type ProductUser struct {
-	Product_ID   primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	Product_Name *string            `json:"product_name" bson:"product_name"`
-	Price        *int               `json:"price" bson:"price"`
-	Rating       *uint64            `json:"rating" bson:"rating"`
-	Image        *string            `json:"image" bson:"image"`
+	Product_ID      primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Variant_ID      primitive.ObjectID `json:"variant_id" bson:"variant_id"`
+	SKU             *string            `json:"sku" bson:"sku"`
+	Product_Name    *string            `json:"product_name" bson:"product_name"`
+	Attributes      map[string]string  `json:"attributes" bson:"attributes"`
+	Price           Money              `json:"price" bson:"price"` // Unit price of the variant
+	Price_Overrides []Money            `json:"-" bson:"price_overrides,omitempty"`
+	Quantity        int                `json:"quantity" bson:"quantity"`
+	Returned        int                `json:"returned,omitempty" bson:"returned,omitempty"` // Pieces of an order line in an open or finished return
+	Weight_Grams    int64              `json:"weight_grams" bson:"weight_grams,omitempty"`
+	Rating          float64            `json:"rating" bson:"rating"`
+	Image           *string            `json:"image" bson:"image"`
+	Priced_At       time.Time          `json:"priced_at" bson:"priced_at,omitempty"` // When the price was copied from the catalog, the newer price wins when two carts are merged
 }
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Promotion Types
+const (
+	PromotionBuyXGetY  = "buy_x_get_y" // Buy Buy_Quantity get Get_Quantity free, the cheapest units are the free ones
+	PromotionThreshold = "threshold"   // Percent_Off on the lines once they add up to Threshold
+	PromotionBundle    = "bundle"      // One of each Bundle_Product_IDs together for Bundle_Price
+)
+
+// A Promotion applies by itself to every cart which matches its rules, no code is needed.
+// Promotions run from the highest Priority to the lowest ; a promotion which is not Stackable is only used when nothing was applied before it
+// and nothing is applied after it.
+type Promotion struct {
+	Promotion_ID       primitive.ObjectID   `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name               string               `json:"name" validate:"required,min=3,max=100" bson:"name"`
+	Type               string               `json:"type" validate:"required,oneof=buy_x_get_y threshold bundle" bson:"type"`
+	Priority           int                  `json:"priority" bson:"priority"`
+	Stackable          bool                 `json:"stackable" bson:"stackable"`
+	Buy_Quantity       int64                `json:"buy_quantity,omitempty" validate:"min=0" bson:"buy_quantity,omitempty"`
+	Get_Quantity       int64                `json:"get_quantity,omitempty" validate:"min=0" bson:"get_quantity,omitempty"`
+	Threshold          Money                `json:"threshold" bson:"threshold"`
+	Percent_Off        int64                `json:"percent_off,omitempty" validate:"min=0,max=10000" bson:"percent_off,omitempty"` // Basis points, 1000 = 10 %
+	Bundle_Product_IDs []primitive.ObjectID `json:"bundle_product_ids,omitempty" bson:"bundle_product_ids,omitempty"`
+	Bundle_Price       Money                `json:"bundle_price" bson:"bundle_price"`
+	Product_IDs        []primitive.ObjectID `json:"product_ids,omitempty" bson:"product_ids,omitempty"` // Scope of buy_x_get_y and threshold, empty = every product
+	Categories         []string             `json:"categories,omitempty" bson:"categories,omitempty"`
+	Starts_At          *time.Time           `json:"starts_at,omitempty" bson:"starts_at,omitempty"`
+	Expires_At         *time.Time           `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	Active             bool                 `json:"active" bson:"active"`
+	Created_At         time.Time            `json:"created_at" bson:"created_at"`
+}
+
+// Adjustment Sources
+const (
+	AdjustmentPromotion = "promotion"
+	AdjustmentCoupon    = "coupon"
+)
+
+// An Adjustment explains one discount of the cart or the order :- which rule gave it, on which line and how much.
+// Adjustments of a coupon belong to the whole order, so their Variant_ID is empty.
+type Adjustment struct {
+	Source       string             `json:"source" bson:"source"`
+	Promotion_ID primitive.ObjectID `json:"promotion_id,omitempty" bson:"promotion_id,omitempty"`
+	Code         string             `json:"code,omitempty" bson:"code,omitempty"`
+	Name         string             `json:"name" bson:"name"`
+	Variant_ID   primitive.ObjectID `json:"variant_id,omitempty" bson:"variant_id,omitempty"`
+	Amount       Money              `json:"amount" bson:"amount"`
+	Description  string             `json:"description" bson:"description"`
+}
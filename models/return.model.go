@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Steps of a return :- requested -> approved -> received (stock back on the shelf) -> refunded, or requested -> rejected
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnReceived  = "received"
+	ReturnRefunded  = "refunded"
+)
+
+// Return (RMA) is a request of the customer to send back some lines of one order
+type Return struct {
+	Return_ID     primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Order_ID      primitive.ObjectID `json:"order_id" bson:"order_id"`
+	User_ID       string             `json:"user_id" bson:"user_id"`
+	Lines         []ReturnLine       `json:"lines" bson:"lines"`
+	Reason        string             `json:"reason" bson:"reason"`
+	Status        string             `json:"status" bson:"status"`
+	Refund_Amount Money              `json:"refund_amount" bson:"refund_amount"` // What the returned lines were paid, in the currency of the order
+	Refunded      Money              `json:"refunded" bson:"refunded"`           // What was paid back, the admin can refund less for a damaged item
+	Admin_Note    string             `json:"admin_note,omitempty" bson:"admin_note,omitempty"`
+	Created_At    time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At    time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type ReturnLine struct {
+	Product_ID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Variant_ID primitive.ObjectID `json:"variant_id" bson:"variant_id" validate:"required"`
+	Quantity   int                `json:"quantity" bson:"quantity" validate:"required,min=1"`
+	Reason     string             `json:"reason,omitempty" bson:"reason,omitempty" validate:"max=500"`
+	Refund     Money              `json:"refund" bson:"refund"`
+}
+
+// ReturnRequest is the body the customer sends to return lines of an order
+type ReturnRequest struct {
+	Order_ID primitive.ObjectID `json:"order_id" validate:"required"`
+	Reason   string             `json:"reason" validate:"required,min=3,max=500"`
+	Lines    []ReturnLine       `json:"lines" validate:"required,min=1,dive"`
+}
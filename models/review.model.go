@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Review Status :- every review waits in pending until the admin approves or rejects it, only approved reviews count in the product rating
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+type Review struct {
+	Review_ID  primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Product_ID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	User_ID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	User_Name  *string            `json:"user_name" bson:"user_name"`
+	Rating     int                `json:"rating" validate:"required,min=1,max=5" bson:"rating"`
+	Text       *string            `json:"text" validate:"required,min=1,max=2000" bson:"text"`
+	Status     string             `json:"status" bson:"status"`
+	Created_At time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -14,22 +14,33 @@ import (
 // If both models are in the same package (e.g., models), you can directly reference Product_Model from user_model.
 
 type User struct {
-	ID              primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	First_Name      *string            `json:"first_name" validate:"required,min=4,max=30" bson:"first_name"`
-	Last_Name       *string            `json:"last_name" validate:"required,min=4,max=30" bson:"last_name"`
-	Password        *string            `json:"password" validate:"required,min=6,max=35" bson:"password"`
-	Email           *string            `json:"email" validate:"required,email" bson:"email"`
-	Phone           *string            `json:"phone" validate:"required" bson:"phone"`
-	Token           *string            `json:"token" bson:"token"`
-	Refresh_Token   *string            `json:"refresh_token" bson:"refresh_token"`
-	Created_At      time.Time          `json:"created_at" bson:"created_at"`
-	Updated_At      time.Time          `json:"updated_at" bson:"updated_at"`
-	User_ID         *string            `json:"user_id" bson:"user_id"`
-	User_Cart       []ProductUser      `json:"user_cart" bson:"user_cart"`
-	Address_Details []Address          `json:"address" bson:"address"`
-	Order_Status    []Order            `json:"orders" bson:"orders"`
+	ID               primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	First_Name       *string            `json:"first_name" validate:"required,min=4,max=30" bson:"first_name"`
+	Last_Name        *string            `json:"last_name" validate:"required,min=4,max=30" bson:"last_name"`
+	Password         *string            `json:"password" validate:"required,min=6,max=35" bson:"password"`
+	Email            *string            `json:"email" validate:"required,email" bson:"email"`
+	Phone            *string            `json:"phone" validate:"required" bson:"phone"`
+	Locale           *string            `json:"locale,omitempty" validate:"omitempty,bcp47_language_tag" bson:"locale,omitempty"` // Language of the emails and sms, e.g. "en" or "hi" ; the Accept-Language of the sign up when it is not given
+	Token            *string            `json:"token" bson:"token"`
+	Refresh_Token    *string            `json:"refresh_token" bson:"refresh_token"`
+	Created_At       time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At       time.Time          `json:"updated_at" bson:"updated_at"`
+	User_ID          *string            `json:"user_id" bson:"user_id"`
+	User_Cart        []ProductUser      `json:"user_cart" bson:"user_cart"`
+	Cart_Coupon      *string            `json:"cart_coupon" bson:"cart_coupon,omitempty"` // Coupon code applied to the cart, priced again at checkout
+	Address_Details  []Address          `json:"address" bson:"address"`
+	Order_Status     []Order            `json:"orders" bson:"orders"`
+	Cart_Updated_At  *time.Time         `json:"cart_updated_at,omitempty" bson:"cart_updated_at,omitempty"` // When the cart was changed last, a cart left alone for long gets a reminder
+	Cart_Reminded    *time.Time         `json:"-" bson:"cart_reminded,omitempty"`                           // Cart_Updated_At of the cart the last reminder was about
+	Guest            bool               `json:"-" bson:"guest,omitempty"`                                   // A cart of a visitor without an account, reached only with its signed cart token ; never read from a request
+	Guest_Email      *string            `json:"-" bson:"guest_email,omitempty"`                             // Email given at the guest checkout, kept out of Email so sign up and login never find a guest
+	Guest_Expires_At *time.Time         `json:"-" bson:"guest_expires_at,omitempty"`                        // A guest cart nobody touched until then is deleted by a TTL index, a guest with orders never expires
+	Role             string             `json:"-" bson:"role,omitempty"`                                    // RoleAdmin for the shop staff, empty for a customer ; never read from a request, only the admin cli command sets it
 }
 
+// RoleAdmin may use the /admin api's
+const RoleAdmin = "admin"
+
 // ---- Reason to Use *string (Pointer String)
 
 // Using `*string` (a pointer to a string) instead of `string` in the struct fields serves specific purposes related to flexibility, optionality, and memory efficiency. Below are the reasons and scenarios where `*string` is preferred over `string`:
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Events of the wishlist notifications
+const (
+	WishlistPriceDrop   = "wishlist.price_drop"
+	WishlistBackInStock = "wishlist.back_in_stock"
+)
+
+// Wishlist is a named list of variants a user wants to buy later ; with a share token anybody with the link can look at it
+type Wishlist struct {
+	Wishlist_ID primitive.ObjectID `json:"_id" bson:"_id"`
+	User_ID     string             `json:"user_id" bson:"user_id"`
+	Name        string             `json:"name" bson:"name"`
+	Items       []WishlistItem     `json:"items" bson:"items"`
+	Share_Token *string            `json:"share_token,omitempty" bson:"share_token,omitempty"`
+	Created_At  time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At  time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type WishlistItem struct {
+	Product_ID      primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Variant_ID      primitive.ObjectID `json:"variant_id" bson:"variant_id"`
+	SKU             *string            `json:"sku" bson:"sku"`
+	Product_Name    *string            `json:"product_name" bson:"product_name"`
+	Attributes      map[string]string  `json:"attributes" bson:"attributes"`
+	Image           *string            `json:"image" bson:"image"`
+	Price           Money              `json:"price" bson:"price"` // Price the user last heard of, a lower catalog price is a price drop
+	Price_Overrides []Money            `json:"-" bson:"price_overrides,omitempty"`
+	In_Stock        bool               `json:"in_stock" bson:"in_stock"` // Stock the user last heard of, stock coming back after false is a restock
+	Added_At        time.Time          `json:"added_at" bson:"added_at"`
+}
+
+// WishlistRequest is the body to create or rename a wishlist
+type WishlistRequest struct {
+	Name string `json:"name" validate:"required,min=1,max=50"`
+}
+
+// WishlistAlert is a wishlisted variant which got cheaper or came back in stock
+type WishlistAlert struct {
+	Event         string
+	User_ID       string
+	Wishlist_ID   primitive.ObjectID
+	Wishlist_Name string
+	Item          WishlistItem // With the new price and stock
+	Old_Price     Money
+}
@@ -0,0 +1,244 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownChannel = errors.New("unknown notification channel")
+	ErrNoSMTPServer   = errors.New("the email channel needs SMTP_ADDR and SMTP_FROM")
+)
+
+// Channel sends the rendered messages one way :- email, sms, a file ...
+type Channel interface {
+	Name() string
+	SMS() bool // An sms channel gets the short "sms" template and the phone number, the others the email templates and the email
+	Send(ctx context.Context, message Message) error
+}
+
+// ChannelConfig has the settings of every channel, each channel only reads its own
+type ChannelConfig struct {
+	SMTP_Addr     string // host:port, e.g. localhost:1025 for a local test server like MailHog
+	SMTP_From     string
+	SMTP_Username string // Empty for a server without login
+	SMTP_Password string
+	File          string
+}
+
+// NewChannels makes the channels of a comma separated list like "email,sms,file"
+func NewChannels(names string, config ChannelConfig) ([]Channel, error) {
+	channels := make([]Channel, 0)
+
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+			continue
+		case "email":
+			if config.SMTP_Addr == "" || config.SMTP_From == "" {
+				return nil, ErrNoSMTPServer
+			}
+			channels = append(channels, NewSMTPChannel(config.SMTP_Addr, config.SMTP_From, config.SMTP_Username, config.SMTP_Password))
+		case "sms":
+			channels = append(channels, SMSChannel{})
+		case "file":
+			if config.File == "" {
+				return nil, ErrNoNotifyFile
+			}
+			channels = append(channels, NewFileChannel(config.File))
+		default:
+			return nil, fmt.Errorf("%w :- %s", ErrUnknownChannel, name)
+		}
+	}
+
+	return channels, nil
+}
+
+// SMTPChannel sends the messages as emails with a text and (when the event has one) an html part
+type SMTPChannel struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPChannel(addr string, from string, username string, password string) *SMTPChannel {
+	channel := &SMTPChannel{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		channel.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return channel
+}
+
+func (s *SMTPChannel) Name() string { return "email" }
+
+func (s *SMTPChannel) SMS() bool { return false }
+
+func (s *SMTPChannel) Send(ctx context.Context, message Message) error {
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+
+	body, err := mimeMessage(from, to, message)
+	if err != nil {
+		return err
+	}
+
+	// net/smtp does not take a context, so the connection is dialed here and gets the deadline of the context
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(s.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.auth != nil {
+		if err = client.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to.Address); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(body); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// mimeMessage builds the email :- the headers and a text part, with the html part as an alternative when there is one
+func mimeMessage(from *mail.Address, to *mail.Address, message Message) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("From: " + from.String() + "\r\n")
+	buffer.WriteString("To: " + to.String() + "\r\n")
+	buffer.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	buffer.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+
+	if message.HTML == "" {
+		buffer.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		buffer.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buffer, message.Text); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buffer)
+	buffer.WriteString("Content-Type: multipart/alternative; boundary=" + parts.Boundary() + "\r\n\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", message.Text},
+		{"text/html; charset=UTF-8", message.HTML},
+	} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		writer, err := parts.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(writer, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	writer := quotedprintable.NewWriter(w)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// SMSChannel is a stand in until an sms gateway is picked, it only writes the sms to the log
+type SMSChannel struct{}
+
+func (SMSChannel) Name() string { return "sms" }
+
+func (SMSChannel) SMS() bool { return true }
+
+func (SMSChannel) Send(ctx context.Context, message Message) error {
+	log.Println("SMS to " + message.To + " :- " + message.Text)
+	return nil
+}
+
+// FileChannel appends every message as one json line to a file, to read the emails locally without a mail server
+type FileChannel struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileChannel(path string) *FileChannel {
+	return &FileChannel{path: path}
+}
+
+func (f *FileChannel) Name() string { return "file" }
+
+func (f *FileChannel) SMS() bool { return false }
+
+func (f *FileChannel) Send(ctx context.Context, message Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return appendJSONLine(f.path, struct {
+		Message
+		Sent_At time.Time `json:"sent_at"`
+	}{message, time.Now()})
+}
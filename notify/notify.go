@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownNotifier = errors.New("unknown notifier")
+	ErrNoNotifyFile    = errors.New("the file notifier needs a file path")
+)
+
+// Notification is one message for one user, Event says what happened and Data has the details the message is written from
+type Notification struct {
+	Event      string         `json:"event"`
+	User_ID    string         `json:"user_id"`
+	To         *Recipient     `json:"to,omitempty"` // Looked up by User_ID when it is not given
+	Data       map[string]any `json:"data"`
+	Created_At time.Time      `json:"created_at"`
+}
+
+// Recipient is where and in which language the messages of a notification go
+type Recipient struct {
+	Name   string `json:"name"`
+	Email  string `json:"email,omitempty"`
+	Phone  string `json:"phone,omitempty"`
+	Locale string `json:"locale,omitempty"`
+}
+
+// Notifier delivers the notifications ; the service only talks to this interface, the Service of this package sends them by email, sms, ...
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// New picks the notifier by the NOTIFIER setting, filePath is only used by the "file" notifier
+func New(kind string, filePath string) (Notifier, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "file":
+		if filePath == "" {
+			return nil, ErrNoNotifyFile
+		}
+		return NewFileNotifier(filePath), nil
+	}
+	return nil, ErrUnknownNotifier
+}
+
+// LogNotifier only writes the notifications to the log, enough for local development
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.Created_At.IsZero() {
+		notification.Created_At = time.Now()
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Notification :- ", string(payload))
+	return nil
+}
+
+// FileNotifier appends every notification as one json line to a file, so a developer can read what the users would get
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex // One line is written at a time, the lines of two notifications never mix
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (f *FileNotifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.Created_At.IsZero() {
+		notification.Created_At = time.Now()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return appendJSONLine(f.path, notification)
+}
+
+// appendJSONLine writes v as one json line at the end of the file, the caller makes sure only one line is written at a time
+func appendJSONLine(path string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(payload, '\n'))
+	return err
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"errors"
+)
+
+// Message is a notification rendered for one channel, ready to be sent
+type Message struct {
+	Channel string `json:"channel"`
+	Event   string `json:"event"`
+	Locale  string `json:"locale"` // The locale the templates came from
+	To      string `json:"to"`     // Email or phone number
+	Subject string `json:"subject,omitempty"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// Service renders the notifications with the templates and sends them through the channels
+type Service struct {
+	templates *Templates
+	channels  map[string]Channel
+	order     []string // Names of the channels in the order they were given
+}
+
+func NewService(templates *Templates, channels []Channel) *Service {
+	service := &Service{templates: templates, channels: make(map[string]Channel, len(channels))}
+	for _, channel := range channels {
+		service.channels[channel.Name()] = channel
+		service.order = append(service.order, channel.Name())
+	}
+	return service
+}
+
+// Messages renders the notification for every channel which has an address of the recipient and a template of the event.
+// No message means nobody is told, e.g. an event without templates or a user without an email on an email only setup.
+func (s *Service) Messages(notification Notification) ([]Message, error) {
+	messages := make([]Message, 0, len(s.order))
+	if notification.To == nil || s.templates == nil {
+		return messages, nil
+	}
+
+	templates, locale := s.templates.lookup(notification.Event, notification.To.Locale)
+	if templates == nil {
+		return messages, nil
+	}
+
+	data := templateData{Event: notification.Event, To: *notification.To, Data: notification.Data}
+	var errs []error
+
+	for _, name := range s.order {
+		channel := s.channels[name]
+		message := Message{Channel: name, Event: notification.Event, Locale: locale, To: notification.To.Email}
+
+		var ok bool
+		var err error
+		if channel.SMS() {
+			message.To = notification.To.Phone
+			message.Text, ok, err = templates.render("sms", data)
+		} else {
+			message.Subject, ok, err = templates.render("subject", data)
+			if ok && err == nil {
+				message.Text, ok, err = templates.render("text", data)
+			}
+			if ok && err == nil {
+				message.HTML, _, err = templates.render("html", data)
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok || message.To == "" {
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, errors.Join(errs...)
+}
+
+// Send delivers one message through the channel it was rendered for
+func (s *Service) Send(ctx context.Context, message Message) error {
+	channel, ok := s.channels[message.Channel]
+	if !ok {
+		return ErrUnknownChannel
+	}
+	return channel.Send(ctx, message)
+}
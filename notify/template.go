@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+var ErrNoTemplates = errors.New("no notification templates found")
+
+// Templates are the messages of every event in every locale, one folder per locale and two files per event :-
+//
+//	<dir>/en/order.placed.txt   {{define "subject"}}, {{define "text"}} and {{define "sms"}} with text/template
+//	<dir>/en/order.placed.html  {{define "html"}} with html/template, which escapes the data for html
+//
+// A locale only needs the events it translates, the others come from the default locale.
+type Templates struct {
+	defaultLocale string
+	locales       map[string]map[string]*eventTemplates // locale -> event -> its templates
+}
+
+type eventTemplates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// templateData is what a template sees :- {{.To.Name}}, {{.Data.order_id}} ...
+type templateData struct {
+	Event string
+	To    Recipient
+	Data  map[string]any
+}
+
+// Functions the templates can use next to the built in ones, e.g. {{date .Data.ordered_at}}
+var templateFuncs = map[string]any{
+	"date": func(t time.Time) string { return t.Format("02 Jan 2006") },
+}
+
+// LoadTemplates reads every locale folder of dir, a template which does not parse stops the loading
+func LoadTemplates(dir string, defaultLocale string) (*Templates, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if defaultLocale == "" {
+		defaultLocale = "en"
+	}
+
+	templates := &Templates{defaultLocale: normalizeLocale(defaultLocale), locales: make(map[string]map[string]*eventTemplates)}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		locale := normalizeLocale(entry.Name())
+		files, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		events := make(map[string]*eventTemplates)
+		for _, file := range files {
+			name := file.Name()
+			path := filepath.Join(dir, entry.Name(), name)
+			event := strings.TrimSuffix(strings.TrimSuffix(name, ".txt"), ".html")
+
+			if events[event] == nil {
+				events[event] = &eventTemplates{}
+			}
+
+			switch filepath.Ext(name) {
+			case ".txt":
+				events[event].text, err = texttemplate.New(name).Funcs(templateFuncs).ParseFiles(path)
+			case ".html":
+				events[event].html, err = htmltemplate.New(name).Funcs(templateFuncs).ParseFiles(path)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		templates.locales[locale] = events
+	}
+
+	if len(templates.locales) == 0 {
+		return nil, ErrNoTemplates
+	}
+
+	return templates, nil
+}
+
+// lookup picks the locale which has the event :- the locale itself ("en-gb"), its language ("en") and then the default locale.
+// All the parts of one message come from the same locale, a message never mixes two languages.
+func (t *Templates) lookup(event string, locale string) (*eventTemplates, string) {
+	locale = normalizeLocale(locale)
+	language, _, _ := strings.Cut(locale, "-")
+
+	for _, candidate := range []string{locale, language, t.defaultLocale} {
+		if event, ok := t.locales[candidate][event]; ok {
+			return event, candidate
+		}
+	}
+	return nil, ""
+}
+
+// render runs one part ("subject", "text", "sms" or "html") of the event template ; false when the locale has no such part
+func (e *eventTemplates) render(part string, data templateData) (string, bool, error) {
+	var buffer bytes.Buffer
+
+	if part == "html" {
+		if e.html == nil || e.html.Lookup(part) == nil {
+			return "", false, nil
+		}
+		if err := e.html.ExecuteTemplate(&buffer, part, data); err != nil {
+			return "", false, err
+		}
+		return strings.TrimSpace(buffer.String()), true, nil
+	}
+
+	if e.text == nil || e.text.Lookup(part) == nil {
+		return "", false, nil
+	}
+	if err := e.text.ExecuteTemplate(&buffer, part, data); err != nil {
+		return "", false, err
+	}
+
+	text := strings.TrimSpace(buffer.String())
+	if part == "subject" || part == "sms" {
+		// One line only, a line break in a subject would end the mail header
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	return text, true, nil
+}
+
+// "en_GB" and "EN-gb" are the same locale
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
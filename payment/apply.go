@@ -0,0 +1,49 @@
+package payment
+
+import "ecommerce/models"
+
+// ApplyIntent works out what an intent from the gateway does to the order it belongs to.
+// It returns the order with the new payment and order status, and false when the intent changes nothing :-
+// the same event sent twice, or an event which arrives after a later one (the gateway does not promise the order).
+func ApplyIntent(order models.Order, intent Intent) (models.Order, bool) {
+	current := order.Payment_Method.Status
+
+	if current == intent.Status && current != StatusPartiallyRefunded {
+		return order, false
+	}
+	// Two partial refunds have the same status, only the one which refunds more is newer
+	if current == StatusPartiallyRefunded && intent.Status == current && intent.Refunded.Cmp(order.Payment_Method.Refunded) <= 0 {
+		return order, false
+	}
+	if !Advances(current, intent.Status) {
+		return order, false
+	}
+
+	order.Status = OrderStatusFor(intent.Status, order.Status)
+	order.Payment_Method.Status = intent.Status
+	order.Payment_Method.Captured = intent.Captured
+	order.Payment_Method.Refunded = intent.Refunded
+	order.Refunded = intent.Refunded // Everything of a digital order is refunded through the gateway
+
+	return order, true
+}
+
+// OrderStatusFor is the order status which goes with a payment status
+func OrderStatusFor(paymentStatus string, current string) string {
+	switch paymentStatus {
+	case StatusCaptured:
+		if current == models.OrderShipped {
+			return current // A late capture webhook does not take the order back from the carrier
+		}
+		return models.OrderPaid
+	case StatusFailed:
+		return models.OrderPaymentFailed
+	case StatusVoided:
+		return models.OrderCancelled
+	case StatusPartiallyRefunded:
+		return models.OrderPartiallyRefunded
+	case StatusRefunded:
+		return models.OrderRefunded
+	}
+	return current
+}
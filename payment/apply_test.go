@@ -0,0 +1,91 @@
+package payment
+
+import (
+	"ecommerce/models"
+	"testing"
+)
+
+func inr(amount int64) models.Money {
+	return models.NewMoney(amount, "INR")
+}
+
+func intent(status string, captured int64, refunded int64) Intent {
+	return Intent{ID: "pi_1", Status: status, Amount: inr(100000), Captured: inr(captured), Refunded: inr(refunded)}
+}
+
+func pendingOrder() models.Order {
+	return models.Order{
+		Status:         models.OrderPendingPayment,
+		Payment_Method: models.Payment{Digital: true, Intent_ID: "pi_1", Status: StatusRequiresPayment, Captured: inr(0), Refunded: inr(0)},
+	}
+}
+
+// apply runs the intents one after the other like the webhooks would, and tells how many of them changed the order
+func apply(order models.Order, intents ...Intent) (models.Order, int) {
+	changes := 0
+	for _, intent := range intents {
+		var changed bool
+		order, changed = ApplyIntent(order, intent)
+		if changed {
+			changes++
+		}
+	}
+	return order, changes
+}
+
+func TestApplyIntent(t *testing.T) {
+	authorized := intent(StatusAuthorized, 0, 0)
+	captured := intent(StatusCaptured, 100000, 0)
+	refundedSome := intent(StatusPartiallyRefunded, 100000, 20000)
+	refundedMore := intent(StatusPartiallyRefunded, 100000, 50000)
+	refunded := intent(StatusRefunded, 100000, 100000)
+	failed := intent(StatusFailed, 0, 0)
+	voided := intent(StatusVoided, 0, 0)
+
+	tests := []struct {
+		name         string
+		intents      []Intent
+		wantStatus   string
+		wantPayment  string
+		wantRefunded int64
+		wantChanges  int
+	}{
+		{"in order", []Intent{authorized, captured}, models.OrderPaid, StatusCaptured, 0, 2},
+		{"same event twice", []Intent{authorized, captured, captured}, models.OrderPaid, StatusCaptured, 0, 2},
+		{"capture before the authorization", []Intent{captured, authorized}, models.OrderPaid, StatusCaptured, 0, 1},
+		{"refund before the capture", []Intent{refundedSome, captured}, models.OrderPartiallyRefunded, StatusPartiallyRefunded, 20000, 1},
+		{"partial refunds in order", []Intent{captured, refundedSome, refundedMore}, models.OrderPartiallyRefunded, StatusPartiallyRefunded, 50000, 3},
+		{"older partial refund arrives late", []Intent{captured, refundedMore, refundedSome}, models.OrderPartiallyRefunded, StatusPartiallyRefunded, 50000, 2},
+		{"same partial refund twice", []Intent{captured, refundedSome, refundedSome}, models.OrderPartiallyRefunded, StatusPartiallyRefunded, 20000, 2},
+		{"partial refund after the full refund", []Intent{captured, refunded, refundedMore}, models.OrderRefunded, StatusRefunded, 100000, 2},
+		{"failed", []Intent{failed}, models.OrderPaymentFailed, StatusFailed, 0, 1},
+		{"capture after the failure", []Intent{failed, captured}, models.OrderPaymentFailed, StatusFailed, 0, 1},
+		{"voided", []Intent{authorized, voided}, models.OrderCancelled, StatusVoided, 0, 2},
+		{"authorization after the void", []Intent{voided, authorized}, models.OrderCancelled, StatusVoided, 0, 1},
+	}
+
+	for _, test := range tests {
+		order, changes := apply(pendingOrder(), test.intents...)
+
+		if order.Status != test.wantStatus || order.Payment_Method.Status != test.wantPayment {
+			t.Errorf("%s: order %s with payment %s, want %s with %s", test.name, order.Status, order.Payment_Method.Status, test.wantStatus, test.wantPayment)
+		}
+		if order.Payment_Method.Refunded.Amount != test.wantRefunded || order.Refunded != order.Payment_Method.Refunded {
+			t.Errorf("%s: refunded %v (order %v), want %d", test.name, order.Payment_Method.Refunded, order.Refunded, test.wantRefunded)
+		}
+		if changes != test.wantChanges {
+			t.Errorf("%s: %d changes, want %d", test.name, changes, test.wantChanges)
+		}
+	}
+}
+
+func TestLateCaptureKeepsTheOrderShipped(t *testing.T) {
+	order := pendingOrder()
+	order.Status = models.OrderShipped
+	order.Payment_Method.Status = StatusAuthorized
+
+	order, changed := ApplyIntent(order, intent(StatusCaptured, 100000, 0))
+	if !changed || order.Status != models.OrderShipped || order.Payment_Method.Status != StatusCaptured {
+		t.Errorf("order %s with payment %s (changed %v), want shipped with captured", order.Status, order.Payment_Method.Status, changed)
+	}
+}
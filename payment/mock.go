@@ -0,0 +1,173 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"ecommerce/models"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// MockProvider is a payment gateway which lives in memory, for local runs and tests.
+// Nothing is charged :- Simulate plays the part of the customer paying and gives back the webhook the gateway would send.
+type MockProvider struct {
+	secret  string
+	mu      sync.Mutex
+	intents map[string]Intent
+}
+
+// NewMockProvider signs its webhooks with the secret ; an empty secret gets a random one, then only Simulate can make webhooks it accepts
+func NewMockProvider(webhookSecret string) *MockProvider {
+	if webhookSecret == "" {
+		webhookSecret = randomId()
+	}
+	return &MockProvider{secret: webhookSecret, intents: make(map[string]Intent)}
+}
+
+func (m *MockProvider) Name() string {
+	return "mock"
+}
+
+func (m *MockProvider) CreateIntent(ctx context.Context, orderId string, amount models.Money) (Intent, error) {
+	if amount.Amount <= 0 {
+		return Intent{}, ErrInvalidAmount
+	}
+
+	intent := Intent{
+		ID:            "pi_mock_" + randomId(),
+		Order_ID:      orderId,
+		Status:        StatusRequiresPayment,
+		Amount:        amount,
+		Captured:      models.NewMoney(0, amount.Currency),
+		Refunded:      models.NewMoney(0, amount.Currency),
+		Client_Secret: "secret_mock_" + randomId(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.intents[intent.ID] = intent
+
+	return intent, nil
+}
+
+func (m *MockProvider) Capture(ctx context.Context, intentId string) (Intent, error) {
+	return m.change(intentId, func(intent *Intent) error {
+		if intent.Status != StatusAuthorized {
+			return ErrInvalidTransition
+		}
+		intent.Status = StatusCaptured
+		intent.Captured = intent.Amount
+		return nil
+	})
+}
+
+func (m *MockProvider) Refund(ctx context.Context, intentId string, amount models.Money) (Intent, error) {
+	return m.change(intentId, func(intent *Intent) error {
+		if intent.Status != StatusCaptured && intent.Status != StatusPartiallyRefunded {
+			return ErrInvalidTransition
+		}
+		if amount.Amount <= 0 || amount.Currency != intent.Captured.Currency || intent.Refunded.Add(amount).Cmp(intent.Captured) > 0 {
+			return ErrInvalidAmount
+		}
+
+		intent.Refunded = intent.Refunded.Add(amount)
+		intent.Status = StatusPartiallyRefunded
+		if intent.Refunded.Cmp(intent.Captured) == 0 {
+			intent.Status = StatusRefunded
+		}
+		return nil
+	})
+}
+
+func (m *MockProvider) Void(ctx context.Context, intentId string) (Intent, error) {
+	return m.change(intentId, func(intent *Intent) error {
+		if intent.Status != StatusRequiresPayment && intent.Status != StatusAuthorized {
+			return ErrInvalidTransition
+		}
+		intent.Status = StatusVoided
+		return nil
+	})
+}
+
+func (m *MockProvider) GetIntent(ctx context.Context, intentId string) (Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, ok := m.intents[intentId]
+	if !ok {
+		return Intent{}, ErrCantFindIntent
+	}
+
+	intent.Client_Secret = ""
+	return intent, nil
+}
+
+func (m *MockProvider) ParseWebhook(payload []byte, signature string) (Event, error) {
+	if err := VerifySignature(m.secret, payload, signature, time.Now()); err != nil {
+		return Event{}, err
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+// Simulate pays (or fails to pay) an intent like the customer would at a real gateway,
+// and returns the signed webhook the gateway sends about it.
+func (m *MockProvider) Simulate(intentId string, succeed bool) ([]byte, string, error) {
+	eventType := EventAuthorized
+	intent, err := m.change(intentId, func(intent *Intent) error {
+		if intent.Status != StatusRequiresPayment {
+			return ErrInvalidTransition
+		}
+		intent.Status = StatusAuthorized
+		if !succeed {
+			intent.Status = StatusFailed
+			eventType = EventFailed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	intent.Client_Secret = ""
+	event := Event{ID: "evt_mock_" + randomId(), Type: eventType, Intent: intent, Created_At: time.Now()}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return payload, Sign(m.secret, payload, time.Now()), nil
+}
+
+// change runs one state change of an intent under the lock
+func (m *MockProvider) change(intentId string, apply func(intent *Intent) error) (Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, ok := m.intents[intentId]
+	if !ok {
+		return Intent{}, ErrCantFindIntent
+	}
+
+	if err := apply(&intent); err != nil {
+		return Intent{}, err
+	}
+
+	m.intents[intentId] = intent
+	intent.Client_Secret = ""
+	return intent, nil
+}
+
+func randomId() string {
+	bytes := make([]byte, 12)
+	_, _ = rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,97 @@
+// Package payment talks to the payment gateway. The checkout only knows the Provider interface,
+// so a real gateway can be plugged in next to the local mock provider without touching the orders.
+package payment
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPaymentUnavailable = errors.New("online payment is not available right now")
+	ErrCantFindIntent     = errors.New("can't find this payment")
+	ErrInvalidTransition  = errors.New("this payment can't do that in its current state")
+	ErrInvalidAmount      = errors.New("invalid payment amount")
+	ErrInvalidSignature   = errors.New("invalid webhook signature")
+)
+
+// Status of a payment intent at the gateway
+const (
+	StatusRequiresPayment   = "requires_payment" // Created, the customer has not paid yet
+	StatusAuthorized        = "authorized"       // The money is held, it still has to be captured
+	StatusCaptured          = "captured"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+	StatusVoided            = "voided" // The hold was released before the capture
+	StatusFailed            = "failed"
+)
+
+// Webhook events the gateway sends when a payment changes
+const (
+	EventAuthorized = "payment.authorized"
+	EventCaptured   = "payment.captured"
+	EventFailed     = "payment.failed"
+	EventVoided     = "payment.voided"
+	EventRefunded   = "payment.refunded"
+)
+
+// Intent is one payment of one order at the gateway
+type Intent struct {
+	ID            string       `json:"id"`
+	Order_ID      string       `json:"order_id"`
+	Status        string       `json:"status"`
+	Amount        models.Money `json:"amount"`
+	Captured      models.Money `json:"captured"`
+	Refunded      models.Money `json:"refunded"`
+	Client_Secret string       `json:"client_secret,omitempty"` // Handed to the customer's app to pay, never stored with the order
+}
+
+// Event is the body of a webhook
+type Event struct {
+	ID         string    `json:"id"` // The gateway can send the same event more than once, the id makes the handling idempotent
+	Type       string    `json:"type"`
+	Intent     Intent    `json:"intent"`
+	Created_At time.Time `json:"created_at"`
+}
+
+// Provider is a payment gateway ; every call which changes a payment returns the intent as the gateway has it afterwards
+type Provider interface {
+	Name() string
+	CreateIntent(ctx context.Context, orderId string, amount models.Money) (Intent, error)
+	Capture(ctx context.Context, intentId string) (Intent, error)
+	Refund(ctx context.Context, intentId string, amount models.Money) (Intent, error)
+	Void(ctx context.Context, intentId string) (Intent, error)
+
+	// GetIntent reads the intent as the gateway has it now, e.g. when its webhook never arrived
+	GetIntent(ctx context.Context, intentId string) (Intent, error)
+
+	// ParseWebhook checks the signature header of a webhook and decodes its event
+	ParseWebhook(payload []byte, signature string) (Event, error)
+}
+
+// The order of the statuses a payment goes through, a webhook never moves a payment back (the gateway does not promise to send them in order)
+var statusStep = map[string]int{
+	StatusRequiresPayment:   0,
+	StatusAuthorized:        1,
+	StatusFailed:            2,
+	StatusVoided:            2,
+	StatusCaptured:          2,
+	StatusPartiallyRefunded: 3,
+	StatusRefunded:          4,
+}
+
+// Advances tells if a payment in the current status can take the next one ; a partial refund can follow another partial refund
+func Advances(current string, next string) bool {
+	if current == "" {
+		return true
+	}
+	if current == StatusPartiallyRefunded && next == StatusPartiallyRefunded {
+		return true
+	}
+	if current == StatusFailed || current == StatusVoided {
+		return false
+	}
+	return statusStep[next] > statusStep[current]
+}
@@ -0,0 +1,44 @@
+package payment
+
+import "testing"
+
+func TestAdvances(t *testing.T) {
+	tests := []struct {
+		current string
+		next    string
+		want    bool
+	}{
+		{"", StatusRequiresPayment, true}, // An order saved before the payment status existed
+		{StatusRequiresPayment, StatusAuthorized, true},
+		{StatusRequiresPayment, StatusCaptured, true},
+		{StatusRequiresPayment, StatusFailed, true},
+		{StatusAuthorized, StatusCaptured, true},
+		{StatusAuthorized, StatusVoided, true},
+		{StatusCaptured, StatusPartiallyRefunded, true},
+		{StatusCaptured, StatusRefunded, true},
+		{StatusPartiallyRefunded, StatusPartiallyRefunded, true},
+		{StatusPartiallyRefunded, StatusRefunded, true},
+
+		// Late webhooks never move a payment back
+		{StatusAuthorized, StatusRequiresPayment, false},
+		{StatusCaptured, StatusAuthorized, false},
+		{StatusRefunded, StatusCaptured, false},
+		{StatusRefunded, StatusPartiallyRefunded, false},
+		{StatusPartiallyRefunded, StatusCaptured, false},
+		{StatusCaptured, StatusCaptured, false},
+
+		// A failed or voided payment is over
+		{StatusFailed, StatusAuthorized, false},
+		{StatusFailed, StatusCaptured, false},
+		{StatusVoided, StatusCaptured, false},
+		{StatusVoided, StatusRefunded, false},
+		{StatusCaptured, StatusFailed, false},
+		{StatusCaptured, StatusVoided, false},
+	}
+
+	for _, test := range tests {
+		if got := Advances(test.current, test.next); got != test.want {
+			t.Errorf("Advances(%q, %q) = %v, want %v", test.current, test.next, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureTolerance is how old a webhook may be, an older one is refused so a captured request can not be replayed later
+const SignatureTolerance = 5 * time.Minute
+
+// Sign makes the signature header of a webhook :- "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<payload>">"
+func Sign(secret string, payload []byte, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + signature(secret, timestamp, payload)
+}
+
+// VerifySignature checks the signature header against the payload and the time it was signed at
+func VerifySignature(secret string, payload []byte, header string, now time.Time) error {
+	if secret == "" {
+		return ErrInvalidSignature
+	}
+
+	var timestamp, signed string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signed = value
+		}
+	}
+
+	at, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signed == "" {
+		return ErrInvalidSignature
+	}
+
+	age := now.Sub(time.Unix(at, 0))
+	if age > SignatureTolerance || age < -SignatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	// hmac.Equal compares in constant time, so the time taken does not tell how much of the signature was right
+	if !hmac.Equal([]byte(signed), []byte(signature(secret, timestamp, payload))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func signature(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
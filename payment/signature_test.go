@@ -0,0 +1,78 @@
+package payment
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := "whsec_test"
+	payload := []byte(`{"id":"evt_1","type":"payment.captured"}`)
+	signedAt := time.Unix(1700000000, 0)
+	header := Sign(secret, payload, signedAt)
+
+	tests := []struct {
+		name    string
+		secret  string
+		payload []byte
+		header  string
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", secret, payload, header, signedAt, false},
+		{"inside the tolerance", secret, payload, header, signedAt.Add(SignatureTolerance), false},
+		{"clock of the gateway a little ahead", secret, payload, header, signedAt.Add(-SignatureTolerance), false},
+		{"too old", secret, payload, header, signedAt.Add(SignatureTolerance + time.Second), true},
+		{"too far in the future", secret, payload, header, signedAt.Add(-SignatureTolerance - time.Second), true},
+		{"tampered payload", secret, []byte(`{"id":"evt_1","type":"payment.refunded"}`), header, signedAt, true},
+		{"wrong secret", "whsec_other", payload, header, signedAt, true},
+		{"empty secret", "", payload, Sign("", payload, signedAt), signedAt, true},
+		// The timestamp is part of what is signed, moving it to pass the tolerance breaks the signature
+		{"tampered timestamp", secret, payload, "t=1700000600," + header[len("t=1700000000,"):], signedAt.Add(10 * time.Minute), true},
+		{"no timestamp", secret, payload, header[len("t=1700000000,"):], signedAt, true},
+		{"no signature", secret, payload, "t=1700000000", signedAt, true},
+		{"empty header", secret, payload, "", signedAt, true},
+		{"garbage", secret, payload, "t=abc,v1=xyz", signedAt, true},
+	}
+
+	for _, test := range tests {
+		err := VerifySignature(test.secret, test.payload, test.header, test.now)
+		if test.wantErr {
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("%s: error %v, want ErrInvalidSignature", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error %v, want nil", test.name, err)
+		}
+	}
+}
+
+func TestMockWebhookRoundTrip(t *testing.T) {
+	provider := NewMockProvider("whsec_test")
+	intent, err := provider.CreateIntent(context.Background(), "order_1", models.NewMoney(49999, "INR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, header, err := provider.Simulate(intent.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := provider.ParseWebhook(payload, header)
+	if err != nil {
+		t.Fatalf("ParseWebhook of its own webhook = %v", err)
+	}
+	if event.Type != EventAuthorized || event.Intent.Status != StatusAuthorized || event.Intent.Client_Secret != "" {
+		t.Errorf("event %s with intent %s, want %s with %s and no client secret", event.Type, event.Intent.Status, EventAuthorized, StatusAuthorized)
+	}
+
+	if _, err := provider.ParseWebhook(append(payload, ' '), header); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ParseWebhook of a changed payload = %v, want ErrInvalidSignature", err)
+	}
+}
@@ -0,0 +1,104 @@
+package pricing
+
+import (
+	"ecommerce/models"
+	"errors"
+	"time"
+)
+
+var (
+	ErrCouponInactive      = errors.New("this coupon is not active")
+	ErrCouponNotStarted    = errors.New("this coupon is not valid yet")
+	ErrCouponExpired       = errors.New("this coupon has expired")
+	ErrCouponUsedUp        = errors.New("this coupon has been fully redeemed")
+	ErrCouponUserLimit     = errors.New("you have already used this coupon the maximum number of times")
+	ErrCouponMinBasket     = errors.New("the cart total is below the minimum for this coupon")
+	ErrCouponNotApplicable = errors.New("this coupon does not apply to any product in the cart")
+	ErrCouponNeedsAccount  = errors.New("this coupon is limited per customer, log in to use it")
+)
+
+// CouponResult is what a coupon does to a cart
+type CouponResult struct {
+	Code              string       `json:"code"`
+	Type              string       `json:"type"`
+	Discount          models.Money `json:"discount"`
+	Eligible_Subtotal models.Money `json:"eligible_subtotal"` // Lines the coupon is scoped to
+	Free_Shipping     bool         `json:"free_shipping"`
+}
+
+// ApplyCoupon checks every rule of the coupon against the cart lines and works out the discount.
+// The minimum basket is compared with the whole cart, the discount itself only comes from the lines in the scope of the coupon.
+func ApplyCoupon(coupon models.Coupon, lines []Line, now time.Time) (CouponResult, error) {
+
+	currency := linesCurrency(lines)
+
+	result := CouponResult{
+		Code:              coupon.Code,
+		Type:              coupon.Type,
+		Discount:          models.NewMoney(0, currency),
+		Eligible_Subtotal: models.NewMoney(0, currency),
+	}
+
+	if err := CheckCouponUsable(coupon, now); err != nil {
+		return result, err
+	}
+
+	// A coupon saved in another currency (e.g. before the store currency changed) can't be compared with the cart
+	if !coupon.Min_Basket.In(currency) || !coupon.Amount_Off.In(currency) || (coupon.Max_Discount != nil && !coupon.Max_Discount.In(currency)) {
+		return result, ErrCouponNotApplicable
+	}
+
+	// The promotions run first, so the coupon works on what is left of every line after them
+	subtotal := NetSubtotal(lines, currency)
+	if subtotal.Cmp(coupon.Min_Basket) < 0 {
+		return result, ErrCouponMinBasket
+	}
+
+	for _, line := range lines {
+		if inScope(coupon.Product_IDs, coupon.Categories, line) {
+			result.Eligible_Subtotal = result.Eligible_Subtotal.Add(line.Net())
+		}
+	}
+
+	if result.Eligible_Subtotal.IsZero() {
+		return result, ErrCouponNotApplicable
+	}
+
+	switch coupon.Type {
+	case models.CouponPercentage:
+		result.Discount = result.Eligible_Subtotal.Percent(coupon.Percent_Off)
+		if coupon.Max_Discount != nil && result.Discount.Cmp(*coupon.Max_Discount) > 0 {
+			result.Discount = *coupon.Max_Discount
+		}
+	case models.CouponFixed:
+		result.Discount = coupon.Amount_Off
+		if result.Discount.Cmp(result.Eligible_Subtotal) > 0 {
+			result.Discount = result.Eligible_Subtotal
+		}
+	case models.CouponFreeShipping:
+		result.Free_Shipping = true
+	}
+
+	return result, nil
+}
+
+// CheckCouponUsable checks the rules which do not depend on the cart :- active, validity window and the usage limits.
+// The uses of the customer come with the coupon in Used_By_User, the database loads them for the customer who prices the cart.
+func CheckCouponUsable(coupon models.Coupon, now time.Time) error {
+	if !coupon.Active {
+		return ErrCouponInactive
+	}
+	if coupon.Starts_At != nil && now.Before(*coupon.Starts_At) {
+		return ErrCouponNotStarted
+	}
+	if coupon.Expires_At != nil && !now.Before(*coupon.Expires_At) {
+		return ErrCouponExpired
+	}
+	if coupon.Usage_Limit > 0 && coupon.Used_Count >= coupon.Usage_Limit {
+		return ErrCouponUsedUp
+	}
+	if coupon.Per_User_Limit > 0 && coupon.Used_By_User >= coupon.Per_User_Limit {
+		return ErrCouponUserLimit
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Package pricing has the pure price calculations of the cart and the checkout, nothing in here talks to the database.
+// The database package loads the data, builds the Lines and saves whatever these functions return.
+package pricing
+
+import (
+	"ecommerce/models"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Line is one cart line together with the product details the pricing rules look at
+type Line struct {
+	Product_ID primitive.ObjectID
+	Variant_ID primitive.ObjectID
+	Category   string
+	Tax_Class  string
+	Price      models.Money // Unit price
+	Quantity   int64
+	Discount   models.Money // Promotions already applied to this line
+}
+
+func (l Line) Total() models.Money {
+	return l.Price.Mul(l.Quantity)
+}
+
+// Net is the line total after its promotions, the later rules and the coupon work on this amount
+func (l Line) Net() models.Money {
+	return l.Total().Sub(l.Discount)
+}
+
+// Subtotal adds up all the lines, the currency comes from the lines themselves
+func Subtotal(lines []Line, currency string) models.Money {
+	total := models.NewMoney(0, currency)
+	for _, line := range lines {
+		total = total.Add(line.Total())
+	}
+	return total
+}
+
+func NetSubtotal(lines []Line, currency string) models.Money {
+	total := models.NewMoney(0, currency)
+	for _, line := range lines {
+		total = total.Add(line.Net())
+	}
+	return total
+}
+
+// CheckLines makes sure every line has its price in the same currency, e.g. a cart saved before the store currency changed does not
+func CheckLines(lines []Line) error {
+	currency := linesCurrency(lines)
+	for _, line := range lines {
+		if !line.Price.In(currency) || !line.Discount.In(currency) {
+			return fmt.Errorf("%w : %s and %s in one cart", models.ErrCurrencyMismatch, currency, line.Price.Currency)
+		}
+	}
+	return nil
+}
+
+func linesCurrency(lines []Line) string {
+	if len(lines) > 0 {
+		return lines[0].Price.Currency
+	}
+	return models.DefaultCurrency()
+}
+
+// inScope is the shared product / category scope of the coupons and the promotions ; an empty scope matches every line
+func inScope(productIds []primitive.ObjectID, categories []string, line Line) bool {
+	if len(productIds) == 0 && len(categories) == 0 {
+		return true
+	}
+
+	for _, productId := range productIds {
+		if productId == line.Product_ID {
+			return true
+		}
+	}
+
+	for _, category := range categories {
+		if category == line.Category {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inWindow checks the optional starts_at / expires_at of a rule, expires_at itself is already outside
+func inWindow(startsAt *time.Time, expiresAt *time.Time, now time.Time) bool {
+	if startsAt != nil && now.Before(*startsAt) {
+		return false
+	}
+	if expiresAt != nil && !now.Before(*expiresAt) {
+		return false
+	}
+	return true
+}
+
+// allocate splits total over the weights in their ratio, the last share takes what the rounding left so the shares always add up to total
+func allocate(total models.Money, weights []models.Money) []models.Money {
+	shares := make([]models.Money, len(weights))
+
+	sum := int64(0)
+	for _, weight := range weights {
+		sum += weight.Amount
+	}
+	if sum <= 0 {
+		return shares
+	}
+
+	remaining := total
+	for i, weight := range weights {
+		share := total.MulRatio(weight.Amount, sum)
+		if i == len(weights)-1 {
+			share = remaining
+		}
+		remaining = remaining.Sub(share)
+		shares[i] = share
+	}
+	return shares
+}
@@ -0,0 +1,242 @@
+package pricing
+
+import (
+	"ecommerce/models"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// lineAdjustment is what a single rule gives to one line before it is capped and turned into a models.Adjustment
+type lineAdjustment struct {
+	index       int
+	amount      models.Money
+	description string
+}
+
+// ApplyPromotions runs the promotions on the lines and returns a copy of the lines with their Discount filled, together with one adjustment per discounted line.
+// Order and stacking :- the highest Priority runs first (the older promotion wins a tie). A promotion which is not stackable is skipped
+// when an earlier one already gave a discount, and when it gives one itself no promotion after it runs.
+// Every adjustment is capped at the Net of its line, so a line can never go below zero however many promotions it gets.
+func ApplyPromotions(promotions []models.Promotion, lines []Line, now time.Time) ([]Line, []models.Adjustment) {
+
+	priced := make([]Line, len(lines))
+	copy(priced, lines)
+
+	ordered := make([]models.Promotion, len(promotions))
+	copy(ordered, promotions)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Priority != ordered[j].Priority {
+			return ordered[i].Priority > ordered[j].Priority
+		}
+		return ordered[i].Promotion_ID.Hex() < ordered[j].Promotion_ID.Hex()
+	})
+
+	adjustments := make([]models.Adjustment, 0)
+	currency := linesCurrency(lines)
+
+	for _, promotion := range ordered {
+		if !promotion.Active || !inWindow(promotion.Starts_At, promotion.Expires_At, now) {
+			continue
+		}
+
+		// A promotion saved in another currency (e.g. before the store currency changed) can't be compared with the cart
+		if !promotion.Threshold.In(currency) || !promotion.Bundle_Price.In(currency) {
+			continue
+		}
+
+		if !promotion.Stackable && len(adjustments) > 0 {
+			continue
+		}
+
+		applied := false
+		for _, found := range evaluatePromotion(promotion, priced) {
+			line := &priced[found.index]
+
+			amount := found.amount
+			if net := line.Net(); amount.Cmp(net) > 0 {
+				amount = net
+			}
+			if amount.Amount <= 0 {
+				continue
+			}
+
+			line.Discount = line.Discount.Add(amount)
+			adjustments = append(adjustments, models.Adjustment{
+				Source:       models.AdjustmentPromotion,
+				Promotion_ID: promotion.Promotion_ID,
+				Name:         promotion.Name,
+				Variant_ID:   line.Variant_ID,
+				Amount:       amount,
+				Description:  found.description,
+			})
+			applied = true
+		}
+
+		if applied && !promotion.Stackable {
+			break
+		}
+	}
+
+	return priced, adjustments
+}
+
+func evaluatePromotion(promotion models.Promotion, lines []Line) []lineAdjustment {
+	switch promotion.Type {
+	case models.PromotionBuyXGetY:
+		return buyXGetY(promotion, lines)
+	case models.PromotionThreshold:
+		return threshold(promotion, lines)
+	case models.PromotionBundle:
+		return bundle(promotion, lines)
+	}
+	return nil
+}
+
+// unit is one piece of a line, the quantity based rules look at the pieces and not the lines
+type unit struct {
+	index int
+	price models.Money
+}
+
+// units expands the matching lines into their pieces, the most expensive first
+func units(lines []Line, match func(Line) bool) []unit {
+	pieces := make([]unit, 0)
+	for i, line := range lines {
+		if !match(line) {
+			continue
+		}
+		for q := int64(0); q < line.Quantity; q++ {
+			pieces = append(pieces, unit{index: i, price: line.Price})
+		}
+	}
+
+	sort.SliceStable(pieces, func(i, j int) bool {
+		return pieces[i].price.Amount > pieces[j].price.Amount
+	})
+	return pieces
+}
+
+// buyXGetY groups the pieces of the scope in Buy + Get, the most expensive first, and the last Get pieces of every full group are free.
+// So for "buy 2 get 1" a cart of 500, 400 and 300 gets the 300 one free, the customer can never pick the free piece.
+func buyXGetY(promotion models.Promotion, lines []Line) []lineAdjustment {
+	if promotion.Buy_Quantity < 1 || promotion.Get_Quantity < 1 {
+		return nil
+	}
+
+	pieces := units(lines, func(line Line) bool {
+		return inScope(promotion.Product_IDs, promotion.Categories, line)
+	})
+
+	group := int(promotion.Buy_Quantity + promotion.Get_Quantity)
+	free := make(map[int]int64)
+	for start := 0; start+group <= len(pieces); start += group {
+		for k := start + int(promotion.Buy_Quantity); k < start+group; k++ {
+			free[pieces[k].index]++
+		}
+	}
+
+	found := make([]lineAdjustment, 0, len(free))
+	for i := range lines {
+		if count, ok := free[i]; ok {
+			found = append(found, lineAdjustment{
+				index:       i,
+				amount:      lines[i].Price.Mul(count),
+				description: fmt.Sprintf("Buy %d get %d free : %d free", promotion.Buy_Quantity, promotion.Get_Quantity, count),
+			})
+		}
+	}
+	return found
+}
+
+// threshold gives Percent_Off on every line of the scope once their net adds up to at least Threshold.
+// The percentage is taken line by line, so every line shows its own share of the discount.
+func threshold(promotion models.Promotion, lines []Line) []lineAdjustment {
+	if promotion.Percent_Off <= 0 {
+		return nil
+	}
+
+	eligible := models.NewMoney(0, linesCurrency(lines))
+	for _, line := range lines {
+		if inScope(promotion.Product_IDs, promotion.Categories, line) {
+			eligible = eligible.Add(line.Net())
+		}
+	}
+
+	if eligible.IsZero() || eligible.Cmp(promotion.Threshold) < 0 {
+		return nil
+	}
+
+	found := make([]lineAdjustment, 0)
+	for i, line := range lines {
+		if inScope(promotion.Product_IDs, promotion.Categories, line) {
+			found = append(found, lineAdjustment{
+				index:       i,
+				amount:      line.Net().Percent(promotion.Percent_Off),
+				description: fmt.Sprintf("%s%% off over %s", percentString(promotion.Percent_Off), promotion.Threshold),
+			})
+		}
+	}
+	return found
+}
+
+// bundle sells one piece of every Bundle_Product_IDs together for Bundle_Price, as many times as the cart has complete sets.
+// The cheapest pieces of each product make the sets and the saving is shared between the lines in the ratio of their prices.
+func bundle(promotion models.Promotion, lines []Line) []lineAdjustment {
+	if len(promotion.Bundle_Product_IDs) < 2 {
+		return nil
+	}
+
+	perProduct := make([][]unit, 0, len(promotion.Bundle_Product_IDs))
+	sets := -1
+	for _, productId := range promotion.Bundle_Product_IDs {
+		pieces := units(lines, func(line Line) bool { return line.Product_ID == productId })
+		if sets == -1 || len(pieces) < sets {
+			sets = len(pieces)
+		}
+		perProduct = append(perProduct, pieces)
+	}
+
+	if sets < 1 {
+		return nil
+	}
+
+	// The pieces are sorted most expensive first, the last ones are the cheapest
+	regular := models.NewMoney(0, linesCurrency(lines))
+	weights := make(map[int]models.Money)
+	for _, pieces := range perProduct {
+		for _, piece := range pieces[len(pieces)-sets:] {
+			regular = regular.Add(piece.price)
+			weights[piece.index] = weights[piece.index].Add(piece.price)
+		}
+	}
+
+	saving := regular.Sub(promotion.Bundle_Price.Mul(int64(sets)))
+	if saving.Amount <= 0 {
+		return nil
+	}
+
+	indexes := make([]int, 0, len(weights))
+	lineWeights := make([]models.Money, 0, len(weights))
+	for i := range lines {
+		if weight, ok := weights[i]; ok {
+			indexes = append(indexes, i)
+			lineWeights = append(lineWeights, weight)
+		}
+	}
+
+	found := make([]lineAdjustment, 0, len(indexes))
+	for n, share := range allocate(saving, lineWeights) {
+		found = append(found, lineAdjustment{
+			index:       indexes[n],
+			amount:      share,
+			description: fmt.Sprintf("Bundle of %d for %s : %d set(s)", len(promotion.Bundle_Product_IDs), promotion.Bundle_Price, sets),
+		})
+	}
+	return found
+}
+
+// percentString writes basis points as a percentage, 1250 -->> "12.5"
+func percentString(basisPoints int64) string {
+	return fmt.Sprintf("%g", float64(basisPoints)/100)
+}
@@ -0,0 +1,259 @@
+package pricing
+
+import (
+	"ecommerce/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func inr(amount int64) models.Money {
+	return models.NewMoney(amount, "INR")
+}
+
+// objectId gives ids whose order is known, the promotions of the same priority are ordered by their id
+func objectId(n byte) primitive.ObjectID {
+	var id primitive.ObjectID
+	id[len(id)-1] = n
+	return id
+}
+
+func line(productId primitive.ObjectID, price int64, quantity int64) Line {
+	return Line{Product_ID: productId, Variant_ID: primitive.NewObjectID(), Price: inr(price), Quantity: quantity}
+}
+
+func discounts(lines []Line) []int64 {
+	amounts := make([]int64, len(lines))
+	for i, line := range lines {
+		amounts[i] = line.Discount.Amount
+	}
+	return amounts
+}
+
+func equal(a []int64, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBuyXGetYFreesTheCheapestPieces(t *testing.T) {
+	buy2get1 := models.Promotion{Promotion_ID: objectId(1), Type: models.PromotionBuyXGetY, Buy_Quantity: 2, Get_Quantity: 1, Active: true}
+
+	tests := []struct {
+		name  string
+		lines []Line
+		want  []int64
+	}{
+		{"one group", []Line{line(objectId(10), 50000, 1), line(objectId(11), 40000, 1), line(objectId(12), 30000, 1)}, []int64{0, 0, 30000}},
+		{"one line", []Line{line(objectId(10), 10000, 3)}, []int64{10000}},
+		{"not a full group", []Line{line(objectId(10), 50000, 1), line(objectId(11), 40000, 1)}, []int64{0, 0}},
+		// 500, 400, 300 make a group and 300 is free, 200 and 100 are left over and pay in full
+		{"leftover pieces", []Line{line(objectId(10), 10000, 1), line(objectId(11), 50000, 1), line(objectId(12), 20000, 1), line(objectId(13), 30000, 1), line(objectId(14), 40000, 1)}, []int64{0, 0, 0, 30000, 0}},
+		{"two groups", []Line{line(objectId(10), 10000, 6)}, []int64{20000}},
+	}
+
+	for _, test := range tests {
+		priced, _ := ApplyPromotions([]models.Promotion{buy2get1}, test.lines, time.Now())
+		if got := discounts(priced); !equal(got, test.want) {
+			t.Errorf("%s: discounts %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPromotionStacking(t *testing.T) {
+	tenPercent := func(id byte, priority int, stackable bool) models.Promotion {
+		return models.Promotion{Promotion_ID: objectId(id), Type: models.PromotionThreshold, Percent_Off: 1000, Priority: priority, Stackable: stackable, Active: true}
+	}
+	twentyPercent := func(id byte, priority int, stackable bool) models.Promotion {
+		promotion := tenPercent(id, priority, stackable)
+		promotion.Percent_Off = 2000
+		return promotion
+	}
+
+	tests := []struct {
+		name       string
+		promotions []models.Promotion
+		want       int64 // Discount of the one line of 1000.00
+	}{
+		// 10 % of 1000 = 100, then 20 % of the 900 left = 180
+		{"both stack, highest priority first", []models.Promotion{twentyPercent(2, 1, true), tenPercent(1, 5, true)}, 28000},
+		{"not stackable after a discount is skipped", []models.Promotion{tenPercent(1, 5, true), twentyPercent(2, 1, false)}, 10000},
+		{"not stackable first stops the rest", []models.Promotion{tenPercent(1, 1, true), twentyPercent(2, 5, false)}, 20000},
+		{"same priority, the older id first", []models.Promotion{twentyPercent(2, 1, false), tenPercent(1, 1, false)}, 10000},
+		{"inactive is skipped", []models.Promotion{{Promotion_ID: objectId(1), Type: models.PromotionThreshold, Percent_Off: 1000}}, 0},
+	}
+
+	for _, test := range tests {
+		priced, adjustments := ApplyPromotions(test.promotions, []Line{line(objectId(10), 100000, 1)}, time.Now())
+		if got := priced[0].Discount.Amount; got != test.want {
+			t.Errorf("%s: discount %d, want %d", test.name, got, test.want)
+		}
+
+		var total int64
+		for _, adjustment := range adjustments {
+			total += adjustment.Amount.Amount
+		}
+		if total != test.want {
+			t.Errorf("%s: adjustments add up to %d, want %d", test.name, total, test.want)
+		}
+	}
+}
+
+func TestPromotionsNeverTakeALineBelowZero(t *testing.T) {
+	buy1get1 := func(id byte) models.Promotion {
+		return models.Promotion{Promotion_ID: objectId(id), Type: models.PromotionBuyXGetY, Buy_Quantity: 1, Get_Quantity: 1, Stackable: true, Active: true}
+	}
+
+	priced, adjustments := ApplyPromotions([]models.Promotion{buy1get1(1), buy1get1(2), buy1get1(3)}, []Line{line(objectId(10), 10000, 2)}, time.Now())
+
+	if got := priced[0].Net().Amount; got != 0 {
+		t.Errorf("net of the line %d, want 0", got)
+	}
+	if len(adjustments) != 2 {
+		t.Errorf("%d adjustments, want 2 (the third one has nothing left to discount)", len(adjustments))
+	}
+}
+
+func TestPromotionWindow(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+	earlier := now.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		startsAt  *time.Time
+		expiresAt *time.Time
+		want      int64
+	}{
+		{"no window", nil, nil, 10000},
+		{"not started", &later, nil, 0},
+		{"expired", nil, &earlier, 0},
+		{"expires now", nil, &now, 0},
+		{"inside", &earlier, &later, 10000},
+	}
+
+	for _, test := range tests {
+		promotion := models.Promotion{Promotion_ID: objectId(1), Type: models.PromotionThreshold, Percent_Off: 1000, Active: true, Starts_At: test.startsAt, Expires_At: test.expiresAt}
+		priced, _ := ApplyPromotions([]models.Promotion{promotion}, []Line{line(objectId(10), 100000, 1)}, now)
+		if got := priced[0].Discount.Amount; got != test.want {
+			t.Errorf("%s: discount %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	scoped := objectId(10)
+
+	tests := []struct {
+		name      string
+		threshold int64
+		scope     []primitive.ObjectID
+		want      []int64
+	}{
+		{"reached", 90000, nil, []int64{7000, 3000}},
+		{"exactly reached", 100000, nil, []int64{7000, 3000}},
+		{"not reached", 100001, nil, []int64{0, 0}},
+		{"only the scope counts", 80000, []primitive.ObjectID{scoped}, []int64{0, 0}},
+		{"scope reached", 70000, []primitive.ObjectID{scoped}, []int64{7000, 0}},
+	}
+
+	for _, test := range tests {
+		promotion := models.Promotion{Promotion_ID: objectId(1), Type: models.PromotionThreshold, Percent_Off: 1000, Threshold: inr(test.threshold), Product_IDs: test.scope, Active: true}
+		lines := []Line{line(scoped, 70000, 1), line(objectId(11), 30000, 1)}
+
+		priced, _ := ApplyPromotions([]models.Promotion{promotion}, lines, time.Now())
+		if got := discounts(priced); !equal(got, test.want) {
+			t.Errorf("%s: discounts %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBundle(t *testing.T) {
+	shirt, trousers := objectId(10), objectId(11)
+
+	tests := []struct {
+		name  string
+		price int64
+		lines []Line
+		want  []int64
+	}{
+		// 3000 + 4000 for 5000 :- the saving of 2000 is shared 3 : 4, the rounding goes to the last line
+		{"one set", 500000, []Line{line(shirt, 300000, 1), line(trousers, 400000, 1)}, []int64{85714, 114286}},
+		// Only one trousers, so one set ; the second shirt is a leftover and pays in full
+		{"leftover piece", 500000, []Line{line(shirt, 300000, 2), line(trousers, 400000, 1)}, []int64{85714, 114286}},
+		{"two sets", 500000, []Line{line(shirt, 300000, 2), line(trousers, 400000, 2)}, []int64{171429, 228571}},
+		{"incomplete set", 500000, []Line{line(shirt, 300000, 2)}, []int64{0}},
+		{"bundle is dearer", 800000, []Line{line(shirt, 300000, 1), line(trousers, 400000, 1)}, []int64{0, 0}},
+	}
+
+	for _, test := range tests {
+		promotion := models.Promotion{Promotion_ID: objectId(1), Type: models.PromotionBundle, Bundle_Product_IDs: []primitive.ObjectID{shirt, trousers}, Bundle_Price: inr(test.price), Active: true}
+
+		priced, _ := ApplyPromotions([]models.Promotion{promotion}, test.lines, time.Now())
+		if got := discounts(priced); !equal(got, test.want) {
+			t.Errorf("%s: discounts %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBundleUsesTheCheapestPieces(t *testing.T) {
+	shirt, trousers := objectId(10), objectId(11)
+	promotion := models.Promotion{Promotion_ID: objectId(1), Type: models.PromotionBundle, Bundle_Product_IDs: []primitive.ObjectID{shirt, trousers}, Bundle_Price: inr(500000), Active: true}
+
+	// Two shirts at different prices and one trousers :- the set takes the cheaper shirt (3000), the dearer one pays in full
+	lines := []Line{line(shirt, 450000, 1), line(shirt, 300000, 1), line(trousers, 400000, 1)}
+
+	priced, _ := ApplyPromotions([]models.Promotion{promotion}, lines, time.Now())
+	if got, want := discounts(priced), []int64{0, 85714, 114286}; !equal(got, want) {
+		t.Errorf("discounts %v, want %v", got, want)
+	}
+}
+
+func TestPromotionInAnotherCurrencyIsSkipped(t *testing.T) {
+	promotion := models.Promotion{Promotion_ID: objectId(1), Type: models.PromotionThreshold, Percent_Off: 1000, Threshold: models.NewMoney(100, "USD"), Active: true}
+
+	priced, adjustments := ApplyPromotions([]models.Promotion{promotion}, []Line{line(objectId(10), 100000, 1)}, time.Now())
+	if priced[0].Discount.Amount != 0 || len(adjustments) != 0 {
+		t.Errorf("a USD threshold discounted an INR cart by %d", priced[0].Discount.Amount)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int64
+		weights []int64
+		want    []int64
+	}{
+		{"thirds", 100, []int64{1, 1, 1}, []int64{33, 33, 34}},
+		{"halves round to even", 5, []int64{1, 1}, []int64{2, 3}},
+		{"ratio", 2000, []int64{3000, 4000}, []int64{857, 1143}},
+		{"exact", 90, []int64{100, 200}, []int64{30, 60}},
+		{"one weight", 77, []int64{5}, []int64{77}},
+		{"zero weights", 100, []int64{0, 0}, []int64{0, 0}},
+	}
+
+	for _, test := range tests {
+		weights := make([]models.Money, len(test.weights))
+		for i, weight := range test.weights {
+			weights[i] = inr(weight)
+		}
+
+		shares := allocate(inr(test.total), weights)
+
+		got := make([]int64, len(shares))
+		for i, share := range shares {
+			got[i] = share.Amount
+		}
+		if !equal(got, test.want) {
+			t.Errorf("%s: shares %v, want %v", test.name, got, test.want)
+		}
+	}
+}
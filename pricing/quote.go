@@ -0,0 +1,84 @@
+package pricing
+
+import (
+	"ecommerce/models"
+	"time"
+)
+
+// CartQuote is the full price of a cart :- the promotions first, then the coupon on what is left.
+// The cart listing shows it and the checkout saves it into the order, so both always agree.
+type CartQuote struct {
+	Subtotal      models.Money        `json:"subtotal"`
+	Adjustments   []models.Adjustment `json:"adjustments"`
+	Discount      models.Money        `json:"discount"` // All the adjustments together
+	Total         models.Money        `json:"total"`
+	Coupon        *CouponResult       `json:"coupon,omitempty"`
+	Coupon_Error  string              `json:"coupon_error,omitempty"`
+	Free_Shipping bool                `json:"free_shipping"`
+	CouponErr     error               `json:"-"` // Why the coupon did not apply, the checkout refuses the order with it
+	Lines         []Line              `json:"-"` // The lines with every discount on them (the coupon shared out), the tax is charged on their Net
+}
+
+// QuoteCart prices the lines with the promotions and the (optional) coupon.
+// A coupon which does not apply never fails the quote, it is reported in CouponErr and the cart is priced without it.
+func QuoteCart(lines []Line, promotions []models.Promotion, coupon *models.Coupon, now time.Time) CartQuote {
+
+	currency := linesCurrency(lines)
+
+	priced, adjustments := ApplyPromotions(promotions, lines, now)
+
+	quote := CartQuote{
+		Subtotal:    Subtotal(lines, currency),
+		Adjustments: adjustments,
+		Discount:    models.NewMoney(0, currency),
+	}
+
+	if coupon != nil {
+		result, err := ApplyCoupon(*coupon, priced, now)
+		if err != nil {
+			quote.SetCouponError(err)
+		} else {
+			quote.Coupon = &result
+			quote.Free_Shipping = result.Free_Shipping
+			shareCouponDiscount(*coupon, priced, result.Discount)
+			if !result.Discount.IsZero() {
+				quote.Adjustments = append(quote.Adjustments, models.Adjustment{
+					Source:      models.AdjustmentCoupon,
+					Code:        result.Code,
+					Name:        "Coupon " + result.Code,
+					Amount:      result.Discount,
+					Description: result.Type + " coupon",
+				})
+			}
+		}
+	}
+
+	for _, adjustment := range quote.Adjustments {
+		quote.Discount = quote.Discount.Add(adjustment.Amount)
+	}
+	quote.Total = quote.Subtotal.Sub(quote.Discount)
+	quote.Lines = priced
+
+	return quote
+}
+
+// shareCouponDiscount spreads the order level coupon discount over the lines in its scope, in the ratio of what is left of them
+func shareCouponDiscount(coupon models.Coupon, lines []Line, discount models.Money) {
+	indexes := make([]int, 0, len(lines))
+	weights := make([]models.Money, 0, len(lines))
+	for i, line := range lines {
+		if inScope(coupon.Product_IDs, coupon.Categories, line) {
+			indexes = append(indexes, i)
+			weights = append(weights, line.Net())
+		}
+	}
+
+	for n, share := range allocate(discount, weights) {
+		lines[indexes[n]].Discount = lines[indexes[n]].Discount.Add(share)
+	}
+}
+
+func (q *CartQuote) SetCouponError(err error) {
+	q.CouponErr = err
+	q.Coupon_Error = err.Error()
+}
@@ -0,0 +1,158 @@
+package pricing
+
+import (
+	"ecommerce/models"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestQuoteCart(t *testing.T) {
+	shirt, trousers, socks := objectId(10), objectId(11), objectId(12)
+	tenPercentOff := models.Promotion{Promotion_ID: objectId(1), Type: models.PromotionThreshold, Percent_Off: 1000, Active: true}
+	maxDiscount := inr(5000)
+
+	tests := []struct {
+		name       string
+		lines      []Line
+		promotions []models.Promotion
+		coupon     *models.Coupon
+		want       []int64 // Discount of every line, the coupon shared out
+		wantTotal  int64
+		wantErr    error
+	}{
+		{
+			name:      "no coupon",
+			lines:     []Line{line(shirt, 100000, 1), line(trousers, 50000, 1)},
+			want:      []int64{0, 0},
+			wantTotal: 150000,
+		},
+		{
+			// 10 % promotion :- 100 + 50, then 10 % coupon on the 1350 left = 135, shared 900 : 450
+			name:       "coupon after the promotions",
+			lines:      []Line{line(shirt, 100000, 1), line(trousers, 50000, 1)},
+			promotions: []models.Promotion{tenPercentOff},
+			coupon:     &models.Coupon{Code: "TEN", Type: models.CouponPercentage, Percent_Off: 1000, Active: true},
+			want:       []int64{19000, 9500},
+			wantTotal:  121500,
+		},
+		{
+			name:      "fixed coupon rounding goes to the last line",
+			lines:     []Line{line(shirt, 10000, 1), line(trousers, 10000, 1), line(socks, 10000, 1)},
+			coupon:    &models.Coupon{Code: "HUNDRED", Type: models.CouponFixed, Amount_Off: inr(100), Active: true},
+			want:      []int64{33, 33, 34},
+			wantTotal: 29900,
+		},
+		{
+			name:      "fixed coupon is capped at the eligible lines",
+			lines:     []Line{line(shirt, 10000, 1)},
+			coupon:    &models.Coupon{Code: "BIG", Type: models.CouponFixed, Amount_Off: inr(50000), Active: true},
+			want:      []int64{10000},
+			wantTotal: 0,
+		},
+		{
+			name:      "percentage coupon is capped by max discount",
+			lines:     []Line{line(shirt, 100000, 1)},
+			coupon:    &models.Coupon{Code: "CAP", Type: models.CouponPercentage, Percent_Off: 1000, Max_Discount: &maxDiscount, Active: true},
+			want:      []int64{5000},
+			wantTotal: 95000,
+		},
+		{
+			name:      "coupon scoped to one product",
+			lines:     []Line{line(shirt, 100000, 1), line(trousers, 50000, 1)},
+			coupon:    &models.Coupon{Code: "SHIRT", Type: models.CouponPercentage, Percent_Off: 1000, Product_IDs: []primitive.ObjectID{shirt}, Active: true},
+			want:      []int64{10000, 0},
+			wantTotal: 140000,
+		},
+		{
+			// The minimum basket is compared with what is left after the promotions :- 900 < 950
+			name:       "minimum basket after the promotions",
+			lines:      []Line{line(shirt, 100000, 1)},
+			promotions: []models.Promotion{tenPercentOff},
+			coupon:     &models.Coupon{Code: "MIN", Type: models.CouponPercentage, Percent_Off: 1000, Min_Basket: inr(95000), Active: true},
+			want:       []int64{10000},
+			wantTotal:  90000,
+			wantErr:    ErrCouponMinBasket,
+		},
+		{
+			name:      "coupon in another currency",
+			lines:     []Line{line(shirt, 100000, 1)},
+			coupon:    &models.Coupon{Code: "USD", Type: models.CouponFixed, Amount_Off: models.NewMoney(1000, "USD"), Active: true},
+			want:      []int64{0},
+			wantTotal: 100000,
+			wantErr:   ErrCouponNotApplicable,
+		},
+		{
+			name:      "inactive coupon",
+			lines:     []Line{line(shirt, 100000, 1)},
+			coupon:    &models.Coupon{Code: "OFF", Type: models.CouponPercentage, Percent_Off: 1000},
+			want:      []int64{0},
+			wantTotal: 100000,
+			wantErr:   ErrCouponInactive,
+		},
+	}
+
+	for _, test := range tests {
+		quote := QuoteCart(test.lines, test.promotions, test.coupon, time.Now())
+
+		if !errors.Is(quote.CouponErr, test.wantErr) {
+			t.Errorf("%s: coupon error %v, want %v", test.name, quote.CouponErr, test.wantErr)
+		}
+		if got := discounts(quote.Lines); !equal(got, test.want) {
+			t.Errorf("%s: discounts %v, want %v", test.name, got, test.want)
+		}
+		if quote.Total.Amount != test.wantTotal {
+			t.Errorf("%s: total %d, want %d", test.name, quote.Total.Amount, test.wantTotal)
+		}
+
+		// The lines, the adjustments and the totals must always tell the same story
+		if quote.Subtotal.Sub(quote.Discount) != quote.Total {
+			t.Errorf("%s: subtotal %v - discount %v != total %v", test.name, quote.Subtotal, quote.Discount, quote.Total)
+		}
+		if net := NetSubtotal(quote.Lines, "INR"); net != quote.Total {
+			t.Errorf("%s: lines add up to %v, total is %v", test.name, net, quote.Total)
+		}
+	}
+}
+
+func TestQuoteCartFreeShipping(t *testing.T) {
+	coupon := models.Coupon{Code: "SHIPFREE", Type: models.CouponFreeShipping, Active: true}
+
+	quote := QuoteCart([]Line{line(objectId(10), 100000, 1)}, nil, &coupon, time.Now())
+
+	if !quote.Free_Shipping || quote.CouponErr != nil {
+		t.Errorf("free shipping %v, error %v ; want free shipping", quote.Free_Shipping, quote.CouponErr)
+	}
+	if len(quote.Adjustments) != 0 || quote.Total.Amount != 100000 {
+		t.Errorf("free shipping changed the items :- %d adjustments, total %d", len(quote.Adjustments), quote.Total.Amount)
+	}
+}
+
+func TestCheckCouponUsable(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+	earlier := now.Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		want   error
+	}{
+		{"usable", models.Coupon{Active: true}, nil},
+		{"inactive", models.Coupon{}, ErrCouponInactive},
+		{"not started", models.Coupon{Active: true, Starts_At: &later}, ErrCouponNotStarted},
+		{"expired", models.Coupon{Active: true, Expires_At: &earlier}, ErrCouponExpired},
+		{"used up", models.Coupon{Active: true, Usage_Limit: 5, Used_Count: 5}, ErrCouponUsedUp},
+		{"user limit", models.Coupon{Active: true, Per_User_Limit: 1, Used_By_User: 1}, ErrCouponUserLimit},
+		{"user below the limit", models.Coupon{Active: true, Per_User_Limit: 2, Used_By_User: 1}, nil},
+		{"no user limit", models.Coupon{Active: true, Used_By_User: 5}, nil},
+	}
+
+	for _, test := range tests {
+		if err := CheckCouponUsable(test.coupon, now); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+	}
+}
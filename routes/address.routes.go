@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The address book of the logged in user
+func AddressRoutes(incomingRequest *gin.Engine) {
+	authorized := incomingRequest.Group("/", middleware.Authentication())
+	authorized.GET("/addresses", controllers.ListAddresses())
+	authorized.POST("/addresses", controllers.AddAddress())
+	authorized.GET("/addresses/:addressId", controllers.GetAddress())
+	authorized.PUT("/addresses/:addressId", controllers.UpdateAddress())
+	authorized.DELETE("/addresses/:addressId", controllers.DeleteAddress())
+}
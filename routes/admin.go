@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminGroup is for the api's of the shop staff :- the user must be logged in and the account must have the admin role
+func adminGroup(incomingRequest *gin.Engine) *gin.RouterGroup {
+	return incomingRequest.Group("/", middleware.Authentication(), middleware.Admin(controllers.UserCollection))
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The cart of the logged in user
+func CartRoutes(incomingRequest *gin.Engine) {
+	authorized := incomingRequest.Group("/", middleware.Authentication())
+	authorized.POST("/cart/acknowledge", controllers.AcknowledgeCart())
+
+	admin := adminGroup(incomingRequest)
+	admin.GET("/admin/cart-reminders", controllers.ListCartReminders())
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// All the coupon api's need a logged in user, the cart ones work on the cart of that user
+func CouponRoutes(incomingRequest *gin.Engine) {
+	authorized := incomingRequest.Group("/", middleware.Authentication())
+	authorized.POST("/cart/coupon", controllers.ApplyCartCoupon())
+	authorized.DELETE("/cart/coupon", controllers.RemoveCartCoupon())
+
+	admin := adminGroup(incomingRequest)
+	admin.POST("/admin/coupons", controllers.CreateCoupon())
+	admin.GET("/admin/coupons", controllers.ListCoupons())
+	admin.PUT("/admin/coupons/:couponId", controllers.UpdateCouponStatus())
+}
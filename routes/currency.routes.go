@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Anyone can read the rates to show the currency picker, only the admin api changes them
+func CurrencyRoutes(incomingRequest *gin.Engine) {
+	incomingRequest.GET("/exchange-rates", controllers.GetExchangeRates())
+
+	// Below are the api's will authorize first from the middleware, and only an admin gets through
+	admin := adminGroup(incomingRequest)
+	admin.PUT("/admin/exchange-rates", controllers.UpdateExchangeRates())
+}
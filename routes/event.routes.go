@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The outbox of the domain events, for the admin
+func EventRoutes(incomingRequest *gin.Engine) {
+	admin := adminGroup(incomingRequest)
+	admin.GET("/admin/events", controllers.ListEvents())
+	admin.POST("/admin/events/:eventId/retry", controllers.RetryEvent())
+}
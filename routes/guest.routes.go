@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The cart of a visitor without an account ; every api except the creation of the cart needs its signed X-Cart-Token
+func GuestRoutes(incomingRequest *gin.Engine, idempotencyKeys *mongo.Collection) {
+	incomingRequest.POST("/guest/cart", controllers.CreateGuestCart())
+
+	guest := incomingRequest.Group("/guest", middleware.GuestCart())
+	guest.GET("/cart", controllers.GetGuestCart())
+	guest.POST("/cart/items", controllers.AddToGuestCart())
+	guest.DELETE("/cart/items/:variantId", controllers.RemoveFromGuestCart())
+	guest.POST("/cart/acknowledge", controllers.AcknowledgeCart())
+	guest.POST("/cart/coupon", controllers.ApplyCartCoupon())
+	guest.DELETE("/cart/coupon", controllers.RemoveCartCoupon())
+	guest.GET("/cart/shipping", controllers.ShippingQuote())
+	guest.POST("/checkout", middleware.Idempotency(idempotencyKeys), controllers.GuestCheckout())
+	guest.GET("/orders", controllers.ListGuestOrders())
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ImageRoutes(incomingRequest *gin.Engine) {
+	incomingRequest.GET("/images/:imageId", controllers.ServeImage())
+
+	// Below are the api's will authorize first from the middleware, and only an admin gets through
+	admin := adminGroup(incomingRequest)
+	admin.POST("/admin/products/:productId/images", controllers.UploadProductImage())
+	admin.DELETE("/admin/products/:productId/images/:imageId", controllers.DeleteProductImage())
+}
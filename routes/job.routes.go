@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The background job queue, for the admin
+func JobRoutes(incomingRequest *gin.Engine) {
+	admin := adminGroup(incomingRequest)
+	admin.GET("/admin/jobs", controllers.ListJobs())
+	admin.GET("/admin/jobs/dead", controllers.ListDeadJobs())
+	admin.POST("/admin/jobs/dead/:jobId/retry", controllers.RetryDeadJob())
+}
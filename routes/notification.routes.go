@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Shipping of the orders and the log of the emails and sms sent to the customers, for the admin
+func NotificationRoutes(incomingRequest *gin.Engine) {
+	admin := adminGroup(incomingRequest)
+	admin.POST("/admin/orders/:orderId/ship", controllers.ShipOrder())
+	admin.GET("/admin/notifications", controllers.ListDeliveries())
+}
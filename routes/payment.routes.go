@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The webhook is called by the payment gateway without a user token, its signature proves where it comes from
+func PaymentRoutes(incomingRequest *gin.Engine) {
+	incomingRequest.POST("/payments/webhook", controllers.PaymentWebhook())
+
+	// Only with PAYMENT_PROVIDER=mock, a customer pays their own orders without money
+	if controllers.MockPaymentsEnabled() {
+		authorized := incomingRequest.Group("/", middleware.Authentication())
+		authorized.POST("/payments/mock/:intentId", controllers.MockPayment())
+	}
+
+	admin := adminGroup(incomingRequest)
+	admin.POST("/admin/orders/:orderId/payment/capture", controllers.CaptureOrderPayment())
+	admin.POST("/admin/orders/:orderId/payment/refund", controllers.RefundOrderPayment())
+	admin.POST("/admin/orders/:orderId/payment/void", controllers.VoidOrderPayment())
+}
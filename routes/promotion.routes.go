@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Promotions apply by themselves to the carts, so only the admin has api's for them
+func PromotionRoutes(incomingRequest *gin.Engine) {
+	admin := adminGroup(incomingRequest)
+	admin.POST("/admin/promotions", controllers.CreatePromotion())
+	admin.GET("/admin/promotions", controllers.ListPromotions())
+	admin.PUT("/admin/promotions/:promotionId", controllers.UpdatePromotionStatus())
+}
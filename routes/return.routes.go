@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Customers return the lines of their own orders, the admin moves the returns on
+func ReturnRoutes(incomingRequest *gin.Engine) {
+	authorized := incomingRequest.Group("/", middleware.Authentication())
+	authorized.POST("/returns", controllers.RequestReturn())
+	authorized.GET("/returns", controllers.ListMyReturns())
+
+	admin := adminGroup(incomingRequest)
+	admin.GET("/admin/returns", controllers.ListReturns())
+	admin.PUT("/admin/returns/:returnId", controllers.UpdateReturnStatus())
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The review routes uses a route group for the authorized api's instead of incomingRequest.Use(), so the public listing stays open for everybody.
+func ReviewRoutes(incomingRequest *gin.Engine) {
+	incomingRequest.GET("/products/:productId/reviews", controllers.GetProductReviews())
+
+	// Below are the api's will authorize first from the middleware
+	authorized := incomingRequest.Group("/", middleware.Authentication())
+	authorized.POST("/products/:productId/reviews", controllers.AddReview())
+
+	admin := adminGroup(incomingRequest)
+	admin.GET("/admin/reviews", controllers.ListReviewsAdmin())
+	admin.PUT("/admin/reviews/:reviewId", controllers.ModerateReview())
+}
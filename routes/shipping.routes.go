@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The shipping quote is for the cart of the logged in user
+func ShippingRoutes(incomingRequest *gin.Engine) {
+	authorized := incomingRequest.Group("/", middleware.Authentication())
+	authorized.GET("/cart/shipping", controllers.ShippingQuote())
+}
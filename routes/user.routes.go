@@ -17,7 +17,11 @@ func UserRoutes(incomingRequest *gin.Engine) { // incomingRequest is a pointer t
 	incomingRequest.GET("/users/search", controllers.SearchProductByQuery())
 	incomingRequest.GET("/users/productview", controllers.GetAllProducts())
 
+	// The admin group checks the token itself, so it is made before Use puts Authentication on the whole router
+	admin := adminGroup(incomingRequest)
+	admin.POST("/admin/products/import", controllers.ImportProducts())
+	admin.GET("/admin/products/export", controllers.ExportProducts())
+	admin.POST("/admin/addproduct", controllers.ProductViewerAdmin())
+
 	incomingRequest.Use(middleware.Authentication())
-	// Below are the api's will authorize first from the middleware
-	incomingRequest.POST("/admin/addproduct", controllers.ProductViewerAdmin())
 }
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The wishlists of the logged in user ; a shared wishlist can be read by anybody with its link
+func WishlistRoutes(incomingRequest *gin.Engine) {
+	incomingRequest.GET("/wishlists/shared/:token", controllers.GetSharedWishlist())
+
+	authorized := incomingRequest.Group("/", middleware.Authentication())
+	authorized.GET("/wishlists", controllers.ListWishlists())
+	authorized.POST("/wishlists", controllers.CreateWishlist())
+	authorized.GET("/wishlists/:wishlistId", controllers.GetWishlist())
+	authorized.PUT("/wishlists/:wishlistId", controllers.RenameWishlist())
+	authorized.DELETE("/wishlists/:wishlistId", controllers.DeleteWishlist())
+	authorized.POST("/wishlists/:wishlistId/items", controllers.AddWishlistItem())
+	authorized.DELETE("/wishlists/:wishlistId/items/:variantId", controllers.RemoveWishlistItem())
+	authorized.POST("/wishlists/:wishlistId/items/:variantId/move", controllers.MoveWishlistItemToCart())
+	authorized.POST("/wishlists/:wishlistId/share", controllers.ShareWishlist())
+	authorized.DELETE("/wishlists/:wishlistId/share", controllers.UnshareWishlist())
+}
@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Task is a piece of background work which runs again every Interval
+type Task struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs the tasks inside the service, every task in its own goroutine.
+// A run never overlaps with the previous run of the same task, a slow run just delays the next one.
+type Scheduler struct {
+	tasks []Task
+	wg    sync.WaitGroup
+}
+
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+func (s *Scheduler) Add(task Task) {
+	s.tasks = append(s.tasks, task)
+}
+
+// Start runs every task once an interval until the context is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, task := range s.tasks {
+		if task.Interval <= 0 {
+			log.Println("Task " + task.Name + " has no interval, it is not scheduled")
+			continue
+		}
+
+		s.wg.Add(1)
+		go func(task Task) {
+			defer s.wg.Done()
+
+			ticker := time.NewTicker(task.Interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					s.run(ctx, task)
+				}
+			}
+		}(task)
+	}
+}
+
+// Wait blocks until every task stopped after the context of Start was cancelled
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// run keeps a panicking task from taking the whole service down
+func (s *Scheduler) run(ctx context.Context, task Task) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Println("Task "+task.Name+" panicked :- ", recovered)
+		}
+	}()
+
+	if err := task.Run(ctx); err != nil {
+		log.Println("Task "+task.Name+" failed :- ", err)
+	}
+}
@@ -0,0 +1,228 @@
+// Package shipping has the delivery methods of the store and works out what a parcel costs to ship with each of them.
+// The methods, the destination zones and the rate tables come from a local json file.
+package shipping
+
+import (
+	"ecommerce/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrUnknownMethod     = errors.New("this shipping method is not available")
+	ErrNoRate            = errors.New("this shipping method does not deliver this parcel to this address")
+	ErrAddressIsRequired = errors.New("an address is required for this shipping method")
+)
+
+// Config is the content of the shipping file
+type Config struct {
+	Zones   []Zone   `json:"zones"`
+	Methods []Method `json:"methods"`
+}
+
+// A Zone is a group of destinations with the same rates ; a zone without pincode prefixes and cities takes every other address
+type Zone struct {
+	Code             string   `json:"code"`
+	Name             string   `json:"name"`
+	Pincode_Prefixes []string `json:"pincode_prefixes,omitempty"`
+	Cities           []string `json:"cities,omitempty"`
+}
+
+type Method struct {
+	Code          string        `json:"code"`
+	Name          string        `json:"name"`
+	Delivery_Days string        `json:"delivery_days"`
+	Pickup        bool          `json:"pickup"`              // Collected from the store, so the address does not matter
+	Free_Over     *models.Money `json:"free_over,omitempty"` // Orders from this amount ship for free
+	Rates         []Rate        `json:"rates"`
+}
+
+// Rate is one row of the rate table of a method, the first row which matches the parcel gives the price.
+// An empty zone matches every zone and a zero Max_Weight_Grams matches every weight.
+type Rate struct {
+	Zone             string       `json:"zone,omitempty"`
+	Max_Weight_Grams int64        `json:"max_weight_grams,omitempty"`
+	Min_Order        models.Money `json:"min_order"` // Order amount needed for this row
+	Price            models.Money `json:"price"`
+}
+
+// Parcel is what the rates look at :- where it goes, how heavy it is and the order amount after the discounts
+type Parcel struct {
+	Address       models.Address
+	Weight_Grams  int64
+	Order_Amount  models.Money
+	Free_Shipping bool // A free shipping coupon
+}
+
+type Quote struct {
+	Method        string       `json:"method"`
+	Name          string       `json:"name"`
+	Delivery_Days string       `json:"delivery_days"`
+	Zone          string       `json:"zone"`
+	Price         models.Money `json:"price"`
+}
+
+// Load reads and checks the shipping file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	// The parcels are priced in the store currency, an amount in another currency can't be compared with the order
+	currency := models.DefaultCurrency()
+
+	for _, method := range config.Methods {
+		if method.Code == "" {
+			return nil, errors.New("every shipping method needs a code")
+		}
+		if method.Free_Over != nil {
+			if err := checkAmount(*method.Free_Over, currency); err != nil {
+				return nil, fmt.Errorf("free_over of the method %s :- %w", method.Code, err)
+			}
+		}
+		for _, rate := range method.Rates {
+			if err := checkAmount(rate.Price, currency); err != nil {
+				return nil, fmt.Errorf("price of the method %s :- %w", method.Code, err)
+			}
+			if err := checkAmount(rate.Min_Order, currency); err != nil {
+				return nil, fmt.Errorf("min_order of the method %s :- %w", method.Code, err)
+			}
+			if rate.Max_Weight_Grams < 0 {
+				return nil, errors.New("negative max_weight_grams in the method " + method.Code)
+			}
+		}
+	}
+
+	return &config, nil
+}
+
+// checkAmount accepts an amount of the file which is not negative and in the store currency ; a missing min_order is zero without a currency
+func checkAmount(amount models.Money, currency string) error {
+	if amount.IsNegative() {
+		return errors.New("the amount can't be negative")
+	}
+	if !amount.In(currency) {
+		return fmt.Errorf("the amount is in %s, it must be in the store currency %s", amount.Currency, currency)
+	}
+	return nil
+}
+
+// DefaultMethod is the first method of the file, used when the customer does not pick one
+func (c *Config) DefaultMethod() string {
+	if len(c.Methods) == 0 {
+		return ""
+	}
+	return c.Methods[0].Code
+}
+
+// QuoteAll gives the price of every method which can deliver the parcel, the others are left out
+func (c *Config) QuoteAll(parcel Parcel) []Quote {
+	quotes := make([]Quote, 0, len(c.Methods))
+	for _, method := range c.Methods {
+		if quote, err := c.QuoteMethod(method.Code, parcel); err == nil {
+			quotes = append(quotes, quote)
+		}
+	}
+	return quotes
+}
+
+func (c *Config) QuoteMethod(code string, parcel Parcel) (Quote, error) {
+	method, ok := c.method(code)
+	if !ok {
+		return Quote{}, ErrUnknownMethod
+	}
+
+	zone := ""
+	if !method.Pickup {
+		if parcel.Address.Pincode == nil && parcel.Address.City == nil {
+			return Quote{}, ErrAddressIsRequired
+		}
+		zone = c.zone(parcel.Address)
+	}
+
+	for _, rate := range method.Rates {
+		if rate.Zone != "" && rate.Zone != zone {
+			continue
+		}
+		if rate.Max_Weight_Grams > 0 && parcel.Weight_Grams > rate.Max_Weight_Grams {
+			continue
+		}
+		if parcel.Order_Amount.Cmp(rate.Min_Order) < 0 {
+			continue
+		}
+
+		quote := Quote{
+			Method:        method.Code,
+			Name:          method.Name,
+			Delivery_Days: method.Delivery_Days,
+			Zone:          zone,
+			Price:         rate.Price,
+		}
+
+		if parcel.Free_Shipping || (method.Free_Over != nil && parcel.Order_Amount.Cmp(*method.Free_Over) >= 0) {
+			quote.Price = models.NewMoney(0, parcel.Order_Amount.Currency)
+		}
+
+		return quote, nil
+	}
+
+	return Quote{}, ErrNoRate
+}
+
+func (c *Config) method(code string) (Method, bool) {
+	for _, method := range c.Methods {
+		if strings.EqualFold(method.Code, code) {
+			return method, true
+		}
+	}
+	return Method{}, false
+}
+
+// zone picks the zone of the address :- the longest matching pincode prefix, then the city, then the zone for everything else
+func (c *Config) zone(address models.Address) string {
+	pincode := ""
+	if address.Pincode != nil {
+		pincode = strings.ReplaceAll(*address.Pincode, " ", "")
+	}
+	city := ""
+	if address.City != nil {
+		city = strings.TrimSpace(*address.City)
+	}
+
+	best, longest := "", 0
+	for _, zone := range c.Zones {
+		for _, prefix := range zone.Pincode_Prefixes {
+			if prefix != "" && strings.HasPrefix(pincode, prefix) && len(prefix) > longest {
+				best, longest = zone.Code, len(prefix)
+			}
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	for _, zone := range c.Zones {
+		for _, zoneCity := range zone.Cities {
+			if strings.EqualFold(zoneCity, city) {
+				return zone.Code
+			}
+		}
+	}
+
+	for _, zone := range c.Zones {
+		if len(zone.Pincode_Prefixes) == 0 && len(zone.Cities) == 0 {
+			return zone.Code
+		}
+	}
+
+	return ""
+}
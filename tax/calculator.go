@@ -0,0 +1,48 @@
+// Package tax works out the tax lines of an order. The checkout only talks to the Calculator interface,
+// so the local rules file can be swapped for an external tax provider without touching the checkout.
+package tax
+
+import (
+	"context"
+	"ecommerce/models"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The tax class of the products which do not have one
+const DefaultClass = "standard"
+
+var ErrTaxUnavailable = errors.New("cannot calculate the tax of this order")
+
+// Line is one order line after all its discounts, the tax is charged on Amount
+type Line struct {
+	Variant_ID primitive.ObjectID `json:"variant_id"`
+	Tax_Class  string             `json:"tax_class"`
+	Amount     models.Money       `json:"amount"`
+}
+
+// Request is what a Calculator needs :- where the order ships to and what is in it
+type Request struct {
+	Address models.Address `json:"address"`
+	Lines   []Line         `json:"lines"`
+}
+
+type Result struct {
+	Lines     []models.TaxLine `json:"lines"`
+	Total     models.Money     `json:"total"`
+	Inclusive bool             `json:"inclusive"` // The Amount of the request lines already has the tax inside
+}
+
+type Calculator interface {
+	Calculate(ctx context.Context, request Request) (Result, error)
+}
+
+// Total adds up the tax lines in the currency of the order
+func Total(lines []models.TaxLine, currency string) models.Money {
+	total := models.NewMoney(0, currency)
+	for _, line := range lines {
+		total = total.Add(line.Amount)
+	}
+	return total
+}
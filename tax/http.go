@@ -0,0 +1,75 @@
+package tax
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// HTTPCalculator asks an external tax provider, it posts the Request as json and reads a Result back
+type HTTPCalculator struct {
+	URL    string
+	Token  string // Sent as "Authorization: Bearer <token>" when set
+	Client *http.Client
+}
+
+func NewHTTPCalculator(url string, token string) *HTTPCalculator {
+	return &HTTPCalculator{
+		URL:    url,
+		Token:  token,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (h *HTTPCalculator) Calculate(ctx context.Context, request Request) (Result, error) {
+	var result Result
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return result, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return result, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if h.Token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+
+	response, err := h.Client.Do(httpRequest)
+	if err != nil {
+		log.Println("Error while calling the tax provider ", err)
+		return result, ErrTaxUnavailable
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		log.Println("The tax provider answered with ", response.Status)
+		return result, fmt.Errorf("%w : provider answered %s", ErrTaxUnavailable, response.Status)
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		log.Println("Error while reading the answer of the tax provider ", err)
+		return result, ErrTaxUnavailable
+	}
+
+	// The order total is worked out from the lines, a provider total which does not match them is not trusted
+	currency := result.Total.Currency
+	if len(request.Lines) > 0 {
+		currency = request.Lines[0].Amount.Currency
+	}
+	for _, line := range result.Lines {
+		if line.Amount.Currency != currency {
+			return result, fmt.Errorf("%w : provider answered in %s", ErrTaxUnavailable, line.Amount.Currency)
+		}
+	}
+	result.Total = Total(result.Lines, currency)
+
+	return result, nil
+}
@@ -0,0 +1,194 @@
+package tax
+
+import (
+	"context"
+	"ecommerce/models"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+// Rules is the content of the tax rules file
+//
+//	{
+//	  "inclusive": true,
+//	  "rules": [
+//	    {"name": "Delhi", "pincode_prefixes": ["11"], "components": [{"name": "CGST", "rate": 900}, {"name": "SGST", "rate": 900}]},
+//	    {"name": "Exempt", "tax_classes": ["exempt"], "components": []},
+//	    {"name": "Rest of India", "components": [{"name": "IGST", "rate": 1800}]}
+//	  ]
+//	}
+type Rules struct {
+	Inclusive bool   `json:"inclusive"` // The catalog prices already have the tax inside
+	Rules     []Rule `json:"rules"`
+}
+
+// A Rule applies to an address by its pincode prefix or city and to the products of its tax classes ; an empty list matches everything.
+// A rule without components is a tax free rule.
+type Rule struct {
+	Name             string      `json:"name"`
+	Pincode_Prefixes []string    `json:"pincode_prefixes,omitempty"`
+	Cities           []string    `json:"cities,omitempty"`
+	Tax_Classes      []string    `json:"tax_classes,omitempty"`
+	Components       []Component `json:"components"`
+}
+
+type Component struct {
+	Name string `json:"name"`
+	Rate int64  `json:"rate"` // Basis points, 900 = 9 %
+}
+
+// RuleCalculator is the built in Calculator, it works out the tax from the local rules file
+type RuleCalculator struct {
+	rules Rules
+}
+
+func NewRuleCalculator(rules Rules) *RuleCalculator {
+	return &RuleCalculator{rules: rules}
+}
+
+// LoadRules reads and checks the rules file
+func LoadRules(path string) (Rules, error) {
+	var rules Rules
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, err
+	}
+
+	for _, rule := range rules.Rules {
+		// A rule matches by its pincode prefixes or else by its cities, a rule with both would quietly skip the cities
+		if len(rule.Pincode_Prefixes) > 0 && len(rule.Cities) > 0 {
+			return rules, errors.New("the rule " + rule.Name + " has pincode_prefixes and cities, split it in one rule for each")
+		}
+		for _, component := range rule.Components {
+			if component.Rate < 0 || component.Rate > 10000 {
+				return rules, errors.New("invalid tax rate in the rule " + rule.Name)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// Calculate picks the most specific rule for every line and charges each of its components.
+// Exclusive prices :- tax = amount * rate. Inclusive prices :- the tax is taken out of the amount, tax = amount * rate / (100 % + all rates of the rule).
+func (r *RuleCalculator) Calculate(ctx context.Context, request Request) (Result, error) {
+
+	currency := models.DefaultCurrency()
+	if len(request.Lines) > 0 {
+		currency = request.Lines[0].Amount.Currency
+	}
+
+	result := Result{Lines: make([]models.TaxLine, 0), Inclusive: r.rules.Inclusive}
+
+	for _, line := range request.Lines {
+		class := line.Tax_Class
+		if class == "" {
+			class = DefaultClass
+		}
+
+		rule, ok := r.match(request.Address, class)
+		if !ok {
+			return result, ErrTaxUnavailable
+		}
+
+		var totalRate int64
+		for _, component := range rule.Components {
+			totalRate += component.Rate
+		}
+
+		for _, component := range rule.Components {
+			amount := line.Amount.Percent(component.Rate)
+			if r.rules.Inclusive {
+				amount = line.Amount.MulRatio(component.Rate, 10000+totalRate)
+			}
+
+			result.Lines = append(result.Lines, models.TaxLine{
+				Variant_ID: line.Variant_ID,
+				Tax_Class:  class,
+				Name:       component.Name,
+				Rate:       component.Rate,
+				Taxable:    line.Amount,
+				Amount:     amount,
+			})
+		}
+	}
+
+	result.Total = Total(result.Lines, currency)
+	return result, nil
+}
+
+// match scores the rules, the highest score wins and the earlier rule wins a tie :-
+// a rule naming the tax class beats every rule for all classes (an exempt product stays exempt everywhere),
+// then a pincode prefix beats a city (a longer prefix beats a shorter one) and a city beats a rule for every region.
+func (r *RuleCalculator) match(address models.Address, class string) (Rule, bool) {
+
+	pincode := ""
+	if address.Pincode != nil {
+		pincode = strings.ReplaceAll(*address.Pincode, " ", "")
+	}
+	city := ""
+	if address.City != nil {
+		city = strings.TrimSpace(*address.City)
+	}
+
+	best := -1
+	var found Rule
+
+	for _, rule := range r.rules.Rules {
+		score := 0
+
+		switch {
+		case len(rule.Pincode_Prefixes) > 0:
+			prefix := longestPrefix(rule.Pincode_Prefixes, pincode)
+			if prefix == 0 {
+				continue
+			}
+			score = 100 + prefix*2
+		case len(rule.Cities) > 0:
+			if !containsFold(rule.Cities, city) {
+				continue
+			}
+			score = 50
+		}
+
+		if len(rule.Tax_Classes) > 0 {
+			if !containsFold(rule.Tax_Classes, class) {
+				continue
+			}
+			score += 1000
+		}
+
+		if score > best {
+			best = score
+			found = rule
+		}
+	}
+
+	return found, best >= 0
+}
+
+func longestPrefix(prefixes []string, pincode string) int {
+	longest := 0
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(pincode, prefix) && len(prefix) > longest {
+			longest = len(prefix)
+		}
+	}
+	return longest
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// A cart token is "<guest cart id>.<signature>" ; the signature is a HMAC-SHA256 of the id with the secret key,
+// so a guest can only reach the cart the server gave out and can't guess the cart of somebody else.
+
+func SignCartToken(secretKey string, cartId string) string {
+	return cartId + "." + cartTokenSignature(secretKey, cartId)
+}
+
+// VerifyCartToken gives back the guest cart id of a token, ok is false when the token was not signed with this key
+func VerifyCartToken(secretKey string, token string) (cartId string, ok bool) {
+	cartId, signature, found := strings.Cut(strings.TrimSpace(token), ".")
+	if !found || cartId == "" || secretKey == "" {
+		return "", false
+	}
+
+	// hmac.Equal compares in constant time so the signature can't be guessed byte by byte from the response time
+	if !hmac.Equal([]byte(signature), []byte(cartTokenSignature(secretKey, cartId))) {
+		return "", false
+	}
+
+	return cartId, true
+}
+
+func cartTokenSignature(secretKey string, cartId string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte("cart." + cartId))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}